@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Non-interactive entry points: subcommands given on the shell command line
+// (`lanmanvan run portscan host=10.0.0.5`) and .lmv scripts. Both go through
+// the same engine as the prompt and leave their outcome in ExitCode
+
+// subcommands are the commands main accepts on its command line
+var subcommands = map[string]bool{
+	"run":    true,
+	"list":   true,
+	"info":   true,
+	"search": true,
+	"env":    true,
+	"module": true,
+}
+
+// IsSubcommand reports whether name is a command line subcommand rather
+// than a script to run
+func IsSubcommand(name string) bool {
+	return subcommands[name]
+}
+
+// SetJSON makes commands print machine readable JSON instead of boxes and
+// colors, one value per command
+func (cli *CLI) SetJSON(on bool) {
+	cli.jsonOut = on
+}
+
+// ExitCode is the exit status of the last statement, the module's own
+// exit code for a module run
+func (cli *CLI) ExitCode() int {
+	return cli.lastExit
+}
+
+// setup loads the modules, installs the Ctrl+C handler and runs the -rc
+// script, for the prompt and the batch modes alike
+func (cli *CLI) setup(banner bool) error {
+	if err := cli.manager.DiscoverModules(); err != nil {
+		return err
+	}
+	if banner {
+		cli.PrintBanner()
+	}
+	cli.setupSignalHandler()
+	cli.runRC()
+	return nil
+}
+
+// finishJobs waits for background jobs when there is no prompt to come
+// back to. The exit status stays that of the last statement
+func (cli *CLI) finishJobs() {
+	exit := cli.lastExit
+	cli.waitJobs(cli.jobs.runningJobs())
+	cli.lastExit = exit
+}
+
+// RunSubcommand runs one command line subcommand. A --json argument
+// anywhere after the subcommand has the same effect as SetJSON
+func (cli *CLI) RunSubcommand(name string, args []string) error {
+	if err := cli.setup(false); err != nil {
+		return err
+	}
+
+	var rest []string
+	for _, arg := range args {
+		if arg == "--json" || arg == "-json" {
+			cli.jsonOut = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	args = rest
+
+	switch name {
+	case "run":
+		if len(args) == 0 {
+			cli.usageError("Usage: lanmanvan run <module> [key=value...]")
+			return nil
+		}
+		cli.RunModule(args[0], commandLineWords(args[1:]))
+	case "list":
+		cli.ListModules()
+	case "info":
+		if len(args) != 1 {
+			cli.usageError("Usage: lanmanvan info <module>")
+			return nil
+		}
+		cli.ShowModuleInfo(args[0], 1)
+	case "search":
+		if len(args) == 0 {
+			cli.usageError("Usage: lanmanvan search <keyword>")
+			return nil
+		}
+		cli.SearchModules(strings.Join(args, " "))
+	case "env":
+		cli.EnvCommand(args)
+	case "module":
+		// A source path given on the command line is relative to where
+		// lanmanvan was started, not to the prompt's home directory
+		if wd, err := os.Getwd(); err == nil {
+			CurrentDir = wd
+		}
+		cli.ModuleCommand(args)
+	default:
+		cli.usageError(fmt.Sprintf("Unknown subcommand: %s", name))
+	}
+	return nil
+}
+
+// usageError reports a command used the wrong way, exit status 2
+func (cli *CLI) usageError(msg string) {
+	cli.lastExit = 2
+	if !cli.jsonError(fmt.Errorf("%s", msg)) {
+		core.PrintError(msg)
+	}
+}
+
+// commandLineWords turns arguments already split by the calling shell into
+// words. They are taken literally: the shell has done any quoting and
+// expansion already
+func commandLineWords(args []string) []Word {
+	words := make([]Word, len(args))
+	for i, arg := range args {
+		words[i] = Word{Value: arg, Quoted: true, Pos: i}
+		if key, val, ok := strings.Cut(arg, "="); ok && isValidIdentifier(key) {
+			words[i].Key, words[i].Val = key, val
+		}
+	}
+	return words
+}
+
+// printJSON writes one value as indented JSON
+func (cli *CLI) printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		cli.lastExit = 1
+		fmt.Fprintf(cli.errOut(), "failed to encode JSON: %v\n", err)
+		return
+	}
+	fmt.Fprintln(cli.out(), string(data))
+}
+
+// jsonFailure is printed in place of a result when a command fails in
+// JSON mode
+type jsonFailure struct {
+	Error    string   `json:"error"`
+	ExitCode int      `json:"exit_code"`
+	Problems []string `json:"problems,omitempty"` // one per rejected option
+}
+
+// jsonError prints err as a jsonFailure when JSON output was asked for,
+// and reports whether it did. cli.lastExit must already be set
+func (cli *CLI) jsonError(err error) bool {
+	if !cli.jsonOut {
+		return false
+	}
+	failure := jsonFailure{Error: err.Error(), ExitCode: cli.lastExit}
+	if errs, ok := err.(core.ValidationErrors); ok {
+		failure.Error = "invalid arguments"
+		for _, e := range errs {
+			failure.Problems = append(failure.Problems, e.Error())
+		}
+	}
+	cli.printJSON(failure)
+	return true
+}
+
+// moduleJSON is a module as printed by list, search and info
+type moduleJSON struct {
+	Name        string                     `json:"name"`
+	Type        string                     `json:"type"`
+	Description string                     `json:"description,omitempty"`
+	Author      string                     `json:"author,omitempty"`
+	Version     string                     `json:"version,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Path        string                     `json:"path"`
+	Timeout     string                     `json:"timeout,omitempty"`
+	Wrappers    []string                   `json:"wrappers,omitempty"`
+	Options     map[string]core.OptionMeta `json:"options,omitempty"`
+	Required    []string                   `json:"required,omitempty"`
+	AllowEnv    []string                   `json:"allow_env,omitempty"`
+	Passthrough bool                       `json:"passthrough_env,omitempty"`
+}
+
+func newModuleJSON(module *core.ModuleConfig) moduleJSON {
+	m := moduleJSON{Name: module.Name, Type: module.Type, Path: module.Path}
+	if meta := module.Metadata; meta != nil {
+		m.Description = meta.Description
+		m.Author = meta.Author
+		m.Version = meta.Version
+		m.Tags = meta.Tags
+		m.Timeout = meta.Timeout
+		m.Wrappers = meta.Wrappers
+		m.Options = meta.Options
+		m.Required = meta.Required
+		m.AllowEnv = meta.AllowEnv
+		m.Passthrough = meta.Passthrough
+	}
+	return m
+}
+
+// printModulesJSON prints modules as a JSON array, sorted by name
+func (cli *CLI) printModulesJSON(modules []*core.ModuleConfig) {
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+	list := make([]moduleJSON, 0, len(modules))
+	for _, module := range modules {
+		list = append(list, newModuleJSON(module))
+	}
+	cli.printJSON(list)
+}
+
+// runJSON is a module run as printed in JSON mode: the run record with its
+// findings as flat objects and the artifacts it saved in place of the raw
+// events
+type runJSON struct {
+	*RunRecord
+	Events     []core.Event      `json:"events,omitempty"` // hides RunRecord.Events
+	DurationMS int64             `json:"duration_ms"`
+	Findings   []json.RawMessage `json:"findings"`
+	Artifacts  []string          `json:"artifacts,omitempty"`
+}
+
+func newRunJSON(rec *RunRecord) runJSON {
+	report := runJSON{
+		RunRecord:  rec,
+		DurationMS: rec.Ended.Sub(rec.Started).Milliseconds(),
+		Findings:   []json.RawMessage{},
+		Artifacts:  core.Artifacts(rec.Events),
+	}
+	for _, f := range core.Findings(rec.Events) {
+		report.Findings = append(report.Findings, json.RawMessage(f.JSON()))
+	}
+	return report
+}
@@ -33,12 +33,28 @@ func (cli *CLI) PrintHelp() {
 		{"<module>!", "Quick view module options & usage (ex: network!)"},
 		{"run <module> [args...]", "Execute module with arguments (ex: run network ip=192.168.1.1)"},
 		{"<module> [args...]", "Shorthand run: module arg=value (ex: network ip=192.168.1.1)"},
-		{"env, envs", "Display all global environment variables (alias: envs)"},
+		{"env, envs", "Display all variables and their scope (alias: envs), env get <k> / env set <k> <v>"},
+		{"set|setg [-m <module>] k=v", "Set a session, global or per-module variable (ex: set -m portscan ports=1-100)"},
+		{"unset [-g|-m <module>] <k>", "Remove a variable (ex: unset target)"},
+		{"secret [name[=value]]", "List or set encrypted secrets, masked everywhere (ex: secret pass=hunter2)"},
 		{"key=value", "Set persistent global environment variable (ex: timeout=30)"},
 		{"key=?", "View value of a global variable (ex: timeout=?)"},
-		{"create <name> [python|bash]", "Create new module (ex: create exploit python)"},
+		{"create <name> [python|bash|go]", "Create new module (ex: create exploit python)"},
 		{"edit <module>", "Edit module source code (ex: edit myexploit)"},
 		{"delete, rm <module>", "Delete a module (ex: delete myexploit)"},
+		{"module install <source> [-f]", "Install modules from a repo name, git URL, directory or tarball (ex: module install basic81)"},
+		{"module update|remove|list", "Update or remove installed modules, list them with their source and state"},
+		{"#def name |p:must,q=1| -> cmd", "Define a persistent macro (ex: #def scan |target:must| -> nmap $target)"},
+		{"#name [args...]", "Call a macro: positional, name=value or #name(args) (ex: #scan 10.0.0.1)"},
+		{"macros [show|undef <name>]", "List, show or remove macros (ex: macros show scan)"},
+		{"wrap [add|remove <w>|clear]", "Session execution wrappers for modules (ex: wrap add proxychains)"},
+		{"#sudo <command>", "Run one command under a wrapper: #sudo, #proxychains, #torsocks, #nice"},
+		{"runs [module] [status=|grep=|limit=]", "List past module runs (ex: runs portscan status=failed)"},
+		{"runs show <id> / rerun <id>", "Replay a run's output, or run it again with the same arguments"},
+		{"workspace [create|use|delete <n>]", "List, create, switch or delete workspaces (ex: workspace use acme)"},
+		{"source <file.lmv>", "Run a script in this session (alias: .) (ex: source recon.lmv)"},
+		{"jobs", "List background jobs started with a trailing &"},
+		{"fg|wait|kill|output <id>", "Follow, wait for, stop or show the output of a job"},
 		{"history", "Show command history"},
 		{"clear, cls", "Clear the terminal screen (alias: cls)"},
 		{"refresh, reload", "Reload/refresh all modules from disk"},
@@ -68,7 +84,17 @@ func (cli *CLI) PrintHelp() {
 		{"Combined Usage", "Mix variables and builtins: run module path=$workdir sig=$(sha256 $password)."},
 		{"Save Output", "Save module execution to log file: module_name arg=value save=1 ."},
 		{"Threaded Execution", "Run module with multiple threads: module_name arg=value threads=5 ."},
-		{"Log Location", "Output files saved to ./logs/ with timestamp: module_2006-01-02_15-04-05.log ."},
+		{"Timeouts", "Stop a module after a while: module_name timeout=90s, or globally: timeout=5m ."},
+		{"Pipes", "Chain stages with |>: whois domain=x.com |> hashgen |> \"\\n\" (input arrives as ARG_INPUT and on stdin)."},
+		{"Shell In Pipes", "Use $ stages to filter: portscan host=$h |> $ grep open |> notify ."},
+		{"Redirection", "Save output: portscan host=$h > scan.txt, >> appends, 2> stderr, &> both."},
+		{"Capture", "Keep a command's output in a variable: banner := $ curl -sI $url , then $banner; $? is the last exit code."},
+		{"Scripts", ".lmv files: # comments, \\ continuation, set -e, if <cond> / elif / else / end (ex: if $? == 0)."},
+		{"Structured Output", "Modules may print @@lmv {\"type\":\"finding\",...} lines, shown as tables and piped as JSON lines."},
+		{"Module SDK", "Modules can `import lmv` (Python) or source $LMV_SDK/lmv.sh (Bash) for typed options, findings and artifacts."},
+		{"Background Jobs", "End any command with & to run it as a job: portscan host=$h & , then jobs / fg 1."},
+		{"Parallel Loops", "for ip in 10.0.0.1..254 &16 -> ping host=$ip (or parallel=16, order=completed, failfast=true)."},
+		{"Log Location", "Output files saved to ./logs/ (a workspace's logs/) with timestamp: module_2006-01-02_15-04-05.log ."},
 	}
 
 	for _, feat := range advancedFeatures {
@@ -168,6 +194,10 @@ func (cli *CLI) formatModuleLine(module *core.ModuleConfig, index int, total int
 // ListModules displays all available modules
 func (cli *CLI) ListModules() {
 	modules := cli.manager.ListModules()
+	if cli.jsonOut {
+		cli.printModulesJSON(modules)
+		return
+	}
 	if len(modules) == 0 {
 		core.PrintWarning("No modules loaded. Check the modules directory or specify it with: lanmanvan -modules <path>")
 		fmt.Println()
@@ -193,6 +223,43 @@ func (cli *CLI) ListModules() {
 
 // SearchModules searches modules by keyword with highlighting
 func (cli *CLI) SearchModules(keyword string) {
+	results := cli.findModules(keyword)
+	keyword = strings.ToLower(keyword)
+
+	if cli.jsonOut {
+		if len(results) == 0 {
+			cli.lastExit = 1
+		}
+		cli.printModulesJSON(results)
+		return
+	}
+
+	if len(results) == 0 {
+		cli.lastExit = 1
+		core.PrintWarning(fmt.Sprintf("No modules found for '%s', skipping...", keyword))
+		return
+	}
+
+	// Sort results alphabetically by module name
+	sort.Slice(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("SEARCH: %s (%d results)", keyword, len(results))))
+
+	for i, module := range results {
+		fmt.Println(cli.formatModuleLineWithHighlight(module, i, len(results), keyword))
+	}
+
+	fmt.Println()
+	core.PrintSuccess(fmt.Sprintf("Found %d module(s)", len(results)))
+	fmt.Println()
+}
+
+// findModules returns the modules whose name, description or tags contain
+// keyword, ignoring case
+func (cli *CLI) findModules(keyword string) []*core.ModuleConfig {
 	modules := cli.manager.ListModules()
 	keyword = strings.ToLower(keyword)
 
@@ -220,27 +287,7 @@ func (cli *CLI) SearchModules(keyword string) {
 			}
 		}
 	}
-
-	if len(results) == 0 {
-		core.PrintWarning(fmt.Sprintf("No modules found for '%s', skipping...", keyword))
-		return
-	}
-
-	// Sort results alphabetically by module name
-	sort.Slice(results, func(i, j int) bool {
-		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
-	})
-
-	fmt.Println()
-	fmt.Println(core.NmapBox(fmt.Sprintf("SEARCH: %s (%d results)", keyword, len(results))))
-
-	for i, module := range results {
-		fmt.Println(cli.formatModuleLineWithHighlight(module, i, len(results), keyword))
-	}
-
-	fmt.Println()
-	core.PrintSuccess(fmt.Sprintf("Found %d module(s)", len(results)))
-	fmt.Println()
+	return results
 }
 
 // formatModuleLineWithHighlight formats a module line with keyword highlighting
@@ -308,7 +355,15 @@ func (cli *CLI) highlightKeyword(text, keyword string) string {
 func (cli *CLI) ShowModuleInfo(moduleName string, showREADME int) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("Error: %v, skipping...", err))
+		cli.lastExit = 1
+		if !cli.jsonError(err) {
+			core.PrintError(fmt.Sprintf("Error: %v, skipping...", err))
+		}
+		return
+	}
+
+	if cli.jsonOut {
+		cli.printJSON(newModuleJSON(module))
 		return
 	}
 
@@ -326,6 +381,20 @@ func (cli *CLI) ShowModuleInfo(moduleName string, showREADME int) {
 			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Tags:"), color.CyanString(strings.Join(meta.Tags, ", ")))
 		}
 
+		if len(meta.Wrappers) > 0 {
+			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Runs under:"), color.YellowString(strings.Join(meta.Wrappers, " → ")))
+		}
+
+		if meta.Timeout != "" {
+			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Timeout:"), color.YellowString(meta.Timeout))
+		}
+
+		if meta.Passthrough {
+			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Variables:"), color.YellowString("all passed (passthrough_env)"))
+		} else if len(meta.AllowEnv) > 0 {
+			fmt.Printf("   ├─ %s %s\n", color.WhiteString("Variables:"), color.YellowString(strings.Join(meta.AllowEnv, ", ")))
+		}
+
 		// Display GitHub and X URLs
 		if meta.GitHubURL != "" || meta.XUrl != "" {
 			if meta.GitHubURL != "" {
@@ -517,14 +586,9 @@ func HighlightPurple(text string, keyword string) string {
 
 // getTypeBadge returns a colored badge for module type
 func (cli *CLI) getTypeBadge(moduleType string) string {
-	switch moduleType {
-	case "python":
-		return color.BlueString("[PY]")
-	case "bash":
-		return color.CyanString("[SH]")
-	case "go":
-		return color.MagentaString("[GO]")
-	default:
-		return color.WhiteString("[??]")
+	if rt, ok := core.LookupRuntime(moduleType); ok {
+		label, colorName := rt.Badge()
+		return core.Color(colorName, "["+label+"]")
 	}
+	return color.WhiteString("[??]")
 }
@@ -2,29 +2,28 @@ package cli
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-
-	"lanmanvan/core"
+	"sync"
 )
 
-// EnvironmentManager handles global environment variables
+// EnvironmentManager keeps saved variables in a JSON file, the global ones
+// or a workspace's. It is shared by parallel loop iterations and jobs
 type EnvironmentManager struct {
+	mu       sync.RWMutex
 	vars     map[string]string
 	filePath string
 }
 
-// NewEnvironmentManager creates a new environment manager
-func NewEnvironmentManager() *EnvironmentManager {
-	homeDir, _ := os.UserHomeDir()
-	configDir := filepath.Join(homeDir, ".lanmanvan")
-	os.MkdirAll(configDir, 0700)
+// NewEnvironmentManager creates an environment manager kept in filePath,
+// a workspace's env.json
+func NewEnvironmentManager(filePath string) *EnvironmentManager {
+	os.MkdirAll(filepath.Dir(filePath), 0700)
 
 	em := &EnvironmentManager{
 		vars:     make(map[string]string),
-		filePath: filepath.Join(configDir, "env.json"),
+		filePath: filePath,
 	}
 
 	em.Load()
@@ -33,29 +32,43 @@ func NewEnvironmentManager() *EnvironmentManager {
 
 // Set sets a global environment variable
 func (em *EnvironmentManager) Set(key, value string) error {
+	em.mu.Lock()
+	defer em.mu.Unlock()
 	em.vars[key] = value
-	return em.Save()
+	return em.save()
 }
 
 // Get retrieves a global environment variable
 func (em *EnvironmentManager) Get(key string) (string, bool) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
 	val, exists := em.vars[key]
 	return val, exists
 }
 
-// GetAll returns all environment variables
+// GetAll returns a copy of all environment variables
 func (em *EnvironmentManager) GetAll() map[string]string {
-	return em.vars
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return copyVars(em.vars)
 }
 
 // Delete removes an environment variable
 func (em *EnvironmentManager) Delete(key string) error {
+	em.mu.Lock()
+	defer em.mu.Unlock()
 	delete(em.vars, key)
-	return em.Save()
+	return em.save()
 }
 
 // Save persists environment variables to JSON file
 func (em *EnvironmentManager) Save() error {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return em.save()
+}
+
+func (em *EnvironmentManager) save() error {
 	data, err := json.MarshalIndent(em.vars, "", "  ")
 	if err != nil {
 		return err
@@ -66,6 +79,8 @@ func (em *EnvironmentManager) Save() error {
 
 // Load reads environment variables from JSON file
 func (em *EnvironmentManager) Load() error {
+	em.mu.Lock()
+	defer em.mu.Unlock()
 	data, err := ioutil.ReadFile(em.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -79,29 +94,8 @@ func (em *EnvironmentManager) Load() error {
 
 // Clear removes all environment variables
 func (em *EnvironmentManager) Clear() error {
+	em.mu.Lock()
+	defer em.mu.Unlock()
 	em.vars = make(map[string]string)
-	return em.Save()
-}
-
-// Display shows all environment variables
-func (em *EnvironmentManager) Display() {
-	if len(em.vars) == 0 {
-		core.PrintWarning("No global environment variables set, use '<key> = <value>' to add some, or type '<key>=?' to view its value")
-		fmt.Println()
-		return
-	}
-
-	fmt.Println()
-	fmt.Println(core.NmapBox("GLOBAL ENVIRONMENT VARIABLES"))
-
-	i := 0
-	for key, value := range em.vars {
-		i++
-		prefix := "   ├─ "
-		if i == len(em.vars) {
-			prefix = "   └─ "
-		}
-		fmt.Printf("%s%s = %s\n", prefix, core.Color("cyan", key), core.Color("green", value))
-	}
-	fmt.Println()
+	return em.save()
 }
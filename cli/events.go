@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"lanmanvan/core"
+)
+
+// eventRenderer shows a module's structured events as they arrive: a
+// progress bar redrawn in place, log lines and saved artifacts. Findings
+// are kept for the table printed when the module ends
+type eventRenderer struct {
+	mu       sync.Mutex
+	module   string
+	w        io.Writer // plain mode: progress is dropped and logs written here
+	progress bool      // a progress bar is on the current terminal line
+}
+
+// eventRenderer returns the event handler for a module run. Quiet forks
+// get plain log lines on their error output and no progress
+func (cli *CLI) eventRenderer(module string) *eventRenderer {
+	r := &eventRenderer{module: module}
+	if cli.quiet {
+		r.w = cli.errOut()
+	}
+	return r
+}
+
+func (r *eventRenderer) render(ev core.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev.Type {
+	case core.EventProgress:
+		if r.w != nil {
+			return
+		}
+		pct := int(ev.Percent)
+		if pct < 0 {
+			pct = 0
+		} else if pct > 100 {
+			pct = 100
+		}
+		fmt.Printf("\r\033[K   %s %s", core.ProgressBar(pct, 100, 30), ev.Message)
+		r.progress = true
+		if pct == 100 {
+			fmt.Println()
+			r.progress = false
+		}
+
+	case core.EventLog:
+		if r.w != nil {
+			fmt.Fprintf(r.w, "[%s] %s: %s\n", ev.Level, r.module, ev.Message)
+			return
+		}
+		r.endProgress()
+		msg := fmt.Sprintf("%s: %s", core.Color("cyan", r.module), ev.Message)
+		switch strings.ToLower(ev.Level) {
+		case "debug":
+			core.PrintDebug(msg)
+		case "warn", "warning":
+			core.PrintWarning(msg)
+		case "error", "fatal":
+			core.PrintError(msg)
+		default:
+			core.PrintInfo(msg)
+		}
+
+	case core.EventArtifact:
+		path := ev.Field("path")
+		if path == "" {
+			return
+		}
+		if r.w != nil {
+			fmt.Fprintf(r.w, "[artifact] %s: %s\n", r.module, path)
+			return
+		}
+		r.endProgress()
+		core.PrintSuccess(fmt.Sprintf("%s: saved %s", core.Color("cyan", r.module), path))
+	}
+}
+
+// finish ends a progress line left open by the module
+func (r *eventRenderer) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endProgress()
+}
+
+func (r *eventRenderer) endProgress() {
+	if r.progress {
+		fmt.Println()
+		r.progress = false
+	}
+}
+
+// printFindings shows a run's findings: as a table on the terminal, or
+// one JSON object per line when the output is redirected. output is what
+// the module printed before, so the findings start on a line of their own
+func (cli *CLI) printFindings(findings []core.Event, output string) {
+	if len(findings) == 0 {
+		return
+	}
+	newline := ""
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		newline = "\n"
+	}
+	if cli.redirected() {
+		fmt.Fprint(cli.out(), newline+findingsJSONL(findings))
+		return
+	}
+
+	fmt.Println(newline)
+	fmt.Println(core.NmapBox(fmt.Sprintf("Findings (%d)", len(findings))))
+	fmt.Println(findingsTable(findings))
+}
+
+// findingsTable lays findings out with one column per field, in the order
+// the fields were first seen
+func findingsTable(findings []core.Event) string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		for _, key := range f.Keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		columns = []string{"finding"}
+	}
+
+	table := core.NewTable(columns)
+	for _, f := range findings {
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			row[i] = f.Field(col)
+		}
+		table.AddRow(row...)
+	}
+	return table.Render()
+}
+
+// findingsJSONL is the form findings take down a pipe: one object per line
+func findingsJSONL(findings []core.Event) string {
+	var b strings.Builder
+	for _, f := range findings {
+		b.WriteString(f.JSON())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// parseFindings reads findings back from piped JSON lines
+func parseFindings(text string) []core.Event {
+	var findings []core.Event
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if ev, ok := core.ParseEvent([]byte(line), core.EventFinding); ok && ev.Type == core.EventFinding {
+			findings = append(findings, ev)
+		}
+	}
+	return findings
+}
+
+// structuredInputEnv tells a module its piped input is JSON lines
+const structuredInputEnv = "LMV_INPUT_FORMAT=jsonl"
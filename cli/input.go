@@ -2,29 +2,18 @@ package cli
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/chzyer/readline"
 )
 
-// getHistoryPath returns the persistent history file path
-func getHistoryPath() string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "/tmp/lanmanvan_history"
-	}
-	configDir := filepath.Join(homeDir, ".lanmanvan")
-	os.MkdirAll(configDir, 0700)
-	return filepath.Join(configDir, "history")
-}
-
 // getReadlineInstance creates a readline instance with history support and copy-paste enabled
 func (cli *CLI) getReadlineInstance() (*readline.Instance, error) {
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:         "",
-		HistoryFile:    getHistoryPath(),
+		HistoryFile:    cli.workspace.historyFile(),
 		FuncIsTerminal: func() bool { return true }, // Treat as terminal for paste support
+		// Start saves lines itself, with secrets masked
+		DisableAutoSaveHistory: true,
 	})
 
 	if err != nil {
@@ -0,0 +1,977 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// Iterator represents something that can produce values one by one
+type Iterator interface {
+	Next() (string, bool) // value, ok
+	Len() int             // total expected items (for progress), or unknownLen
+	Close() error         // optional cleanup
+}
+
+// unknownLen is the length of a source that cannot tell in advance, such as
+// a module that is still printing
+const unknownLen = -1
+
+// failingIterator is a source that can fail while it is read. Err is
+// checked once the loop is over
+type failingIterator interface {
+	Iterator
+	Err() error
+}
+
+// iteratorErr returns the error a source failed with, if it can fail
+func iteratorErr(it Iterator) error {
+	if f, ok := it.(failingIterator); ok {
+		return f.Err()
+	}
+	return nil
+}
+
+// cancelable is a source that can be stopped while another goroutine waits
+// in its Next, such as a module that is still running
+type cancelable interface {
+	cancel()
+}
+
+// cancelIterator stops a source early if it can be stopped
+func cancelIterator(it Iterator) {
+	if c, ok := it.(cancelable); ok {
+		c.cancel()
+	}
+}
+
+// parseRangeSource returns an iterator for different kinds of ranges:
+//
+//	admin|root|guest          list
+//	a..z+A..Z+0..9            chained ranges
+//	1..100  0..100:5  10..1   numeric, with optional step, descending
+//	192.168.1.1..192.168.1.50 IPv4 range, also 192.168.1.1..50 and 10.0.0.1..1.254
+//	fe80::1..fe80::ff         IPv6 range
+//	10.0.0.0/24               CIDR
+//	10.0.1-3.1-254            nmap-style octet ranges, also 10.0.0.1,5,9
+//	@targets.txt              lines of a file
+//	<(module args...)         lines of a module's output
+func (cli *CLI) parseRangeSource(s string) (Iterator, error) {
+	s = strings.TrimSpace(s)
+
+	// Module output may itself contain | and +
+	if strings.HasPrefix(s, "<(") {
+		return cli.parseSingleRange(s)
+	}
+
+	// 1. List style: item1|item2|item3
+	if strings.Contains(s, "|") {
+		items := strings.Split(s, "|")
+		cleanItems := make([]string, 0, len(items))
+		for _, item := range items {
+			trimmed := strings.TrimSpace(item)
+			if trimmed != "" {
+				cleanItems = append(cleanItems, trimmed)
+			}
+		}
+		return &listIterator{items: cleanItems}, nil
+	}
+
+	// 2. Multiple ranges with + : a..z+A..Z+0..9
+	if strings.Contains(s, "+") {
+		parts := strings.Split(s, "+")
+		iterators := make([]Iterator, 0, len(parts))
+		for _, part := range parts {
+			it, err := cli.parseSingleRange(strings.TrimSpace(part))
+			if err != nil {
+				for _, opened := range iterators {
+					_ = opened.Close()
+				}
+				return nil, fmt.Errorf("invalid part %q: %v", part, err)
+			}
+			iterators = append(iterators, it)
+		}
+		return newChainIterator(iterators...), nil
+	}
+
+	// 3. Single range
+	return cli.parseSingleRange(s)
+}
+
+// nmapOctetsRegex matches four dotted octet specs where each octet may be
+// a number, a-b, or a comma separated mix of both
+var nmapOctetsRegex = regexp.MustCompile(`^[\d,\-]+\.[\d,\-]+\.[\d,\-]+\.[\d,\-]+$`)
+
+func (cli *CLI) parseSingleRange(s string) (Iterator, error) {
+	switch {
+	case strings.HasPrefix(s, "@"):
+		return newFileLinesIterator(s[1:])
+
+	case strings.HasPrefix(s, "<(") && strings.HasSuffix(s, ")"):
+		return cli.newModuleOutputIterator(s[2 : len(s)-1])
+
+	case strings.Contains(s, "/"):
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %v", err)
+		}
+		return newCIDRIterator(network), nil
+
+	case nmapOctetsRegex.MatchString(s):
+		return newOctetIterator(s)
+	}
+
+	if strings.Contains(s, "..") {
+		parts := strings.SplitN(s, "..", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid .. range format")
+		}
+		startStr, endStr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		// Try IP range first
+		if startIP := net.ParseIP(startStr); startIP != nil {
+			if endIP := net.ParseIP(endStr); endIP != nil {
+				return newIPRangeIterator(startIP, endIP)
+			}
+			// Trailing octets only: 192.168.1.1..50, 10.0.0.1..1.254
+			endIP, err := partialIPEnd(startIP, endStr)
+			if err != nil {
+				return nil, err
+			}
+			return newIPRangeIterator(startIP, endIP)
+		}
+
+		// Numeric range with an optional step: 0..100:5
+		step := 1
+		if rangeEnd, stepStr, found := strings.Cut(endStr, ":"); found {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step %q, expected a positive number", stepStr)
+			}
+			endStr, step = rangeEnd, n
+		}
+		start, err1 := strconv.Atoi(startStr)
+		end, err2 := strconv.Atoi(endStr)
+		if err1 == nil && err2 == nil {
+			return newNumericRangeIterator(start, end, step), nil
+		}
+
+		// Character range
+		if len(startStr) == 1 && len(endStr) == 1 && step == 1 {
+			return newCharRangeIterator(startStr[0], endStr[0]), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported range format: %s", s)
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Chain Iterator (for a..z + 0..9 + !@# style)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type chainIterator struct {
+	iterators []Iterator
+	current   int
+}
+
+func newChainIterator(iters ...Iterator) Iterator {
+	return &chainIterator{
+		iterators: iters,
+		current:   0,
+	}
+}
+
+func (it *chainIterator) Next() (string, bool) {
+	for it.current < len(it.iterators) {
+		val, ok := it.iterators[it.current].Next()
+		if ok {
+			return val, true
+		}
+		it.current++
+	}
+	return "", false
+}
+
+func (it *chainIterator) Len() int {
+	total := 0
+	for _, i := range it.iterators {
+		total = addLen(total, i.Len())
+	}
+	return total
+}
+
+func (it *chainIterator) Close() error {
+	for _, i := range it.iterators {
+		_ = i.Close() // best effort
+	}
+	return nil
+}
+
+// addLen adds iterator lengths, saturating at math.MaxInt
+func addLen(a, b int) int {
+	if a == unknownLen || b == unknownLen {
+		return unknownLen
+	}
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// IP Range Iterator (IPv4 or IPv6: 192.168.1.1 .. 192.168.1.50, fe80::1 .. fe80::ff)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type ipRangeIterator struct {
+	curr net.IP
+	end  net.IP
+	done bool
+	left *big.Int // remaining addresses, for Len
+}
+
+func newIPRangeIterator(start, end net.IP) (Iterator, error) {
+	// Compare addresses of the same family and length
+	if s4, e4 := start.To4(), end.To4(); s4 != nil && e4 != nil {
+		start, end = s4, e4
+	} else if s4 != nil || e4 != nil {
+		return nil, fmt.Errorf("cannot mix IPv4 and IPv6 in a range: %s..%s", start, end)
+	} else {
+		start, end = start.To16(), end.To16()
+	}
+
+	// Make copies because net.IP is slice
+	curr := make(net.IP, len(start))
+	copy(curr, start)
+
+	left := new(big.Int).Sub(ipToBig(end), ipToBig(start))
+	left.Add(left, big.NewInt(1))
+
+	return &ipRangeIterator{
+		curr: curr,
+		end:  end,
+		done: bytes.Compare(start, end) > 0,
+		left: left,
+	}, nil
+}
+
+func (it *ipRangeIterator) Next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+
+	result := it.curr.String()
+	if bytes.Equal(it.curr, it.end) {
+		it.done = true
+	}
+	it.left.Sub(it.left, big.NewInt(1))
+
+	// Increment IP
+	for i := len(it.curr) - 1; i >= 0; i-- {
+		it.curr[i]++
+		if it.curr[i] > 0 {
+			break
+		}
+		// carry over
+	}
+
+	return result, true
+}
+
+func (it *ipRangeIterator) Len() int {
+	if it.done || it.left.Sign() <= 0 {
+		return 0
+	}
+	// An IPv6 /64 does not fit in an int; saturate for progress display
+	if !it.left.IsInt64() || it.left.Int64() > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(it.left.Int64())
+}
+
+func (it *ipRangeIterator) Close() error { return nil }
+
+// ipToBig converts an IPv4 or IPv6 address to an integer
+func ipToBig(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return new(big.Int).SetBytes(ip)
+}
+
+// newCIDRIterator walks every address of a network, including the network
+// and broadcast addresses, like nmap does
+func newCIDRIterator(network *net.IPNet) Iterator {
+	start := network.IP
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^network.Mask[i]
+	}
+	it, _ := newIPRangeIterator(start, end) // same family by construction
+	return it
+}
+
+// partialIPEnd completes a range end given as trailing octets of the start:
+// 192.168.1.1..50 ends at 192.168.1.50, 10.0.0.1..1.254 at 10.0.1.254
+func partialIPEnd(start net.IP, endStr string) (net.IP, error) {
+	start4 := start.To4()
+	if start4 == nil {
+		return nil, fmt.Errorf("invalid IPv6 range end %q, give the full address", endStr)
+	}
+
+	octets := strings.Split(endStr, ".")
+	if len(octets) > 3 {
+		return nil, fmt.Errorf("invalid range end %q", endStr)
+	}
+
+	end := make(net.IP, 4)
+	copy(end, start4)
+	offset := 4 - len(octets)
+	for i, octet := range octets {
+		n, err := strconv.Atoi(octet)
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("invalid octet %q in range end %q", octet, endStr)
+		}
+		end[offset+i] = byte(n)
+	}
+	return end, nil
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Octet Iterator (nmap style)   10.0.1-3.1-254   or   10.0.0.1,5,10-12
+// ────────────────────────────────────────────────────────────────────────────────
+
+type octetIterator struct {
+	octets [4][]int // allowed values per octet, at most 256 each
+	idx    [4]int
+	done   bool
+	count  int // addresses already produced
+}
+
+func newOctetIterator(spec string) (Iterator, error) {
+	parts := strings.Split(spec, ".")
+	it := &octetIterator{}
+	for i, part := range parts {
+		values, err := parseOctetSpec(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid octet %q in %s: %v", part, spec, err)
+		}
+		it.octets[i] = values
+	}
+	return it, nil
+}
+
+// parseOctetSpec expands "1-3,7,10-12" into its values
+func parseOctetSpec(spec string) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(spec, ",") {
+		lo, hi, isRange := strings.Cut(item, "-")
+		if !isRange {
+			hi = lo
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || start < 0 || end > 255 || start > end {
+			return nil, fmt.Errorf("expected numbers 0-255 in ascending ranges")
+		}
+		for n := start; n <= end; n++ {
+			values = append(values, n)
+		}
+	}
+	return values, nil
+}
+
+func (it *octetIterator) Next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+
+	ip := fmt.Sprintf("%d.%d.%d.%d",
+		it.octets[0][it.idx[0]], it.octets[1][it.idx[1]],
+		it.octets[2][it.idx[2]], it.octets[3][it.idx[3]])
+	it.count++
+
+	// Odometer: advance the last octet, carrying to the left
+	for i := 3; i >= 0; i-- {
+		it.idx[i]++
+		if it.idx[i] < len(it.octets[i]) {
+			return ip, true
+		}
+		it.idx[i] = 0
+	}
+	it.done = true
+	return ip, true
+}
+
+func (it *octetIterator) Len() int {
+	total := 1
+	for _, values := range it.octets {
+		total *= len(values)
+	}
+	return total - it.count
+}
+
+func (it *octetIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// File Lines Iterator   @targets.txt   (blank lines and # comments are skipped)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type fileLinesIterator struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	left    int
+}
+
+func newFileLinesIterator(path string) (Iterator, error) {
+	path = redirectPath(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count once so progress is known, then read again from the start;
+	// only one line is held in memory at a time
+	left := 0
+	counter := bufio.NewScanner(file)
+	for counter.Scan() {
+		if isTargetLine(counter.Text()) {
+			left++
+		}
+	}
+	if err := counter.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileLinesIterator{file: file, scanner: bufio.NewScanner(file), left: left}, nil
+}
+
+// isTargetLine reports whether a line of a targets file holds a value
+func isTargetLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && !strings.HasPrefix(line, "#")
+}
+
+func (it *fileLinesIterator) Next() (string, bool) {
+	for it.scanner.Scan() {
+		line := it.scanner.Text()
+		if isTargetLine(line) {
+			it.left--
+			return strings.TrimSpace(line), true
+		}
+	}
+	return "", false
+}
+
+func (it *fileLinesIterator) Len() int { return it.left }
+
+func (it *fileLinesIterator) Close() error { return it.file.Close() }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Module Output Iterator   <(subdomains domain=example.com)
+// ────────────────────────────────────────────────────────────────────────────────
+
+// moduleOutputIterator yields the non-empty lines a module prints, as it
+// prints them. The module runs while the loop does, so its length is unknown
+type moduleOutputIterator struct {
+	cli     *CLI
+	module  string
+	args    map[string]string
+	started time.Time
+
+	lines    *bufio.Scanner
+	output   *io.PipeReader
+	stop     context.CancelFunc
+	stopped  atomic.Bool   // cancelled before the module finished
+	finished chan struct{} // closed once result and err are set
+	result   *core.ExecutionResult
+	err      error
+	closed   bool
+}
+
+// newModuleOutputIterator starts a module and iterates over the lines of
+// its output while it runs
+func (cli *CLI) newModuleOutputIterator(command string) (Iterator, error) {
+	words, err := lexWords(command, cli.lookupVar, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("missing module name in <(...)")
+	}
+
+	moduleName := words[0].Value
+	module, err := cli.manager.GetModule(moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]string)
+	for key, value := range cli.moduleVars(moduleName) {
+		args[key] = value
+	}
+	explicit := cli.parseArguments(words[1:])
+	cli.warnUnknownArguments(module, explicit)
+	for key, value := range explicit {
+		args[key] = value
+	}
+
+	args, err = cli.manager.PrepareArguments(moduleName, args, CurrentDir)
+	if err != nil {
+		return nil, err
+	}
+
+	base := cli.ctx
+	if base == nil {
+		base = context.Background()
+	}
+	ctx, stop := context.WithCancel(base)
+	pr, pw := io.Pipe()
+
+	lines := bufio.NewScanner(pr)
+	lines.Buffer(nil, core.DefaultCaptureLimit)
+	it := &moduleOutputIterator{
+		cli:      cli,
+		module:   moduleName,
+		args:     args,
+		started:  time.Now(),
+		lines:    lines,
+		output:   pr,
+		stop:     stop,
+		finished: make(chan struct{}),
+	}
+
+	opts := cli.runOptions()
+	opts.Stdout = pw
+	opts.Stderr = cli.errOut()
+	opts.Context = ctx
+	go func() {
+		it.result, it.err = cli.manager.ExecuteModuleWith(moduleName, args, opts)
+		if it.err == nil && it.result.Interrupted {
+			it.err = fmt.Errorf("module '%s' was %w", moduleName, errInterrupted)
+		} else if it.err == nil && !it.result.Success {
+			it.err = fmt.Errorf("module '%s' failed [exit: %d]", moduleName, it.result.ExitCode)
+		}
+		// Finished before the end of output, so Err is settled by then
+		close(it.finished)
+		pw.Close()
+	}()
+	return it, nil
+}
+
+func (it *moduleOutputIterator) Next() (string, bool) {
+	for it.lines.Scan() {
+		if line := strings.TrimSpace(it.lines.Text()); line != "" {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+func (it *moduleOutputIterator) Len() int { return unknownLen }
+
+// cancel stops the module while the loop may still be waiting in Next
+func (it *moduleOutputIterator) cancel() {
+	it.stopped.Store(true)
+	it.stop()
+}
+
+// Err reports how the module failed once it has finished; a module the
+// loop stopped early has not failed
+func (it *moduleOutputIterator) Err() error {
+	select {
+	case <-it.finished:
+		if it.stopped.Load() {
+			return nil
+		}
+		return it.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the module if it is still running and records the run
+func (it *moduleOutputIterator) Close() error {
+	if it.closed {
+		return nil
+	}
+	it.closed = true
+	it.stop()
+	it.output.Close()
+	<-it.finished
+	it.cli.recordRun(it.module, it.args, 1, 0, it.started, it.result)
+	return nil
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Character Range Iterator   a..z    or   0..9
+// ────────────────────────────────────────────────────────────────────────────────
+
+type charRangeIterator struct {
+	current byte
+	end     byte
+}
+
+func newCharRangeIterator(start, end byte) Iterator {
+	return &charRangeIterator{
+		current: start,
+		end:     end,
+	}
+}
+
+func (it *charRangeIterator) Next() (string, bool) {
+	if it.current > it.end {
+		return "", false
+	}
+	val := string(it.current)
+	it.current++
+	return val, true
+}
+
+func (it *charRangeIterator) Len() int {
+	if it.current > it.end {
+		return 0
+	}
+	return int(it.end-it.current) + 1
+}
+
+func (it *charRangeIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Simple iterators
+// ────────────────────────────────────────────────────────────────────────────────
+
+type listIterator struct {
+	items []string
+	idx   int
+}
+
+func (it *listIterator) Next() (string, bool) {
+	if it.idx >= len(it.items) {
+		return "", false
+	}
+	v := it.items[it.idx]
+	it.idx++
+	return v, true
+}
+func (it *listIterator) Len() int     { return len(it.items) - it.idx }
+func (it *listIterator) Close() error { return nil }
+
+// numericRangeIterator counts from start to end by step, downwards when end < start
+type numericRangeIterator struct {
+	current, step int
+	left          int
+}
+
+func newNumericRangeIterator(start, end, step int) *numericRangeIterator {
+	if end < start {
+		return &numericRangeIterator{current: start, step: -step, left: (start-end)/step + 1}
+	}
+	return &numericRangeIterator{current: start, step: step, left: (end-start)/step + 1}
+}
+func (it *numericRangeIterator) Next() (string, bool) {
+	if it.left <= 0 {
+		return "", false
+	}
+	v := strconv.Itoa(it.current)
+	it.current += it.step
+	it.left--
+	return v, true
+}
+func (it *numericRangeIterator) Len() int     { return it.left }
+func (it *numericRangeIterator) Close() error { return nil }
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Product / Zip Iterators (multi-variable loops)
+// ────────────────────────────────────────────────────────────────────────────────
+
+// tupleIterator yields one value per loop variable. Next returns the values
+// joined with ", " for display; Values returns the tuple from the last Next
+type tupleIterator interface {
+	Iterator
+	Values() []string
+}
+
+// iteratorFactory opens a fresh iterator over the same source
+type iteratorFactory func() (Iterator, error)
+
+// productIterator is the cartesian product of its sources, the last source
+// varying fastest like nested loops. Only the first source is read once;
+// the others are reopened for every value of the source before them
+type productIterator struct {
+	factories []iteratorFactory
+	iters     []Iterator
+	values    []string
+	total     int
+	started   bool
+	done      bool
+}
+
+func newProductIterator(factories ...iteratorFactory) (tupleIterator, error) {
+	it := &productIterator{
+		factories: factories,
+		iters:     make([]Iterator, len(factories)),
+		values:    make([]string, len(factories)),
+		total:     1,
+	}
+	for i, factory := range factories {
+		iter, err := factory()
+		if err != nil {
+			it.Close()
+			return nil, err
+		}
+		it.iters[i] = iter
+		it.total = mulLen(it.total, iter.Len())
+	}
+	return it, nil
+}
+
+func (it *productIterator) Next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+
+	if !it.started {
+		it.started = true
+		for i, iter := range it.iters {
+			value, ok := iter.Next()
+			if !ok {
+				it.done = true
+				return "", false
+			}
+			it.values[i] = value
+		}
+		it.countDown()
+		return strings.Join(it.values, ", "), true
+	}
+
+	// Advance the rightmost source; when it runs out, advance the one to its
+	// left and reopen it and everything after
+	for i := len(it.iters) - 1; i >= 0; i-- {
+		if value, ok := it.iters[i].Next(); ok {
+			it.values[i] = value
+			if err := it.restartFrom(i + 1); err != nil {
+				break
+			}
+			it.countDown()
+			return strings.Join(it.values, ", "), true
+		}
+	}
+	it.done = true
+	return "", false
+}
+
+func (it *productIterator) countDown() {
+	if it.total != unknownLen {
+		it.total--
+	}
+}
+
+// restartFrom reopens the sources from index i on and reads their first values
+func (it *productIterator) restartFrom(i int) error {
+	for ; i < len(it.iters); i++ {
+		_ = it.iters[i].Close()
+		iter, err := it.factories[i]()
+		if err != nil {
+			it.iters[i] = &listIterator{}
+			return err
+		}
+		it.iters[i] = iter
+		value, ok := iter.Next()
+		if !ok {
+			return fmt.Errorf("source became empty")
+		}
+		it.values[i] = value
+	}
+	return nil
+}
+
+func (it *productIterator) Values() []string {
+	return append([]string(nil), it.values...)
+}
+
+func (it *productIterator) Len() int {
+	if it.done {
+		return 0
+	}
+	return it.total
+}
+
+// Err and cancel only look at the first source: it is the only one never
+// reopened, the others are read whole before the loop starts
+func (it *productIterator) Err() error { return iteratorErr(it.iters[0]) }
+
+func (it *productIterator) cancel() { cancelIterator(it.iters[0]) }
+
+func (it *productIterator) Close() error {
+	for _, iter := range it.iters {
+		if iter != nil {
+			_ = iter.Close()
+		}
+	}
+	return nil
+}
+
+// mulLen multiplies iterator lengths, saturating at math.MaxInt
+func mulLen(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a == unknownLen || b == unknownLen {
+		return unknownLen
+	}
+	if a > math.MaxInt/b {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// zipIterator pairs its sources value by value and stops with the shortest
+type zipIterator struct {
+	iters  []Iterator
+	values []string
+	done   bool
+}
+
+func newZipIterator(iters ...Iterator) tupleIterator {
+	return &zipIterator{iters: iters, values: make([]string, len(iters))}
+}
+
+func (it *zipIterator) Next() (string, bool) {
+	if it.done {
+		return "", false
+	}
+	for i, iter := range it.iters {
+		value, ok := iter.Next()
+		if !ok {
+			it.done = true
+			return "", false
+		}
+		it.values[i] = value
+	}
+	return strings.Join(it.values, ", "), true
+}
+
+func (it *zipIterator) Values() []string {
+	return append([]string(nil), it.values...)
+}
+
+func (it *zipIterator) Len() int {
+	if it.done {
+		return 0
+	}
+	shortest := math.MaxInt
+	for _, iter := range it.iters {
+		n := iter.Len()
+		if n == unknownLen {
+			return unknownLen
+		}
+		if n < shortest {
+			shortest = n
+		}
+	}
+	return shortest
+}
+
+func (it *zipIterator) Err() error {
+	for _, iter := range it.iters {
+		if err := iteratorErr(iter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *zipIterator) cancel() {
+	for _, iter := range it.iters {
+		cancelIterator(iter)
+	}
+}
+
+func (it *zipIterator) Close() error {
+	for _, iter := range it.iters {
+		_ = iter.Close()
+	}
+	return nil
+}
+
+// readModuleSource runs a <(module ...) source to the end and returns its lines
+func (cli *CLI) readModuleSource(source string) ([]string, error) {
+	iter, err := cli.parseRangeSource(source)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var items []string
+	for value, ok := iter.Next(); ok; value, ok = iter.Next() {
+		items = append(items, value)
+	}
+	if err := iteratorErr(iter); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// parseLoopSources builds the iterator for a loop's variable bindings: the
+// plain source for one variable, otherwise their product or zip
+func (cli *CLI) parseLoopSources(vars []ForVar, zip bool) (Iterator, error) {
+	if len(vars) == 1 {
+		return cli.parseRangeSource(vars[0].Source)
+	}
+
+	factories := make([]iteratorFactory, len(vars))
+	for i, v := range vars {
+		source := v.Source
+		factories[i] = func() (Iterator, error) {
+			return cli.parseRangeSource(source)
+		}
+
+		// Every source but the first is reopened for each value of the one
+		// before it, so module output is produced once and replayed
+		if i > 0 && !zip && strings.HasPrefix(strings.TrimSpace(source), "<(") {
+			items, err := cli.readModuleSource(source)
+			if err != nil {
+				return nil, err
+			}
+			factories[i] = func() (Iterator, error) {
+				return &listIterator{items: items}, nil
+			}
+		}
+	}
+
+	if !zip {
+		return newProductIterator(factories...)
+	}
+
+	iters := make([]Iterator, 0, len(factories))
+	for _, factory := range factories {
+		iter, err := factory()
+		if err != nil {
+			for _, opened := range iters {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		iters = append(iters, iter)
+	}
+	return newZipIterator(iters...), nil
+}
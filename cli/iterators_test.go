@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// drain reads every value of an iterator, checking Len along the way
+func drain(t *testing.T, source string, it Iterator) []string {
+	t.Helper()
+	defer it.Close()
+	var values []string
+	for {
+		if left := it.Len(); left < 0 && left != unknownLen {
+			t.Fatalf("%s: Len() = %d", source, left)
+		}
+		value, ok := it.Next()
+		if !ok {
+			break
+		}
+		values = append(values, value)
+		if len(values) > 10000 {
+			t.Fatalf("%s: does not end", source)
+		}
+	}
+	return values
+}
+
+func TestParseRangeSource(t *testing.T) {
+	cli := newTestCLI(t)
+	targets := filepath.Join(t.TempDir(), "targets.txt")
+	os.WriteFile(targets, []byte("10.0.0.1\n\n# comment\n  10.0.0.2  \n"), 0644)
+
+	tests := []struct {
+		source string
+		want   []string
+	}{
+		{"admin|root| |guest", []string{"admin", "root", "guest"}},
+		{"1..5", []string{"1", "2", "3", "4", "5"}},
+		{"0..10:5", []string{"0", "5", "10"}},
+		{"3..1", []string{"3", "2", "1"}},
+		{"10..1:4", []string{"10", "6", "2"}},
+		{"a..c+X..Y+7..8", []string{"a", "b", "c", "X", "Y", "7", "8"}},
+		{"c..a", nil},
+		{"10.0.0.9..10.0.0.1", nil},
+		{"192.168.1.254..192.168.2.1", []string{"192.168.1.254", "192.168.1.255", "192.168.2.0", "192.168.2.1"}},
+		{"192.168.1.1..3", []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"}},
+		{"10.0.0.255..1.0", []string{"10.0.0.255", "10.0.1.0"}},
+		{"fe80::fe..fe80::101", []string{"fe80::fe", "fe80::ff", "fe80::100", "fe80::101"}},
+		{"10.0.0.0/30", []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"2001:db8::/127", []string{"2001:db8::", "2001:db8::1"}},
+		{"10.0.1-2.1,5", []string{"10.0.1.1", "10.0.1.5", "10.0.2.1", "10.0.2.5"}},
+		{"@" + targets, []string{"10.0.0.1", "10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		it, err := cli.parseRangeSource(tt.source)
+		if err != nil {
+			t.Errorf("parseRangeSource(%q): %v", tt.source, err)
+			continue
+		}
+		if n := it.Len(); n != len(tt.want) {
+			t.Errorf("parseRangeSource(%q).Len() = %d, want %d", tt.source, n, len(tt.want))
+		}
+		if got := drain(t, tt.source, it); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRangeSource(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestParseRangeSourceErrors(t *testing.T) {
+	cli := newTestCLI(t)
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"10.0.0.0/33", "invalid CIDR"},
+		{"1..10:0", "invalid step"},
+		{"1..10:x", "invalid step"},
+		{"10.0.0.1..fe80::1", ""},
+		{"10.0.0.300", ""},
+		{"1..xy", "unsupported range format"},
+		{"word", "unsupported range format"},
+		{"1..2+nope", "invalid part"},
+		{"@" + filepath.Join(t.TempDir(), "missing.txt"), ""},
+	}
+	for _, tt := range tests {
+		it, err := cli.parseRangeSource(tt.source)
+		if err == nil {
+			it.Close()
+			t.Errorf("parseRangeSource(%q) succeeded", tt.source)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseRangeSource(%q) = %v, want %q", tt.source, err, tt.err)
+		}
+	}
+}
+
+func TestRangeLenSaturates(t *testing.T) {
+	cli := newTestCLI(t)
+	for _, source := range []string{"::/0", "::/0+1..2", "2001:db8::/64"} {
+		it, err := cli.parseRangeSource(source)
+		if err != nil {
+			t.Fatalf("parseRangeSource(%q): %v", source, err)
+		}
+		if n := it.Len(); n != math.MaxInt {
+			t.Errorf("parseRangeSource(%q).Len() = %d, want math.MaxInt", source, n)
+		}
+		if value, ok := it.Next(); !ok || !strings.Contains(value, ":") {
+			t.Errorf("parseRangeSource(%q).Next() = %q, %t", source, value, ok)
+		}
+		it.Close()
+	}
+}
+
+func TestParseLoopSources(t *testing.T) {
+	cli := newTestCLI(t)
+	tests := []struct {
+		name string
+		vars []ForVar
+		zip  bool
+		want []string
+	}{
+		{"product", []ForVar{{"u", "a|b"}, {"p", "1..3"}}, false,
+			[]string{"a, 1", "a, 2", "a, 3", "b, 1", "b, 2", "b, 3"}},
+		{"three sources", []ForVar{{"x", "1..2"}, {"y", "a|"}, {"z", "p|q"}}, false,
+			[]string{"1, a, p", "1, a, q", "2, a, p", "2, a, q"}},
+		{"zip stops at the shortest", []ForVar{{"u", "a|b|c"}, {"p", "1..2"}}, true,
+			[]string{"a, 1", "b, 2"}},
+		{"empty source", []ForVar{{"u", "a|b"}, {"p", "|"}}, false, nil},
+	}
+	for _, tt := range tests {
+		it, err := cli.parseLoopSources(tt.vars, tt.zip)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if n := it.Len(); n != len(tt.want) {
+			t.Errorf("%s: Len() = %d, want %d", tt.name, n, len(tt.want))
+		}
+		if got := drain(t, tt.name, it); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Values returns the tuple of the last Next
+	it, err := cli.parseLoopSources([]ForVar{{"u", "a|b"}, {"p", "x, y|z"}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	it.Next()
+	if got := it.(tupleIterator).Values(); !reflect.DeepEqual(got, []string{"a", "x, y"}) {
+		t.Errorf("Values() = %q", got)
+	}
+}
+
+// writeSourceModule adds a bash module that runs script
+func writeSourceModule(t *testing.T, cli *CLI, name, script string) {
+	t.Helper()
+	dir := filepath.Join(cli.manager.ModulesDir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.sh"), []byte("#!/bin/bash\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cli.RefreshModules()
+}
+
+// The loop runs on a module's lines while the module is still printing:
+// the module waits for the first iteration before printing its second line
+func TestModuleSourceStreams(t *testing.T) {
+	cli := newTestCLI(t)
+	dir := t.TempDir()
+	gate, out := filepath.Join(dir, "gate"), filepath.Join(dir, "out")
+	writeSourceModule(t, cli, "gated", `echo one
+for i in $(seq 50); do [ -e `+gate+` ] && break; sleep 0.1; done
+[ -e `+gate+` ] && echo two || echo late
+`)
+
+	cli.ExecuteCommand("for v in <(gated) -> $ bash echo $v >> " + out + "; touch " + gate)
+	if cli.lastExit != 0 {
+		t.Fatalf("loop exit = %d, want 0", cli.lastExit)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\n" {
+		t.Errorf("output = %q, want %q", data, "one\ntwo\n")
+	}
+	if runs, _ := cli.runs.List(); len(runs) != 1 || runs[0].Module != "gated" {
+		t.Errorf("recorded runs = %v, want the source module's", runs)
+	}
+}
+
+// A source that fails part way fails the loop after the lines it printed
+func TestModuleSourceFails(t *testing.T) {
+	cli := newTestCLI(t)
+	writeSourceModule(t, cli, "broken", "echo a\necho b\nexit 3\n")
+
+	output := captureStdout(t, func() { cli.ExecuteCommand("for v in <(broken) -> #echo got $v") })
+	if cli.lastExit != 1 {
+		t.Errorf("loop exit = %d, want 1", cli.lastExit)
+	}
+	if !strings.Contains(output, "got a") || !strings.Contains(output, "got b") {
+		t.Errorf("output = %q, want both lines", output)
+	}
+
+	// Read ahead for a later source of a product, the failure stops the loop
+	if _, err := cli.parseLoopSources([]ForVar{{"x", "1..2"}, {"v", "<(broken)"}}, false); err == nil ||
+		!strings.Contains(err.Error(), "module 'broken' failed [exit: 3]") {
+		t.Errorf("parseLoopSources = %v, want the module failure", err)
+	}
+}
+
+func TestModuleSourceInProduct(t *testing.T) {
+	cli := newTestCLI(t)
+	writeSourceModule(t, cli, "pair", "echo a\necho b\n")
+
+	tests := []struct {
+		vars []ForVar
+		zip  bool
+		want []string
+	}{
+		{[]ForVar{{"v", "<(pair)"}, {"n", "1..2"}}, false, []string{"a, 1", "a, 2", "b, 1", "b, 2"}},
+		{[]ForVar{{"n", "1..2"}, {"v", "<(pair)"}}, false, []string{"1, a", "1, b", "2, a", "2, b"}},
+		{[]ForVar{{"n", "1..3"}, {"v", "<(pair)"}}, true, []string{"1, a", "2, b"}},
+	}
+	for _, tt := range tests {
+		it, err := cli.parseLoopSources(tt.vars, tt.zip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := drain(t, loopSources(&ForNode{Vars: tt.vars}), it); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.vars, got, tt.want)
+		}
+	}
+}
+
+// A loop that stops early stops its source instead of waiting for it
+func TestModuleSourceStopsWithLoop(t *testing.T) {
+	cli := newTestCLI(t)
+	writeSourceModule(t, cli, "slow", "echo a\necho b\nsleep 30\necho c\n")
+
+	for _, loop := range []string{
+		"for v in <(slow) failfast=true -> $ false",
+		"for v in <(slow) &2 failfast=true -> $ false",
+	} {
+		started := time.Now()
+		cli.ExecuteCommand(loop)
+		if elapsed := time.Since(started); elapsed > 10*time.Second {
+			t.Errorf("%s took %s", loop, elapsed)
+		}
+		if cli.lastExit != 1 {
+			t.Errorf("%s: exit = %d, want 1", loop, cli.lastExit)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// Job is a statement started with a trailing &. Its output goes to a log
+// file so it can be replayed with `output` or followed with `fg`
+type Job struct {
+	ID      int
+	Command string
+	LogPath string
+	Started time.Time
+
+	exec   *ModuleExecutor // the job's own processes, out of reach of Ctrl+C
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// Set once, when the job finishes
+	finished time.Time
+	exit     int
+	killed   bool
+	notified bool
+}
+
+// Done is closed once the job has finished
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// running reports whether the job is still going
+func (j *Job) running() bool {
+	select {
+	case <-j.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// state describes how the job is doing, e.g. "Running" or "Exit 2"
+func (j *Job) state() string {
+	switch {
+	case j.running():
+		return "Running"
+	case j.killed:
+		return "Killed"
+	case j.exit == 0:
+		return "Done"
+	case j.exit == exitTimedOut:
+		return "Timed out"
+	case j.exit == exitInterrupted:
+		return "Interrupted"
+	default:
+		return fmt.Sprintf("Exit %d", j.exit)
+	}
+}
+
+// elapsed is how long the job has been running, or ran
+func (j *Job) elapsed() time.Duration {
+	if j.running() {
+		return time.Since(j.Started).Round(time.Second)
+	}
+	return j.finished.Sub(j.Started).Round(time.Millisecond)
+}
+
+// JobTable holds the session's background jobs. It is shared by every fork
+// of the CLI, so jobs started from loops or macros end up here too
+type JobTable struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   []*Job
+
+	// What Ctrl+C applies to while the prompt is blocked on a job:
+	// fg interrupts the job, wait merely stops waiting
+	foreground *Job
+	stopWait   chan struct{}
+}
+
+// NewJobTable creates an empty job table
+func NewJobTable() *JobTable {
+	return &JobTable{nextID: 1}
+}
+
+// add registers a new job and assigns it the next ID
+func (t *JobTable) add(job *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job.ID = t.nextID
+	t.nextID++
+	t.jobs = append(t.jobs, job)
+}
+
+// get finds a job by ID, accepting both "2" and "%2"
+func (t *JobTable) get(ref string) (*Job, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(ref, "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job ID '%s'", ref)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, job := range t.jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("no such job: %d", id)
+}
+
+// list returns every job of the session, oldest first
+func (t *JobTable) list() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Job(nil), t.jobs...)
+}
+
+// runningJobs returns the jobs still going
+func (t *JobTable) runningJobs() []*Job {
+	var running []*Job
+	for _, job := range t.list() {
+		if job.running() {
+			running = append(running, job)
+		}
+	}
+	return running
+}
+
+// takeFinished returns the finished jobs not yet reported at the prompt
+func (t *JobTable) takeFinished() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var finished []*Job
+	for _, job := range t.jobs {
+		if !job.notified && !job.running() {
+			job.notified = true
+			finished = append(finished, job)
+		}
+	}
+	return finished
+}
+
+// interrupt applies Ctrl+C to the job the prompt is waiting on, if any
+func (t *JobTable) interrupt() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.foreground != nil {
+		if !t.foreground.exec.interrupt() {
+			fmt.Println()
+		}
+		return true
+	}
+	if t.stopWait != nil {
+		close(t.stopWait)
+		t.stopWait = nil
+		return true
+	}
+	return false
+}
+
+// jobsDir is where job output is kept
+func jobsDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan_jobs")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "jobs")
+}
+
+// startJob runs a statement in the background on a quiet fork of the CLI
+// whose output goes to the job's log file
+func (cli *CLI) startJob(n *BackgroundNode) {
+	dir := jobsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to create job directory: %v", err))
+		return
+	}
+
+	// A job cannot ask for the passphrase, so one that needs the secrets
+	// is not started unless they unlock without asking
+	if cli.secrets.Locked() && cli.referencesSecret(n.Source) {
+		noPrompt := cli.noPrompt
+		cli.noPrompt = true
+		unlocked := cli.unlockSecrets()
+		cli.noPrompt = noPrompt
+		if !unlocked {
+			cli.lastExit = 1
+			core.PrintError("Job not started: it needs the locked secrets")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		Command: n.Source,
+		Started: time.Now(),
+		exec:    newModuleExecutor(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	cli.jobs.add(job)
+
+	job.LogPath = filepath.Join(dir, fmt.Sprintf("%s_%d.log", job.Started.Format("2006-01-02_15-04-05"), job.ID))
+	logFile, err := os.Create(job.LogPath)
+	if err != nil {
+		cancel()
+		job.exit = 1
+		job.finished = time.Now()
+		close(job.done)
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to create job log: %v", err))
+		return
+	}
+
+	sub := cli.forkIsolated(logFile)
+	sub.ctx = ctx
+	sub.executor = job.exec
+
+	go func() {
+		defer cancel()
+		sub.executeNode(n.Stmt)
+		logFile.Close()
+
+		job.exit = sub.lastExit
+		job.finished = time.Now()
+		close(job.done)
+	}()
+
+	fmt.Printf("[%d] %s\n", job.ID, core.Color("cyan", job.Command))
+}
+
+// notifyJobs reports jobs that finished since the last prompt
+func (cli *CLI) notifyJobs() {
+	for _, job := range cli.jobs.takeFinished() {
+		cli.printJobStatus(job)
+	}
+}
+
+// printJobStatus prints a one line summary of a job
+func (cli *CLI) printJobStatus(job *Job) {
+	state := job.state()
+	padded := fmt.Sprintf("%-11s", state)
+	switch state {
+	case "Running":
+		padded = core.Color("yellow", padded)
+	case "Done":
+		padded = core.Color("green", padded)
+	default:
+		padded = core.Color("red", padded)
+	}
+	fmt.Printf("[%d] %s %s (%s)\n", job.ID, padded, job.Command, job.elapsed())
+}
+
+// Jobs lists the session's background jobs
+func (cli *CLI) Jobs() {
+	jobs := cli.jobs.list()
+	if len(jobs) == 0 {
+		core.PrintInfo("No background jobs, end a command with & to start one")
+		fmt.Println()
+		return
+	}
+
+	// Finished jobs listed here need no separate notification
+	cli.jobs.takeFinished()
+
+	table := core.NewTable([]string{"ID", "State", "Time", "Command"})
+	for _, job := range jobs {
+		table.AddRow(strconv.Itoa(job.ID), job.state(), job.elapsed().String(), job.Command)
+	}
+	fmt.Println()
+	fmt.Println(table.Render())
+}
+
+// JobCommand handles fg, kill, wait and output
+func (cli *CLI) JobCommand(cmd string, args []string) {
+	if cmd == "wait" && len(args) == 0 {
+		cli.waitJobs(cli.jobs.runningJobs())
+		return
+	}
+	if len(args) == 0 {
+		cli.lastExit = 2
+		core.PrintError(fmt.Sprintf("Usage: %s <job-id>", cmd))
+		return
+	}
+
+	var jobs []*Job
+	for _, ref := range args {
+		job, err := cli.jobs.get(ref)
+		if err != nil {
+			cli.lastExit = 1
+			core.PrintError(err.Error())
+			return
+		}
+		jobs = append(jobs, job)
+	}
+
+	switch cmd {
+	case "fg":
+		cli.foregroundJob(jobs[0])
+	case "kill":
+		for _, job := range jobs {
+			cli.killJob(job)
+		}
+	case "wait":
+		cli.waitJobs(jobs)
+	case "output":
+		for _, job := range jobs {
+			cli.jobOutput(job)
+		}
+	}
+}
+
+// foregroundJob follows a job's output until it finishes. Ctrl+C is
+// delivered to the job as if it had been started in the foreground
+func (cli *CLI) foregroundJob(job *Job) {
+	log, err := os.Open(job.LogPath)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to open job output: %v", err))
+		return
+	}
+	defer log.Close()
+
+	cli.jobs.mu.Lock()
+	cli.jobs.foreground = job
+	cli.jobs.mu.Unlock()
+	defer func() {
+		cli.jobs.mu.Lock()
+		cli.jobs.foreground = nil
+		cli.jobs.mu.Unlock()
+	}()
+
+	fmt.Printf("[%d] %s\n", job.ID, core.Color("cyan", job.Command))
+	for {
+		finished := !job.running()
+		// Copy whatever was written since the last pass; once the job is
+		// done this drains the rest of the log
+		if _, err := io.Copy(cli.out(), log); err != nil {
+			break
+		}
+		if finished {
+			break
+		}
+		select {
+		case <-job.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	cli.jobs.mu.Lock()
+	job.notified = true
+	cli.jobs.mu.Unlock()
+	cli.lastExit = job.exit
+	cli.printJobStatus(job)
+}
+
+// killJob stops a job: its context is cancelled, which terminates the
+// process group of whatever it is running
+func (cli *CLI) killJob(job *Job) {
+	if !job.running() {
+		core.PrintWarning(fmt.Sprintf("Job %d has already finished", job.ID))
+		return
+	}
+	job.killed = true
+	job.cancel()
+	core.PrintWarning(fmt.Sprintf("Killing job %d: %s", job.ID, job.Command))
+}
+
+// waitJobs blocks until the jobs finish; Ctrl+C stops waiting but leaves
+// them running
+func (cli *CLI) waitJobs(jobs []*Job) {
+	stop := make(chan struct{})
+	cli.jobs.mu.Lock()
+	cli.jobs.stopWait = stop
+	cli.jobs.mu.Unlock()
+	defer func() {
+		cli.jobs.mu.Lock()
+		if cli.jobs.stopWait == stop {
+			cli.jobs.stopWait = nil
+		}
+		cli.jobs.mu.Unlock()
+	}()
+
+	for _, job := range jobs {
+		select {
+		case <-job.Done():
+		case <-stop:
+			fmt.Println()
+			core.PrintWarning("Stopped waiting, jobs keep running in the background")
+			cli.lastExit = exitInterrupted
+			return
+		}
+		cli.jobs.mu.Lock()
+		job.notified = true
+		cli.jobs.mu.Unlock()
+		cli.lastExit = job.exit
+		cli.printJobStatus(job)
+	}
+}
+
+// jobOutput prints what a job has written so far
+func (cli *CLI) jobOutput(job *Job) {
+	data, err := os.ReadFile(job.LogPath)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to read job output: %v", err))
+		return
+	}
+	if cli.redirected() {
+		cli.out().Write(data)
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("Job %d: %s [%s]", job.ID, job.Command, job.state())))
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line != "" {
+			fmt.Println(core.NmapSubBox(line))
+		}
+	}
+	fmt.Println()
+	core.PrintInfo(fmt.Sprintf("Full output: %s", job.LogPath))
+	fmt.Println()
+}
+
+// stopJobs kills every running job, used when the CLI exits
+func (cli *CLI) stopJobs() {
+	running := cli.jobs.runningJobs()
+	if len(running) == 0 {
+		return
+	}
+	core.PrintWarning(fmt.Sprintf("Killing %d running job(s)", len(running)))
+	for _, job := range running {
+		job.killed = true
+		job.cancel()
+	}
+	for _, job := range running {
+		<-job.Done()
+	}
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"testing"
+)
+
+// A job runs on a fork of its own: what it sets does not reach the session
+func TestJobIsolatesVariables(t *testing.T) {
+	cli := newTestCLI(t)
+
+	cli.ExecuteCommand("x := #echo job &")
+	cli.ExecuteCommand("y := #echo prompt")
+	for _, job := range cli.jobs.list() {
+		<-job.done
+		if job.exit != 0 {
+			t.Errorf("job %d exit = %d, want 0", job.ID, job.exit)
+		}
+	}
+	if _, ok := cli.vars["x"]; ok {
+		t.Errorf("the job's capture leaked into the session: x=%q", cli.vars["x"])
+	}
+	if cli.vars["y"] != "prompt" {
+		t.Errorf("y = %q, want prompt", cli.vars["y"])
+	}
+}
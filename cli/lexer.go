@@ -0,0 +1,386 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the lexical class of a token
+type TokenKind int
+
+const (
+	TokWord     TokenKind = iota // plain, quoted or key=value word
+	TokPipe                      // |>
+	TokRedirect                  // > >> 2> 2>> &> &>>
+	TokArrow                     // ->
+	TokEOF
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokWord:
+		return "word"
+	case TokPipe:
+		return "'|>'"
+	case TokRedirect:
+		return "redirection"
+	case TokArrow:
+		return "'->'"
+	case TokEOF:
+		return "end of input"
+	}
+	return "token"
+}
+
+// Token is a single lexical unit of the lmv command language
+type Token struct {
+	Kind TokenKind
+	Pos  int    // byte offset of the first character in the input
+	End  int    // byte offset just past the last character
+	Raw  string // source text exactly as typed
+	Word Word   // set for TokWord
+}
+
+// Word is an unquoted, escape-processed and (optionally) variable-expanded word
+type Word struct {
+	Value  string // full value, quotes removed
+	Key    string // for key=value words: the key (the '=' was unquoted)
+	Val    string // for key=value words: the value
+	Quoted bool   // true if any part of the word was quoted
+	Pos    int
+}
+
+// IsAssign reports whether the word has the form key=value
+func (w Word) IsAssign() bool {
+	return w.Key != ""
+}
+
+// SyntaxError reports a problem at a precise position in the input
+type SyntaxError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Caret returns the input with a ^ marker under the error position
+func (e *SyntaxError) Caret() string {
+	pos := e.Pos
+	if pos > len(e.Input) {
+		pos = len(e.Input)
+	}
+	// Count runes so the marker lines up with multi-byte characters
+	return e.Input + "\n" + strings.Repeat(" ", len([]rune(e.Input[:pos]))) + "^"
+}
+
+// VarLookup resolves a variable name during lexing
+type VarLookup func(name string) (string, bool)
+
+// Lexer splits lmv command text into tokens. Quoting follows the shell:
+// double quotes allow escapes and $var expansion, single quotes are literal,
+// and a backslash outside quotes escapes the next character
+type Lexer struct {
+	input    string
+	pos      int
+	expand   VarLookup // nil disables $var expansion
+	commaSep bool      // treat unquoted commas as word separators
+}
+
+// NewLexer creates a lexer; expand may be nil to keep $var references literally
+func NewLexer(input string, expand VarLookup) *Lexer {
+	return &Lexer{input: input, expand: expand}
+}
+
+// Tokenize returns every token in the input, ending with TokEOF
+func (lx *Lexer) Tokenize() ([]Token, error) {
+	var tokens []Token
+	for {
+		tok, err := lx.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == TokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (lx *Lexer) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Input: lx.input, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (lx *Lexer) isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || (lx.commaSep && ch == ',')
+}
+
+// operatorAt returns the operator starting at the current position, if any
+func (lx *Lexer) operatorAt() (TokenKind, string) {
+	rest := lx.input[lx.pos:]
+	switch {
+	case strings.HasPrefix(rest, "|>"):
+		return TokPipe, "|>"
+	case strings.HasPrefix(rest, "->"):
+		return TokArrow, "->"
+	}
+	for _, op := range []string{"&>>", "2>>", "&>", "2>", ">>", ">"} {
+		if strings.HasPrefix(rest, op) {
+			return TokRedirect, op
+		}
+	}
+	return TokEOF, ""
+}
+
+func (lx *Lexer) next() (Token, error) {
+	for lx.pos < len(lx.input) && lx.isSpace(lx.input[lx.pos]) {
+		lx.pos++
+	}
+	if lx.pos >= len(lx.input) {
+		return Token{Kind: TokEOF, Pos: lx.pos, End: lx.pos}, nil
+	}
+
+	start := lx.pos
+	if kind, op := lx.operatorAt(); op != "" {
+		lx.pos += len(op)
+		return Token{Kind: kind, Pos: start, End: lx.pos, Raw: op}, nil
+	}
+
+	word, err := lx.readWord()
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Kind: TokWord, Pos: start, End: lx.pos, Raw: lx.input[start:lx.pos], Word: word}, nil
+}
+
+// readWord consumes one word, stopping at whitespace or an unquoted operator
+func (lx *Lexer) readWord() (Word, error) {
+	var sb strings.Builder
+	word := Word{Pos: lx.pos}
+	keyEnd := -1 // length of sb when the first unquoted '=' was seen
+
+	for lx.pos < len(lx.input) {
+		ch := lx.input[lx.pos]
+
+		if lx.isSpace(ch) {
+			break
+		}
+		// Unquoted operators end a word; "2>" only redirects at the
+		// start of a word, so "x2>f" is "x2" > "f"
+		if _, op := lx.operatorAt(); op != "" {
+			if op != "2>" && op != "2>>" {
+				break
+			}
+			if lx.pos == word.Pos {
+				break
+			}
+		}
+
+		switch ch {
+		case '\\':
+			if lx.pos+1 < len(lx.input) {
+				sb.WriteByte(lx.input[lx.pos+1])
+				lx.pos += 2
+			} else {
+				lx.pos++
+			}
+			word.Quoted = true
+
+		case '\'':
+			end := strings.IndexByte(lx.input[lx.pos+1:], '\'')
+			if end < 0 {
+				return word, lx.errorf(lx.pos, "unterminated single quote")
+			}
+			sb.WriteString(lx.input[lx.pos+1 : lx.pos+1+end])
+			lx.pos += end + 2
+			word.Quoted = true
+
+		case '"':
+			if err := lx.readDoubleQuoted(&sb); err != nil {
+				return word, err
+			}
+			word.Quoted = true
+
+		case '$':
+			lx.readVariable(&sb)
+
+		case '=':
+			if keyEnd < 0 {
+				keyEnd = sb.Len()
+			}
+			sb.WriteByte(ch)
+			lx.pos++
+
+		default:
+			sb.WriteByte(ch)
+			lx.pos++
+		}
+	}
+
+	word.Value = sb.String()
+	if keyEnd > 0 && isValidIdentifier(word.Value[:keyEnd]) {
+		word.Key = word.Value[:keyEnd]
+		word.Val = word.Value[keyEnd+1:]
+	}
+	return word, nil
+}
+
+// readDoubleQuoted consumes "..." processing escapes and variables
+func (lx *Lexer) readDoubleQuoted(sb *strings.Builder) error {
+	open := lx.pos
+	lx.pos++ // opening quote
+
+	for lx.pos < len(lx.input) {
+		ch := lx.input[lx.pos]
+		switch ch {
+		case '"':
+			lx.pos++
+			return nil
+		case '\\':
+			if lx.pos+1 >= len(lx.input) {
+				lx.pos++
+				continue
+			}
+			next := lx.input[lx.pos+1]
+			switch next {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case '"', '\\', '$':
+				sb.WriteByte(next)
+			default:
+				sb.WriteByte('\\')
+				sb.WriteByte(next)
+			}
+			lx.pos += 2
+		case '$':
+			lx.readVariable(sb)
+		default:
+			sb.WriteByte(ch)
+			lx.pos++
+		}
+	}
+	return lx.errorf(open, "unterminated double quote")
+}
+
+// readVariable consumes $name or ${name}, expanding it when a lookup is set.
+// Unknown variables are kept as written, matching expandVariables
+func (lx *Lexer) readVariable(sb *strings.Builder) {
+	start := lx.pos
+	lx.pos++ // $
+
+	braced := lx.pos < len(lx.input) && lx.input[lx.pos] == '{'
+	if braced {
+		lx.pos++
+	}
+
+	nameStart := lx.pos
+	if !braced && lx.pos < len(lx.input) && lx.input[lx.pos] == '?' {
+		// $? is the exit status of the previous statement
+		lx.pos++
+	} else {
+		for lx.pos < len(lx.input) && isValidVarChar(rune(lx.input[lx.pos])) {
+			lx.pos++
+		}
+	}
+	name := lx.input[nameStart:lx.pos]
+
+	if braced {
+		if lx.pos < len(lx.input) && lx.input[lx.pos] == '}' && name != "" {
+			lx.pos++
+		} else {
+			// Not a valid ${name}; keep the text literally
+			lx.pos = start + 1
+			sb.WriteByte('$')
+			return
+		}
+	}
+
+	if name == "" {
+		sb.WriteByte('$')
+		return
+	}
+
+	if lx.expand != nil {
+		if value, ok := lx.expand(name); ok {
+			sb.WriteString(value)
+			return
+		}
+	}
+	sb.WriteString(lx.input[start:lx.pos])
+}
+
+// lexWords tokenizes text into words only, rejecting operators
+func lexWords(text string, expand VarLookup, commaSep bool) ([]Word, error) {
+	lx := NewLexer(text, expand)
+	lx.commaSep = commaSep
+	tokens, err := lx.Tokenize()
+	if err != nil {
+		return nil, err
+	}
+
+	var words []Word
+	for _, tok := range tokens {
+		switch tok.Kind {
+		case TokEOF:
+			return words, nil
+		case TokWord:
+			words = append(words, tok.Word)
+		default:
+			words = append(words, Word{Value: tok.Raw, Pos: tok.Pos})
+		}
+	}
+	return words, nil
+}
+
+// wordsFromArgs converts already-split arguments (e.g. os.Args) to words
+// without any further quote or variable processing
+func wordsFromArgs(args []string) []Word {
+	words := make([]Word, 0, len(args))
+	for _, arg := range args {
+		w := Word{Value: arg}
+		if key, val, found := strings.Cut(arg, "="); found && isValidIdentifier(key) {
+			w.Key, w.Val = key, val
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+// wordValues returns the values of a word list
+func wordValues(words []Word) []string {
+	values := make([]string, 0, len(words))
+	for _, w := range words {
+		values = append(values, w.Value)
+	}
+	return values
+}
+
+// findPipe returns the offset of the next |> outside of quotes at or after
+// from, or -1. Used for text the lexer must not interpret, like shell stages
+func findPipe(s string, from int) int {
+	var quote byte
+	for i := from; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote == '"' && ch == '\\':
+			i++
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\\':
+			i++
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '|' && i+1 < len(s) && s[i+1] == '>':
+			return i
+		}
+	}
+	return -1
+}
@@ -4,19 +4,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"lanmanvan/core"
 )
 
 // Logger handles dual output to console and file
 type Logger struct {
+	dir      string
 	filePath string
 	file     *os.File
 	enabled  bool
 }
 
-// NewLogger creates a new logger instance
-func NewLogger() *Logger {
+// NewLogger creates a logger writing its files to dir
+func NewLogger(dir string) *Logger {
 	return &Logger{
+		dir:     dir,
 		enabled: false,
 	}
 }
@@ -24,7 +29,7 @@ func NewLogger() *Logger {
 // EnableFileLogging starts logging to a file
 func (l *Logger) EnableFileLogging(moduleName string) error {
 	// Create logs directory if it doesn't exist
-	logsDir := "./logs"
+	logsDir := l.dir
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create logs directory: %v", err)
 	}
@@ -55,7 +60,10 @@ func (l *Logger) Close() error {
 	if l.file != nil {
 		l.writeToFile(fmt.Sprintf("\n================================\n"))
 		l.writeToFile(fmt.Sprintf("Ended: %s\n", time.Now().Format(time.RFC3339)))
-		return l.file.Close()
+		err := l.file.Close()
+		l.file = nil
+		l.enabled = false
+		return err
 	}
 	return nil
 }
@@ -85,6 +93,27 @@ func (l *Logger) LogSection(title string) {
 	}
 }
 
+// LogOutput writes a module's captured streams to the log file
+func (l *Logger) LogOutput(result *core.ExecutionResult) {
+	if !l.enabled || result == nil {
+		return
+	}
+	if result.Output != "" {
+		l.writeToFile(result.Output)
+		if !strings.HasSuffix(result.Output, "\n") {
+			l.writeToFile("\n")
+		}
+	}
+	if result.Stderr != "" {
+		l.writeToFile("\n[stderr]\n")
+		l.writeToFile(result.Stderr)
+		if !strings.HasSuffix(result.Stderr, "\n") {
+			l.writeToFile("\n")
+		}
+	}
+	l.writeToFile(fmt.Sprintf("\nExit code: %d\n", result.ExitCode))
+}
+
 // GetFilePath returns the log file path
 func (l *Logger) GetFilePath() string {
 	return l.filePath
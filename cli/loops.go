@@ -0,0 +1,488 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"lanmanvan/core"
+)
+
+// loopIteration is the outcome of one for-loop iteration
+type loopIteration struct {
+	index   int
+	values  []string // one per loop variable
+	command string   // body with the loop variable substituted, for display
+	result  string   // output of a body pipeline, collected for the summary
+	output  string   // buffered output of a parallel iteration
+	exit    int
+}
+
+// executeForLoop runs a for-loop. Supported syntaxes:
+//
+//	for $x in 1..100 -> command
+//	for x in a..z -> command
+//	for ip in 192.168.1.1..192.168.1.50 -> ping $ip
+//	for c in a..z+A..Z+0..9 -> echo $c
+//	for user in admin|root|guest -> hydra -l $user ...
+//	for ip in 10.0.0.1..254 parallel=16 order=completed failfast=true -> ping $ip
+//	for ip in 10.0.0.1..254 &16 -> ping $ip
+//	for host in @hosts.txt, port in 22|80|443 -> portscan host=$host ports=$port
+//	for user in @users.txt, pass in @passwords.txt zip -> login user=$user pass=$pass
+func (cli *CLI) executeForLoop(loop *ForNode) {
+	iter, err := cli.parseLoopSources(loop.Vars, loop.Zip)
+	if err != nil {
+		cli.lastExit = 2
+		E_msg := "Cannot parse range: " + err.Error() + "\nSource was: " + loopSources(loop) + ""
+		core.PrintError(E_msg)
+		return
+	}
+	defer iter.Close()
+
+	total := iter.Len()
+	if total == 0 {
+		core.PrintWarning("Empty range - nothing to do")
+		return
+	}
+
+	if !cli.quiet {
+		fmt.Println()
+		if loop.Parallel > 1 {
+			core.PrintInfo(fmt.Sprintf("Loop: %s  (%s items, %d workers)", loopSources(loop), lenLabel(total), loop.Parallel))
+		} else {
+			core.PrintInfo(fmt.Sprintf("Loop: %s  (%s items)", loopSources(loop), lenLabel(total)))
+		}
+		fmt.Println()
+	}
+
+	var done []loopIteration
+	if loop.Parallel > 1 {
+		done = cli.runLoopParallel(loop, iter, total)
+	} else {
+		done = cli.runLoopSequential(loop, iter, total)
+	}
+
+	// A module source fails after the loop has started
+	sourceErr := iteratorErr(iter)
+	if sourceErr != nil {
+		core.PrintError(sourceErr.Error())
+	} else if len(done) == 0 {
+		core.PrintWarning("Empty range - nothing to do")
+		return
+	}
+
+	// Collected pipeline results, in input order
+	sort.Slice(done, func(i, j int) bool { return done[i].index < done[j].index })
+	var results []string
+	succeeded, failed := 0, 0
+	interrupted := false
+	for _, it := range done {
+		interrupted = interrupted || it.exit == exitInterrupted
+		if it.exit == 0 {
+			succeeded++
+		} else {
+			failed++
+		}
+		if it.result != "" {
+			results = append(results, it.result)
+		}
+	}
+
+	if len(results) > 0 && cli.redirected() {
+		for _, res := range results {
+			fmt.Fprintln(cli.out(), strings.TrimSpace(res))
+		}
+	} else if len(results) > 0 {
+		fmt.Println()
+		core.PrintSuccess("Collected results (" + strconv.Itoa(len(results)) + "):")
+		for i, res := range results {
+			fmt.Printf("  [%2d] %s\n", i+1, strings.TrimSpace(res))
+		}
+		fmt.Println()
+	}
+
+	summary := fmt.Sprintf("Loop finished: %d succeeded, %d failed", succeeded, failed)
+	if skipped := total - len(done); total > 0 && skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	// An interrupted loop stops a script running it, like Ctrl+C on a module
+	switch {
+	case interrupted:
+		cli.lastExit = exitInterrupted
+	case sourceErr != nil:
+		cli.lastExit = exitCode(sourceErr)
+	case failed > 0:
+		cli.lastExit = 1
+	default:
+		cli.lastExit = 0
+	}
+	if cli.quiet {
+		fmt.Fprintln(cli.progress(), summary)
+		return
+	}
+	if failed > 0 || sourceErr != nil {
+		core.PrintWarning(summary)
+	} else {
+		core.PrintSuccess(summary)
+	}
+	fmt.Println()
+}
+
+// lenLabel shows a loop's length, "?" while a source is still producing values
+func lenLabel(total int) string {
+	if total == unknownLen {
+		return "?"
+	}
+	return strconv.Itoa(total)
+}
+
+// progress is where per-iteration progress goes: the terminal, or for a
+// quiet fork such as a background job, its own output
+func (cli *CLI) progress() io.Writer {
+	if cli.quiet {
+		return cli.out()
+	}
+	return os.Stdout
+}
+
+// runLoopSequential runs iterations one by one, streaming their output
+func (cli *CLI) runLoopSequential(loop *ForNode, iter Iterator, total int) []loopIteration {
+	bind := newLoopBinder(loop.Vars, cli.loop)
+
+	var done []loopIteration
+	for index := 1; ; index++ {
+		values, ok := nextValues(iter)
+		if !ok {
+			break
+		}
+
+		it := loopIteration{index: index, values: values, command: bind.substitute(loop.Body, values)}
+		fmt.Fprintf(cli.progress(), "  [%3d/%3s] → %s\n", index, lenLabel(total), it.command)
+
+		it.result, it.exit = cli.runLoopBody(loop, bind, values)
+		done = append(done, it)
+
+		if it.exit == exitInterrupted {
+			core.PrintWarning("Loop interrupted")
+			break
+		}
+		if it.exit != 0 && loop.FailFast {
+			core.PrintError(fmt.Sprintf("Iteration %d failed [exit: %d], stopping (failfast)", index, it.exit))
+			break
+		}
+	}
+	return done
+}
+
+// runLoopParallel runs iterations on a pool of loop.Parallel workers. Each
+// iteration's output is buffered and printed whole, in input order or as
+// iterations complete
+func (cli *CLI) runLoopParallel(loop *ForNode, iter Iterator, total int) []loopIteration {
+	bind := newLoopBinder(loop.Vars, cli.loop)
+
+	// Workers cannot ask for the passphrase, so it is asked for once here
+	if len(cli.secrets.Names()) > 0 {
+		cli.unlockSecrets()
+	}
+
+	jobs := make(chan loopIteration)
+	finished := make(chan loopIteration)
+	var stop atomic.Bool
+
+	// Feed values lazily so huge ranges are never materialised
+	go func() {
+		defer close(jobs)
+		for index := 1; !stop.Load(); index++ {
+			values, ok := nextValues(iter)
+			if !ok {
+				return
+			}
+			jobs <- loopIteration{index: index, values: values, command: bind.substitute(loop.Body, values)}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(loop.Parallel)
+	for w := 0; w < loop.Parallel; w++ {
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				if stop.Load() {
+					continue
+				}
+				buf := &lockedBuffer{}
+				it.result, it.exit = cli.forkIsolated(buf).runLoopBody(loop, bind, it.values)
+				it.output = buf.String()
+				if it.exit == exitInterrupted || (it.exit != 0 && loop.FailFast) {
+					// The feeder may be waiting on a module source
+					stop.Store(true)
+					cancelIterator(iter)
+				}
+				finished <- it
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	var done []loopIteration
+	pending := make(map[int]loopIteration)
+	next := 1
+	for it := range finished {
+		done = append(done, it)
+		if loop.AsCompleted {
+			cli.printLoopIteration(it, total)
+			continue
+		}
+		pending[it.index] = it
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			cli.printLoopIteration(ready, total)
+			delete(pending, next)
+			next++
+		}
+	}
+
+	// With failfast some earlier indices may never have run
+	var rest []int
+	for index := range pending {
+		rest = append(rest, index)
+	}
+	sort.Ints(rest)
+	for _, index := range rest {
+		cli.printLoopIteration(pending[index], total)
+	}
+
+	if stop.Load() {
+		core.PrintError("Remaining iterations were skipped after a failed or interrupted iteration")
+	}
+	return done
+}
+
+// printLoopIteration shows a finished parallel iteration and its output
+func (cli *CLI) printLoopIteration(it loopIteration, total int) {
+	mark := core.Color("green", "✓")
+	if it.exit != 0 {
+		mark = core.Color("red", fmt.Sprintf("✗ [exit: %d]", it.exit))
+	}
+	fmt.Fprintf(cli.progress(), "  [%3d/%3s] %s %s\n", it.index, lenLabel(total), mark, it.command)
+
+	if out := strings.TrimRight(it.output, "\n"); out != "" {
+		fmt.Fprintln(cli.out(), out)
+	}
+}
+
+// runLoopBody runs the loop body once with the loop variables bound to values.
+// It returns the output of a body pipeline, if any, and the exit status
+func (cli *CLI) runLoopBody(loop *ForNode, bind *loopBinder, values []string) (string, int) {
+	// Loop variables shadow globals while the body is parsed and run, and
+	// loops nested in the body see this iteration's variables. Values are
+	// bound once, by the lexer or, for shell stages, in the environment
+	enclosing := cli.loop
+	cli.loop = &loopBinding{bind: bind, values: values}
+	defer func() { cli.loop = enclosing }()
+
+	stmt, err := ParseCommand(loop.Body, cli.lookupVar)
+	if err != nil {
+		cli.printSyntaxError(err)
+		return "", cli.lastExit
+	}
+	if n, ok := stmt.(*BackgroundNode); ok {
+		// The job list shows the command with this iteration's values
+		n.Source = bind.substitute(n.Source, values)
+	}
+
+	if n, ok := stmt.(*PipelineNode); ok {
+		result, _, err := cli.executePipeline(n, false)
+		if err != nil {
+			fmt.Fprintln(cli.errOut(), core.Color("red", "[!] "+err.Error()))
+			return "", exitCode(err)
+		}
+		return result.text, 0
+	}
+
+	cli.executeNode(stmt)
+	return "", cli.lastExit
+}
+
+// forkQuiet returns a copy of the CLI whose output goes to w and that skips
+// progress messages, so parallel iterations do not interleave. The copy
+// shares the session's variables and macros, so it must run on the
+// caller's goroutine; see forkIsolated for one that does not
+func (cli *CLI) forkQuiet(w io.Writer) *CLI {
+	sub := *cli
+	sub.stdout, sub.stderr = w, w
+	sub.quiet = true
+	return &sub
+}
+
+// forkIsolated is forkQuiet for a fork run on its own goroutine: it gets
+// copies of the session variables and macros and a logger of its own, so
+// what it sets stays with it. It never asks for input, the prompt's
+// goroutine owns the terminal
+func (cli *CLI) forkIsolated(w io.Writer) *CLI {
+	sub := cli.forkQuiet(w)
+	sub.rl = nil
+	sub.noPrompt = true
+	sub.logger = NewLogger(cli.logger.dir)
+	sub.wrappers = append([]string(nil), cli.wrappers...)
+	sub.sessionWrappers = append([]string(nil), cli.sessionWrappers...)
+	sub.history = append([]string(nil), cli.history...)
+
+	sub.vars = copyVars(cli.vars)
+	sub.moduleScope = make(map[string]map[string]string, len(cli.moduleScope))
+	for module, vars := range cli.moduleScope {
+		sub.moduleScope[module] = copyVars(vars)
+	}
+
+	sub.macros = copyVars(cli.macros)
+	sub.macroParams = make(map[string][]string, len(cli.macroParams))
+	for name, params := range cli.macroParams {
+		sub.macroParams[name] = append([]string(nil), params...)
+	}
+	sub.macroRequired = make(map[string]map[string]bool, len(cli.macroRequired))
+	for name, required := range cli.macroRequired {
+		sub.macroRequired[name] = make(map[string]bool, len(required))
+		for param, ok := range required {
+			sub.macroRequired[name][param] = ok
+		}
+	}
+	sub.macroDefaults = make(map[string]map[string]string, len(cli.macroDefaults))
+	for name, defaults := range cli.macroDefaults {
+		sub.macroDefaults[name] = copyVars(defaults)
+	}
+	sub.builtinMacros = make(map[string]bool, len(cli.builtinMacros))
+	for name, ok := range cli.builtinMacros {
+		sub.builtinMacros[name] = ok
+	}
+	return sub
+}
+
+func copyVars(vars map[string]string) map[string]string {
+	copied := make(map[string]string, len(vars))
+	for name, value := range vars {
+		copied[name] = value
+	}
+	return copied
+}
+
+// loopBinder substitutes and looks up a loop's variables, then those of
+// the loops it is nested in
+type loopBinder struct {
+	names []string
+	res   []*regexp.Regexp // $var and ${var}, one per variable
+	outer *loopBinding     // the enclosing loop's iteration, nil at the top
+}
+
+// loopBinding is a loop's variables bound to one iteration's values
+type loopBinding struct {
+	bind   *loopBinder
+	values []string
+}
+
+func newLoopBinder(vars []ForVar, outer *loopBinding) *loopBinder {
+	b := &loopBinder{outer: outer}
+	for _, v := range vars {
+		b.names = append(b.names, v.Name)
+		b.res = append(b.res, regexp.MustCompile(`\$\{`+regexp.QuoteMeta(v.Name)+`\}|\$`+regexp.QuoteMeta(v.Name)+`\b`))
+	}
+	return b
+}
+
+func (b *loopBinder) substitute(text string, values []string) string {
+	for i, re := range b.res {
+		text = re.ReplaceAllLiteralString(text, values[i])
+	}
+	if b.outer != nil {
+		// Our own variables are gone by now, so they shadow outer ones
+		text = b.outer.bind.substitute(text, b.outer.values)
+	}
+	return text
+}
+
+func (l *loopBinding) lookup(name string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+	return l.bind.lookup(name, l.values)
+}
+
+// environ lists the bound variables as NAME=value pairs for a shell stage.
+// Outer loops come first so an inner variable of the same name wins
+func (l *loopBinding) environ() []string {
+	if l == nil {
+		return nil
+	}
+	env := l.bind.outer.environ()
+	for i, name := range l.bind.names {
+		env = append(env, name+"="+l.values[i])
+	}
+	return env
+}
+
+func (b *loopBinder) lookup(name string, values []string) (string, bool) {
+	for i, n := range b.names {
+		if n == name {
+			return values[i], true
+		}
+	}
+	if b.outer != nil {
+		return b.outer.bind.lookup(name, b.outer.values)
+	}
+	return "", false
+}
+
+// nextValues reads the next value tuple from a loop iterator
+func nextValues(iter Iterator) ([]string, bool) {
+	value, ok := iter.Next()
+	if !ok {
+		return nil, false
+	}
+	if tuples, isTuple := iter.(tupleIterator); isTuple {
+		return tuples.Values(), true
+	}
+	return []string{value}, true
+}
+
+// loopSources describes a loop's bindings: "host ∈ @hosts.txt × port ∈ 22|80"
+func loopSources(loop *ForNode) string {
+	parts := make([]string, 0, len(loop.Vars))
+	for _, v := range loop.Vars {
+		parts = append(parts, v.Name+" ∈ "+v.Source)
+	}
+	if loop.Zip {
+		return strings.Join(parts, " ⇄ ")
+	}
+	return strings.Join(parts, " × ")
+}
+
+// lockedBuffer is a bytes.Buffer safe for a module's concurrent stdout and stderr copies
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestCLI returns a CLI whose home, workspaces and modules live in a
+// temporary directory
+func newTestCLI(t *testing.T) *CLI {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(passphraseEnv, "")
+	return NewCLI(t.TempDir())
+}
+
+// Parallel iterations capture and set variables on forks of their own; run
+// with -race
+func TestParallelLoopIsolatesVariables(t *testing.T) {
+	cli := newTestCLI(t)
+	cli.vars["keep"] = "outer"
+
+	cli.ExecuteCommand("for i in 1..200 parallel=8 -> x := #echo $i")
+	if cli.lastExit != 0 {
+		t.Fatalf("loop exit = %d, want 0", cli.lastExit)
+	}
+	if _, ok := cli.vars["x"]; ok {
+		t.Errorf("an iteration's capture leaked into the session: x=%q", cli.vars["x"])
+	}
+	if cli.vars["keep"] != "outer" {
+		t.Errorf("keep = %q, want outer", cli.vars["keep"])
+	}
+}
+
+func TestParallelLoopSavedVariables(t *testing.T) {
+	cli := newTestCLI(t)
+
+	cli.ExecuteCommand("for i in 1..50 parallel=8 -> setg v$i $i")
+	for _, name := range []string{"v1", "v25", "v50"} {
+		if _, ok := cli.globalEnv.Get(name); !ok {
+			t.Errorf("%s was not saved", name)
+		}
+	}
+}
+
+func TestLoopBinderNested(t *testing.T) {
+	outer := newLoopBinder([]ForVar{{Name: "a"}, {Name: "c"}}, nil)
+	inner := newLoopBinder([]ForVar{{Name: "b"}, {Name: "c"}}, &loopBinding{bind: outer, values: []string{"1", "3"}})
+	values := []string{"x", "y"}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"#echo A=$a B=$b", "#echo A=1 B=x"},
+		{"#echo ${a}${b}", "#echo 1x"},
+		{"#echo C=$c", "#echo C=y"}, // the inner c shadows the outer one
+		{"#echo $abc $d", "#echo $abc $d"},
+	}
+	for _, tt := range tests {
+		if got := inner.substitute(tt.text, values); got != tt.want {
+			t.Errorf("substitute(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	lookups := []struct {
+		name  string
+		want  string
+		found bool
+	}{
+		{"a", "1", true},
+		{"b", "x", true},
+		{"c", "y", true},
+		{"d", "", false},
+	}
+	for _, tt := range lookups {
+		got, found := inner.lookup(tt.name, values)
+		if got != tt.want || found != tt.found {
+			t.Errorf("lookup(%q) = %q, %t, want %q, %t", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+// The outer loop's variable reaches shell text in a nested loop's body
+func TestNestedLoopBindsOuterVariable(t *testing.T) {
+	cli := newTestCLI(t)
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	cli.ExecuteCommand("for a in 1..2 -> for b in x|y -> $ echo A=$a B=$b >> " + out)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "A=1 B=x\nA=1 B=y\nA=2 B=x\nA=2 B=y\n"
+	if string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+}
+
+// Values read from a file are data: a shell stage gets them in its
+// environment and neither the shell nor lmv expands them a second time
+func TestLoopValuesAreNotCode(t *testing.T) {
+	cli := newTestCLI(t)
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "injected")
+	values := []string{
+		"x; touch " + marker,
+		"`touch " + marker + "`",
+		"$(touch " + marker + ")",
+		"$HOME",
+		"<(touch)",
+	}
+	module := filepath.Join(cli.manager.ModulesDir, "touch")
+	os.MkdirAll(module, 0755)
+	os.WriteFile(filepath.Join(module, "main.sh"), []byte("#!/bin/bash\ntouch "+marker+"\n"), 0755)
+	cli.RefreshModules()
+
+	list := filepath.Join(dir, "values.txt")
+	if err := os.WriteFile(list, []byte(strings.Join(values, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.txt")
+	want := strings.Join(values, "\n") + "\n"
+
+	cli.ExecuteCommand("for v in @" + list + ` -> $ bash printf '%s\n' "$v" >> ` + out)
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("shell output = %q, want %q", data, want)
+	}
+
+	output := captureStdout(t, func() { cli.ExecuteCommand("for v in @" + list + " -> #echo $v") })
+	for _, value := range values {
+		if !strings.Contains(output, "\n"+value+"\n") {
+			t.Errorf("macro output = %q, want a line %q", output, value)
+		}
+	}
+
+	// A value naming a module source is not run as one
+	cli.ExecuteCommand("for v in @" + list + " -> for w in $v -> #echo $w")
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("a loop value was run as a command")
+	}
+}
@@ -0,0 +1,632 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// macroFile is the on-disk form of a user macro
+type macroFile struct {
+	Name     string            `json:"name"`
+	Params   []string          `json:"params"`
+	Required []string          `json:"required,omitempty"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+	Template string            `json:"template"`
+}
+
+// maxMacroDepth bounds macros calling macros, so a macro calling itself
+// fails instead of exhausting the stack
+const maxMacroDepth = 64
+
+// macroDefRegex matches: #def name |a:must,b=1| -> template   (params optional)
+var macroDefRegex = regexp.MustCompile(`^#(?:def|define)\s+([A-Za-z_][\w-]*)\s*(?:\|([^|]*)\|)?\s*->\s*(.+)$`)
+
+// getMacrosPath returns the persistent macro file path
+func getMacrosPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "/tmp/lanmanvan_macros.json"
+	}
+	configDir := filepath.Join(homeDir, ".lanmanvan")
+	os.MkdirAll(configDir, 0700)
+	return filepath.Join(configDir, "macros.json")
+}
+
+// defaultBuiltinMacros lists the macros handled by handleBuiltinMacro
+func defaultBuiltinMacros() map[string]bool {
+	return map[string]bool{
+		"echo":   true,
+		"if":     true,
+		"else":   true,
+		"define": true,
+		"def":    true,
+		"undef":  true,
+		"pwd":    true,
+		"whoami": true,
+		"date":   true,
+		"clear":  true,
+		"cls":    true,
+		"value":  true,
+		"set":    true,
+	}
+}
+
+// loadMacros reads persisted macros, ignoring a missing file
+func (cli *CLI) loadMacros() error {
+	data, err := ioutil.ReadFile(getMacrosPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var stored []macroFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	for _, m := range stored {
+		cli.storeMacro(m)
+	}
+	return nil
+}
+
+// saveMacros persists all user macros
+func (cli *CLI) saveMacros() error {
+	names := cli.macroNames()
+	stored := make([]macroFile, 0, len(names))
+	for _, name := range names {
+		stored = append(stored, cli.macroDefinition(name))
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getMacrosPath(), data, 0600)
+}
+
+// storeMacro registers a macro in the CLI maps
+func (cli *CLI) storeMacro(m macroFile) {
+	cli.macros[m.Name] = m.Template
+	cli.macroParams[m.Name] = m.Params
+
+	required := make(map[string]bool)
+	for _, p := range m.Required {
+		required[p] = true
+	}
+	cli.macroRequired[m.Name] = required
+
+	defaults := make(map[string]string)
+	for k, v := range m.Defaults {
+		defaults[k] = v
+	}
+	cli.macroDefaults[m.Name] = defaults
+}
+
+// macroDefinition rebuilds the stored form of a macro
+func (cli *CLI) macroDefinition(name string) macroFile {
+	m := macroFile{
+		Name:     name,
+		Params:   cli.macroParams[name],
+		Template: cli.macros[name],
+		Defaults: cli.macroDefaults[name],
+	}
+	for _, p := range m.Params {
+		if cli.macroRequired[name][p] {
+			m.Required = append(m.Required, p)
+		}
+	}
+	return m
+}
+
+// macroNames returns user macro names sorted
+func (cli *CLI) macroNames() []string {
+	names := make([]string, 0, len(cli.macros))
+	for name := range cli.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatMacroSignature renders |a:must,b=1| for display
+func (cli *CLI) formatMacroSignature(name string) string {
+	params := cli.macroParams[name]
+	if len(params) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(params))
+	for _, p := range params {
+		switch {
+		case cli.macroRequired[name][p]:
+			parts = append(parts, p+":must")
+		case cli.macroDefaults[name][p] != "":
+			parts = append(parts, p+"="+cli.macroDefaults[name][p])
+		default:
+			parts = append(parts, p)
+		}
+	}
+	return "|" + strings.Join(parts, ",") + "|"
+}
+
+// defineMacro handles #def / #define
+func (cli *CLI) defineMacro(input string) {
+	matches := macroDefRegex.FindStringSubmatch(strings.TrimSpace(input))
+	if matches == nil {
+		core.PrintError("Invalid macro definition.\nExamples:\n  #def greet |name| -> #echo Hello $name!\n  #define scan |target:must,port=80| -> nmap -p $port $target")
+		return
+	}
+
+	name := matches[1]
+	if name == "def" || name == "define" || name == "undef" {
+		core.PrintError(fmt.Sprintf("'%s' is reserved and cannot be redefined", name))
+		return
+	}
+
+	m := macroFile{
+		Name:     name,
+		Template: strings.TrimSpace(matches[3]),
+		Defaults: make(map[string]string),
+	}
+
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(matches[2], ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		param := raw
+		required := false
+		if strings.HasSuffix(param, ":must") {
+			param = strings.TrimSuffix(param, ":must")
+			required = true
+		}
+		if key, def, found := strings.Cut(param, "="); found {
+			param = key
+			m.Defaults[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(def), `"'`)
+		}
+		param = strings.TrimSpace(param)
+
+		if !isValidIdentifier(param) {
+			core.PrintError(fmt.Sprintf("Invalid parameter name '%s' in macro '%s'", param, name))
+			return
+		}
+		if seen[param] {
+			core.PrintError(fmt.Sprintf("Duplicate parameter '%s' in macro '%s'", param, name))
+			return
+		}
+		seen[param] = true
+
+		m.Params = append(m.Params, param)
+		if required {
+			m.Required = append(m.Required, param)
+		}
+	}
+
+	_, existed := cli.macros[name]
+	cli.storeMacro(m)
+	if err := cli.saveMacros(); err != nil {
+		core.PrintWarning(fmt.Sprintf("Macro defined but could not be saved: %v", err))
+	}
+
+	switch {
+	case cli.builtinMacros[name]:
+		core.PrintSuccess(fmt.Sprintf("Macro '#%s' defined (overrides built-in)", name))
+	case existed:
+		core.PrintSuccess(fmt.Sprintf("Macro '#%s' redefined", name))
+	default:
+		core.PrintSuccess(fmt.Sprintf("Macro '#%s' defined", name))
+	}
+}
+
+// undefineMacro removes a user macro
+func (cli *CLI) undefineMacro(name string) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+	if _, exists := cli.macros[name]; !exists {
+		core.PrintError(fmt.Sprintf("Macro '#%s' is not defined", name))
+		return
+	}
+
+	delete(cli.macros, name)
+	delete(cli.macroParams, name)
+	delete(cli.macroRequired, name)
+	delete(cli.macroDefaults, name)
+
+	if err := cli.saveMacros(); err != nil {
+		core.PrintWarning(fmt.Sprintf("Could not save macros: %v", err))
+	}
+	core.PrintSuccess(fmt.Sprintf("Macro '#%s' removed", name))
+}
+
+// handleMacroCommand dispatches any input starting with '#'
+func (cli *CLI) handleMacroCommand(input string) {
+	input = strings.TrimSpace(input)
+
+	if isMacroDefinition(input) {
+		cli.defineMacro(input)
+		return
+	}
+
+	name, rest := splitMacroCall(input)
+	if name == "" {
+		core.PrintError("Missing macro name after '#'")
+		return
+	}
+
+	if name == "undef" {
+		cli.undefineMacro(rest)
+		return
+	}
+
+	// User macros take precedence so built-ins can be overridden
+	if _, exists := cli.macros[name]; exists {
+		cli.callMacro(name, rest)
+		return
+	}
+
+	if cli.handleBuiltinMacro(name, rest) {
+		return
+	}
+
+	core.PrintError(fmt.Sprintf("Unknown macro '#%s', see 'macros' for the defined ones", name))
+}
+
+// splitMacroCall splits "#name rest" or "#name(rest)" into its name and argument text
+func splitMacroCall(input string) (string, string) {
+	body := strings.TrimPrefix(input, "#")
+
+	end := 0
+	for end < len(body) && (isValidVarChar(rune(body[end])) || body[end] == '-') {
+		end++
+	}
+	name := body[:end]
+	rest := strings.TrimSpace(body[end:])
+
+	if strings.HasPrefix(rest, "(") && strings.HasSuffix(rest, ")") {
+		rest = rest[1 : len(rest)-1]
+	}
+	return name, rest
+}
+
+// callMacro binds arguments to a user macro and runs the expanded command
+func (cli *CLI) callMacro(name string, argText string) {
+	if cli.macroDepth >= maxMacroDepth {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Macro '#%s': macro recursion too deep (over %d calls)", name, maxMacroDepth))
+		return
+	}
+	cli.macroDepth++
+	defer func() { cli.macroDepth-- }()
+
+	params := cli.macroParams[name]
+	values := make(map[string]string)
+
+	// Arguments are split on spaces and commas, honouring quotes
+	args, err := lexWords(argText, cli.lookupVar, true)
+	if err != nil {
+		cli.printSyntaxError(err)
+		return
+	}
+
+	var positional []string
+	for _, arg := range args {
+		if arg.IsAssign() && containsParam(params, arg.Key) {
+			values[arg.Key] = arg.Val
+			continue
+		}
+		positional = append(positional, arg.Value)
+	}
+
+	// Positional values fill the parameters not given by name, in order;
+	// anything left over is appended to the last parameter
+	idx := 0
+	for _, p := range params {
+		if idx >= len(positional) {
+			break
+		}
+		if _, named := values[p]; named {
+			continue
+		}
+		values[p] = positional[idx]
+		idx++
+	}
+	if idx < len(positional) && len(params) > 0 {
+		last := params[len(params)-1]
+		values[last] = strings.TrimSpace(values[last] + " " + strings.Join(positional[idx:], " "))
+	}
+
+	for _, p := range params {
+		if _, ok := values[p]; !ok {
+			if def, hasDefault := cli.macroDefaults[name][p]; hasDefault {
+				values[p] = def
+			}
+		}
+	}
+
+	var missing []string
+	for _, p := range params {
+		if cli.macroRequired[name][p] && values[p] == "" {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		core.PrintError(fmt.Sprintf("Macro '#%s' requires parameter(s): %s", name, strings.Join(missing, ", ")))
+		fmt.Printf("   Usage: #%s %s\n\n", name, cli.formatMacroSignature(name))
+		return
+	}
+
+	cli.runMacroBody(expandMacroTemplate(cli.macros[name], params, values))
+}
+
+// expandMacroTemplate substitutes $param and ${param} in a macro body
+func expandMacroTemplate(template string, params []string, values map[string]string) string {
+	if len(params) == 0 {
+		return template
+	}
+
+	// Longest names first so $port never eats the prefix of $ports
+	sorted := append([]string{}, params...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	pairs := make([]string, 0, 4*len(sorted))
+	for _, p := range sorted {
+		pairs = append(pairs, "${"+p+"}", values[p], "$"+p, values[p])
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// runMacroBody executes an expanded macro body. Bodies that are not lmv
+// commands (e.g. "nmap -p 80 host") are handed to the system shell
+func (cli *CLI) runMacroBody(body string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return
+	}
+	if cli.isLmvCommand(body) {
+		cli.ExecuteCommand(body)
+		return
+	}
+	cli.ExecuteShellCommand(body)
+}
+
+// isLmvCommand reports whether input would be understood by ExecuteCommand
+// without falling through to "unknown module"
+func (cli *CLI) isLmvCommand(input string) bool {
+	if strings.HasPrefix(input, "#") || strings.HasPrefix(input, "$") || strings.HasPrefix(input, "for ") {
+		return true
+	}
+
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	first := fields[0]
+
+	if strings.Contains(first, "=") && len(fields) == 1 {
+		return true
+	}
+	if isCLIKeyword(first) {
+		return true
+	}
+	if _, err := cli.manager.GetModule(strings.TrimSuffix(first, "!")); err == nil {
+		return true
+	}
+	return false
+}
+
+// isCLIKeyword reports whether word is one of the ExecuteCommand built-in commands
+func isCLIKeyword(word string) bool {
+	switch word {
+	case "help", "h", "?", "list", "ls", "env", "envs", "search", "info", "run",
+		"create", "new", "edit", "delete", "remove", "rm", "history", "clear", "cls",
+		"refresh", "reload", "exit", "quit", "q", "macros", "wrap", "wrappers",
+		"jobs", "fg", "kill", "wait", "output", "runs", "rerun", "source", ".", "workspace",
+		"set", "setg", "unset", "secret", "secrets", "module", "modules":
+		return true
+	}
+	return false
+}
+
+// handleBuiltinMacro returns true if the macro was handled (built-in), false otherwise
+func (cli *CLI) handleBuiltinMacro(name string, rest string) bool {
+	switch name {
+	case "echo":
+		fmt.Fprintln(cli.out(), cli.expandValue(unquote(rest)))
+	case "pwd":
+		fmt.Println(CurrentDir)
+	case "whoami":
+		if u, err := user.Current(); err == nil {
+			fmt.Println(u.Username)
+		}
+	case "date":
+		fmt.Println(time.Now().Format("Mon Jan 2 15:04:05 MST 2006"))
+	case "clear", "cls":
+		cli.ClearScreen()
+	case "value":
+		varName := strings.TrimPrefix(strings.TrimSpace(rest), "$")
+		if varName == "" {
+			core.PrintError("Usage: #value $VAR")
+			return true
+		}
+		value := cli.expandVariable(varName)
+		if value == "$"+varName {
+			core.PrintWarning(fmt.Sprintf("Variable '%s' not set", varName))
+			return true
+		}
+		fmt.Printf("   %s = %s\n", core.Color("cyan", varName), core.Color("green", cli.shownValue(varName, value)))
+	case "set":
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			core.PrintError("Usage: #set <name> <value>")
+			return true
+		}
+		value := cli.expandValue(unquote(strings.Join(fields[1:], " ")))
+		if _, err := cli.saveVar(fields[0], value); err != nil {
+			core.PrintError(fmt.Sprintf("Failed to set variable: %v", err))
+			return true
+		}
+		core.PrintSuccess(fmt.Sprintf("Set %s = %s", fields[0], cli.shownValue(fields[0], value)))
+	case "if":
+		cli.builtinIf(rest)
+	case "else":
+		core.PrintError("#else must follow an #if: #if cond -> command #else command")
+	default:
+		return false
+	}
+	return true
+}
+
+// builtinIf implements: #if cond -> command [#else command]
+func (cli *CLI) builtinIf(rest string) {
+	cond, body, found := strings.Cut(rest, "->")
+	if !found {
+		core.PrintError("Usage: #if cond -> command [#else command]")
+		return
+	}
+
+	thenPart, elsePart, _ := strings.Cut(body, "#else")
+	truthy, _ := core.ParseBool(cli.expandValue(unquote(strings.TrimSpace(cond))))
+
+	if truthy {
+		cli.runMacroBody(thenPart)
+	} else if strings.TrimSpace(elsePart) != "" {
+		cli.runMacroBody(elsePart)
+	}
+}
+
+// ListMacros handles the `macros` command: list, show <name>, undef <name>
+func (cli *CLI) ListMacros(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list", "ls":
+			// fall through to the listing below
+		case "show":
+			if len(args) < 2 {
+				core.PrintError("Usage: macros show <name>")
+				return
+			}
+			cli.showMacro(strings.TrimPrefix(args[1], "#"))
+			return
+		case "undef", "rm", "delete":
+			if len(args) < 2 {
+				core.PrintError("Usage: macros undef <name>")
+				return
+			}
+			cli.undefineMacro(args[1])
+			return
+		default:
+			core.PrintError("Usage: macros [list|show <name>|undef <name>]")
+			return
+		}
+	}
+
+	names := cli.macroNames()
+	fmt.Println()
+	if len(names) == 0 {
+		core.PrintWarning("No macros defined, use '#def name |param| -> command' to add one")
+	} else {
+		fmt.Println(core.NmapBox(fmt.Sprintf("MACROS (%d)", len(names))))
+		for i, name := range names {
+			prefix := "   ├─ "
+			if i == len(names)-1 {
+				prefix = "   └─ "
+			}
+			fmt.Printf("%s%s %s -> %s\n", prefix,
+				core.Color("cyan", "#"+name),
+				core.Color("magenta", cli.formatMacroSignature(name)),
+				core.Color("white", cli.macros[name]))
+		}
+	}
+
+	builtins := make([]string, 0, len(cli.builtinMacros))
+	for name := range cli.builtinMacros {
+		builtins = append(builtins, "#"+name)
+	}
+	sort.Strings(builtins)
+	fmt.Println()
+	fmt.Printf("   Built-in: %s\n", core.Color("green", strings.Join(builtins, " ")))
+	fmt.Println()
+}
+
+// showMacro prints a single macro definition
+func (cli *CLI) showMacro(name string) {
+	template, exists := cli.macros[name]
+	if !exists {
+		if cli.builtinMacros[name] {
+			core.PrintInfo(fmt.Sprintf("'#%s' is a built-in macro", name))
+			return
+		}
+		core.PrintError(fmt.Sprintf("Macro '#%s' is not defined", name))
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("MACRO: #%s", name)))
+	fmt.Printf("   ├─ %s #def %s %s -> %s\n", core.Color("white", "Definition:"), name, cli.formatMacroSignature(name), template)
+
+	params := cli.macroParams[name]
+	if len(params) == 0 {
+		fmt.Printf("   └─ %s none\n", core.Color("white", "Parameters:"))
+	} else {
+		fmt.Printf("   └─ %s\n", core.Color("white", "Parameters:"))
+		for i, p := range params {
+			prefix := "       ├─ "
+			if i == len(params)-1 {
+				prefix = "       └─ "
+			}
+			note := ""
+			if cli.macroRequired[name][p] {
+				note = core.Color("red", " [REQUIRED]")
+			} else if def, ok := cli.macroDefaults[name][p]; ok {
+				note = fmt.Sprintf(" (default: %s)", def)
+			}
+			fmt.Printf("%s%s%s\n", prefix, core.Color("green", p), note)
+		}
+	}
+	fmt.Println()
+}
+
+// unquote strips one pair of matching surrounding quotes
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// isValidIdentifier reports whether s is a non-empty variable name
+func isValidIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isValidVarChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsParam reports whether name is one of the macro's parameters
+func containsParam(params []string, name string) bool {
+	for _, p := range params {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
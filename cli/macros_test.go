@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestExpandMacroTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		params   []string
+		values   map[string]string
+		want     string
+	}{
+		{"#echo $host", []string{"host"}, map[string]string{"host": "10.0.0.1"}, "#echo 10.0.0.1"},
+		{"#echo ${host}:$port", []string{"host", "port"}, map[string]string{"host": "a", "port": "80"}, "#echo a:80"},
+		{"scan $ports $port", []string{"port", "ports"}, map[string]string{"port": "22", "ports": "1-1024"}, "scan 1-1024 22"},
+		{"#echo $missing", []string{"missing"}, map[string]string{}, "#echo "},
+		{"#echo $a", []string{"a", "b"}, map[string]string{"a": "$b", "b": "x"}, "#echo $b"}, // values are not expanded again
+		{"#echo $host", nil, nil, "#echo $host"},
+	}
+	for _, tt := range tests {
+		if got := expandMacroTemplate(tt.template, tt.params, tt.values); got != tt.want {
+			t.Errorf("expandMacroTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestMacroRecursionLimit(t *testing.T) {
+	cli := newTestCLI(t)
+
+	cli.ExecuteCommand("#def forever -> #forever")
+	cli.ExecuteCommand("#forever")
+	if cli.lastExit != 1 {
+		t.Errorf("exit = %d, want 1", cli.lastExit)
+	}
+	if cli.macroDepth != 0 {
+		t.Errorf("macro depth = %d after the call, want 0", cli.macroDepth)
+	}
+}
+
+// A trailing & belongs to the macro body, the definition is not a job
+func TestMacroDefinitionEndingInBackground(t *testing.T) {
+	cli := newTestCLI(t)
+
+	cli.ExecuteCommand("#def later |m| -> $ echo $m &")
+	if got, want := cli.macros["later"], "$ echo $m &"; got != want {
+		t.Errorf("macro body = %q, want %q", got, want)
+	}
+	if jobs := cli.jobs.list(); len(jobs) != 0 {
+		t.Errorf("defining the macro started %d jobs", len(jobs))
+	}
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -15,17 +16,20 @@ import (
 )
 
 // RunModule executes a module with provided arguments
-// RunModule executes a module with provided arguments
-func (cli *CLI) RunModule(moduleName string, args []string) {
+func (cli *CLI) RunModule(moduleName string, args []Word) {
 	module, err := cli.manager.GetModule(moduleName)
 	if err != nil {
-		core.PrintError(fmt.Sprintf("%v", err))
+		cli.lastExit = 127
+		if !cli.jsonError(err) {
+			core.PrintError(fmt.Sprintf("%v", err))
+		}
 		return
 	}
 
 	moduleArgs := make(map[string]string)
 	threads := 1
 	saveLog := false
+	opts := cli.execOptions()
 
 	parsedArgs := cli.parseArguments(args)
 
@@ -35,45 +39,78 @@ func (cli *CLI) RunModule(moduleName string, args []string) {
 			fmt.Sscanf(value, "%d", &threads)
 		case "save":
 			saveLog = value == "1" || value == "true" || value == "yes"
+		case "timeout":
+			if opts.Timeout, err = core.ParseTimeout(value); err != nil {
+				cli.lastExit = 2
+				if !cli.jsonError(err) {
+					core.PrintError(err.Error())
+				}
+				return
+			}
+			if opts.Timeout == 0 {
+				opts.Timeout = -1 // timeout=0 lifts any other limit
+			}
 		default:
 			moduleArgs[key] = value
 		}
 	}
 
-	for key, value := range cli.envMgr.GetAll() {
-		if _, exists := moduleArgs[key]; !exists {
-			moduleArgs[key] = value
+	cli.warnUnknownArguments(module, moduleArgs)
+
+	if value, _, ok := cli.lookupScoped("timeout"); ok && !cli.quiet && !cli.jsonOut {
+		if _, err := core.ParseTimeout(value); err != nil {
+			core.PrintWarning(fmt.Sprintf("Ignoring global timeout: %v", err))
 		}
 	}
 
-	if module.Metadata != nil && len(module.Metadata.Required) > 0 {
-		missing := []string{}
-		for _, req := range module.Metadata.Required {
-			if _, ok := moduleArgs[req]; !ok {
-				missing = append(missing, req)
-			}
+	if len(cli.moduleSecrets(moduleName)) > 0 && !cli.unlockSecrets() {
+		// Running without them would pass the module empty credentials
+		cli.lastExit = 1
+		return
+	}
+	for key, value := range cli.moduleVars(moduleName) {
+		// timeout is a setting for the CLI, not a module argument
+		if _, exists := moduleArgs[key]; !exists && key != "timeout" {
+			moduleArgs[key] = value
 		}
+	}
+	// The secrets are unlocked by now, so their values can be masked
+	opts.Redact = cli.secretValues()
 
-		if len(missing) > 0 {
-			fmt.Println()
-			core.PrintWarning(fmt.Sprintf("Module '%s' requires arguments, skipping...", moduleName))
-			fmt.Println()
-			fmt.Println(core.NmapBox(fmt.Sprintf("MODULE: %s - USAGE", moduleName)))
-			fmt.Printf("   Description: %s\n\n", module.Metadata.Description)
-
-			fmt.Println("   Required Arguments:")
-			for _, opt := range missing {
-				if meta, ok := module.Metadata.Options[opt]; ok {
-					fmt.Printf("      * %s (%s) - %s\n", opt, meta.Type, meta.Description)
-				}
-			}
+	moduleArgs, err = cli.manager.PrepareArguments(moduleName, moduleArgs, CurrentDir)
+	if err != nil {
+		cli.lastExit = 2
+		cli.printArgumentErrors(module, err)
+		return
+	}
 
-			fmt.Printf("\n   Example Usage:\n")
-			fmt.Printf("      %s %s=value\n\n", moduleName, missing[0])
-			return
+	cli.executeModule(moduleName, moduleArgs, threads, saveLog, opts)
+}
+
+// warnUnknownArguments points out arguments given to a module that does not
+// declare them. They are not passed on, and are most often typos
+func (cli *CLI) warnUnknownArguments(module *core.ModuleConfig, args map[string]string) {
+	if cli.quiet || cli.jsonOut {
+		return
+	}
+	for _, name := range core.UnknownArguments(module.Metadata, args) {
+		msg := fmt.Sprintf("Module '%s' has no option '%s' (not passed on)", module.Name, name)
+		if suggestion := module.Metadata.Suggest(name); suggestion != "" {
+			msg += fmt.Sprintf(", did you mean '%s'?", suggestion)
 		}
+		core.PrintWarning(msg)
 	}
+}
 
+// executeModule runs a module with prepared arguments, reports the outcome
+// and records the run in the run history
+func (cli *CLI) executeModule(moduleName string, moduleArgs map[string]string, threads int, saveLog bool, opts core.ExecOptions) {
+	if cli.jsonOut {
+		cli.executeModuleJSON(moduleName, moduleArgs, threads, opts)
+		return
+	}
+
+	var err error
 	if saveLog {
 		if err := cli.logger.EnableFileLogging(moduleName); err != nil {
 			core.PrintWarning(fmt.Sprintf("Could not enable file logging: %v", err))
@@ -83,42 +120,58 @@ func (cli *CLI) RunModule(moduleName string, args []string) {
 
 	startTime := time.Now()
 
-	fmt.Println()
-	if threads > 1 {
-		core.PrintInfo(fmt.Sprintf(
-			"Executing module '%s' with %d threads...",
-			core.Color("cyan", moduleName), threads))
-	} else {
-		core.PrintInfo(fmt.Sprintf(
-			"Executing module '%s'...",
-			core.Color("cyan", moduleName)))
-	}
-	if saveLog {
-		core.PrintSuccess(fmt.Sprintf("Output saved to: %s", cli.logger.GetFilePath()))
+	if !cli.quiet {
+		fmt.Println()
+		if threads > 1 {
+			core.PrintInfo(fmt.Sprintf(
+				"Executing module '%s' with %d threads...",
+				core.Color("cyan", moduleName), threads))
+		} else {
+			core.PrintInfo(fmt.Sprintf(
+				"Executing module '%s'...",
+				core.Color("cyan", moduleName)))
+		}
+		if saveLog {
+			core.PrintSuccess(fmt.Sprintf("Output saved to: %s", cli.logger.GetFilePath()))
+		}
+		fmt.Println()
 	}
-	fmt.Println()
-
-	cli.startModuleExecution()
-	defer cli.stopModuleExecution()
 
 	var result *core.ExecutionResult
 
 	if threads > 1 {
-		result, err = cli.runModuleThreaded(moduleName, moduleArgs, threads)
+		result, err = cli.runModuleThreaded(moduleName, moduleArgs, threads, opts.Timeout)
 	} else {
-		result, err = cli.manager.ExecuteModule(moduleName, moduleArgs)
+		events := cli.eventRenderer(moduleName)
+		opts.OnEvent = events.render
+		result, err = cli.manager.ExecuteModuleWith(moduleName, moduleArgs, opts)
+		events.finish()
 	}
 
 	if err != nil {
+		cli.lastExit = 1
 		core.PrintError(fmt.Sprintf("%v", err))
 		return
 	}
 
 	duration := time.Since(startTime)
+	cli.recordRun(moduleName, moduleArgs, threads, opts.Timeout, startTime, result)
+	cli.lastExit = result.ExitCode
+	if result.Interrupted {
+		cli.lastExit = exitInterrupted
+	} else if result.TimedOut {
+		cli.lastExit = exitTimedOut
+	} else if !result.Success && cli.lastExit == 0 {
+		cli.lastExit = 1
+	}
 
-	if result.Output != "" {
+	// Single runs were streamed live; only threaded runs are replayed here
+	if threads > 1 && cli.redirected() {
+		writeLines(cli.out(), result.Output)
+		writeLines(cli.errOut(), result.Stderr)
+	} else if threads > 1 && (result.Output != "" || result.Stderr != "") {
 		fmt.Println(core.NmapBox("Output"))
-		for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+		for _, line := range strings.Split(strings.TrimSpace(result.Output+"\n"+result.Stderr), "\n") {
 			if line != "" {
 				fmt.Println(core.NmapSubBox(line))
 			}
@@ -126,7 +179,24 @@ func (cli *CLI) RunModule(moduleName string, args []string) {
 		fmt.Println()
 	}
 
-	if result.Error != "" {
+	cli.printFindings(core.Findings(result.Events), result.Output)
+	cli.logger.LogOutput(result)
+
+	if result.Truncated {
+		core.PrintWarning(fmt.Sprintf("Captured output exceeded %d bytes per stream and was truncated", core.DefaultCaptureLimit))
+	}
+
+	if cli.quiet {
+		// Parallel loop iterations report their own status line,
+		// including the exit code
+		if result.Error != "" && !result.Interrupted && !result.TimedOut && !strings.HasPrefix(result.Error, "exit status") {
+			fmt.Fprintln(cli.errOut(), result.Error)
+		}
+		return
+	}
+
+	// A module stopped with Ctrl+C only has "signal: interrupt" to show
+	if result.Error != "" && !result.Interrupted && !result.TimedOut {
 		core.PrintError("Error Output:")
 		for _, line := range strings.Split(result.Error, "\n") {
 			if line != "" {
@@ -136,7 +206,13 @@ func (cli *CLI) RunModule(moduleName string, args []string) {
 		fmt.Println()
 	}
 
-	if result.Success {
+	if result.Interrupted {
+		core.PrintWarning(fmt.Sprintf(
+			"Interrupted after %s [exit: %d]", duration, result.ExitCode))
+	} else if result.TimedOut {
+		core.PrintError(fmt.Sprintf(
+			"Timed out after %s [exit: %d]", duration, result.ExitCode))
+	} else if result.Success {
 		core.PrintSuccess(fmt.Sprintf(
 			"Completed in %s [exit: %d]", duration, result.ExitCode))
 	} else {
@@ -146,8 +222,86 @@ func (cli *CLI) RunModule(moduleName string, args []string) {
 	fmt.Println()
 }
 
+// executeModuleJSON runs a module for --json: its output is captured, not
+// shown, and the run is printed as one JSON object once it ends
+func (cli *CLI) executeModuleJSON(moduleName string, moduleArgs map[string]string, threads int, opts core.ExecOptions) {
+	startTime := time.Now()
+
+	var result *core.ExecutionResult
+	var err error
+	if threads > 1 {
+		result, err = cli.runModuleThreaded(moduleName, moduleArgs, threads, opts.Timeout)
+	} else {
+		runOpts := cli.runOptions()
+		runOpts.Timeout = opts.Timeout
+		runOpts.Stdin, runOpts.Foreground = opts.Stdin, opts.Foreground
+		result, err = cli.manager.ExecuteModuleWith(moduleName, moduleArgs, runOpts)
+	}
+	if err != nil {
+		cli.lastExit = 1
+		cli.jsonError(err)
+		return
+	}
+
+	rec := cli.recordRun(moduleName, moduleArgs, threads, opts.Timeout, startTime, result)
+	cli.lastExit = result.ExitCode
+	if result.Interrupted {
+		cli.lastExit = exitInterrupted
+	} else if result.TimedOut {
+		cli.lastExit = exitTimedOut
+	} else if !result.Success && cli.lastExit == 0 {
+		cli.lastExit = 1
+	}
+	cli.printJSON(newRunJSON(rec))
+}
+
+// printArgumentErrors renders option validation failures, one line per option
+func (cli *CLI) printArgumentErrors(module *core.ModuleConfig, err error) {
+	if cli.jsonError(err) {
+		return
+	}
+	errs, ok := err.(core.ValidationErrors)
+	if !ok {
+		core.PrintError(fmt.Sprintf("%v", err))
+		return
+	}
+
+	fmt.Println()
+	core.PrintWarning(fmt.Sprintf("Module '%s' received invalid arguments, skipping...", module.Name))
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("MODULE: %s - USAGE", module.Name)))
+	if module.Metadata != nil {
+		fmt.Printf("   Description: %s\n\n", module.Metadata.Description)
+	}
+
+	fmt.Println("   Problems:")
+	for _, e := range errs {
+		optType := "string"
+		desc := ""
+		if module.Metadata != nil {
+			if meta, ok := module.Metadata.Options[e.Option]; ok {
+				if meta.Type != "" {
+					optType = meta.Type
+				}
+				desc = meta.Description
+			}
+		}
+		value := ""
+		if e.Value != "" {
+			value = fmt.Sprintf(" = %q", e.Value)
+		}
+		fmt.Printf("      * %s (%s)%s - %s\n", core.Color("cyan", e.Option), optType, value, core.Color("red", e.Reason))
+		if desc != "" {
+			fmt.Printf("        %s\n", desc)
+		}
+	}
+
+	fmt.Printf("\n   Example Usage:\n")
+	fmt.Printf("      %s %s=value\n\n", module.Name, errs[0].Option)
+}
+
 // runModuleThreaded executes a module with multiple threads
-func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, threads int) (*core.ExecutionResult, error) {
+func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, threads int, timeout time.Duration) (*core.ExecutionResult, error) {
 	_, err := cli.manager.GetModule(moduleName)
 	if err != nil {
 		return nil, err
@@ -155,7 +309,7 @@ func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, thr
 
 	var wg sync.WaitGroup
 	results := make(chan *core.ExecutionResult, threads)
-	var outputs []string
+	var outputs, stderrs []string
 	var mu sync.Mutex
 
 	wg.Add(threads)
@@ -163,10 +317,16 @@ func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, thr
 	for i := 0; i < threads; i++ {
 		go func(threadID int) {
 			defer wg.Done()
-			result, _ := cli.manager.ExecuteModule(moduleName, args)
+			// Threads capture without streaming so their output does not interleave
+			opts := cli.runOptions()
+			opts.Timeout = timeout
+			result, _ := cli.manager.ExecuteModuleWith(moduleName, args, opts)
 			if result != nil {
 				mu.Lock()
-				outputs = append(outputs, fmt.Sprintf("[Thread : %d] %s", threadID, result.Output))
+				outputs = append(outputs, fmt.Sprintf("[Thread : %d] %s", threadID, strings.TrimSpace(result.Output)))
+				if result.Stderr != "" {
+					stderrs = append(stderrs, fmt.Sprintf("[Thread : %d] stderr: %s", threadID, strings.TrimSpace(result.Stderr)))
+				}
 				mu.Unlock()
 			}
 			results <- result
@@ -186,18 +346,41 @@ func (cli *CLI) runModuleThreaded(moduleName string, args map[string]string, thr
 	}
 
 	for result := range results {
-		if result != nil && !result.Success {
+		if result == nil {
+			continue
+		}
+		if !result.Success {
 			finalResult.Success = false
+			finalResult.ExitCode = result.ExitCode
+		}
+		if result.Truncated {
+			finalResult.Truncated = true
+		}
+		if result.Interrupted {
+			finalResult.Interrupted = true
 		}
+		if result.TimedOut {
+			finalResult.TimedOut = true
+		}
+		finalResult.Events = append(finalResult.Events, result.Events...)
 	}
 
 	mu.Lock()
 	finalResult.Output = strings.Join(outputs, "\n")
+	finalResult.Stderr = strings.Join(stderrs, "\n")
 	mu.Unlock()
 
 	return finalResult, nil
 }
 
+// writeLines writes text to w with a trailing newline, if there is any text
+func writeLines(w io.Writer, text string) {
+	text = strings.TrimSpace(text)
+	if text != "" {
+		fmt.Fprintln(w, text)
+	}
+}
+
 // CreateModule creates a new module
 func (cli *CLI) CreateModule(moduleName string, args []string) {
 	moduleType := "python"
@@ -205,8 +388,8 @@ func (cli *CLI) CreateModule(moduleName string, args []string) {
 		moduleType = strings.ToLower(args[0])
 	}
 
-	if moduleType != "python" && moduleType != "bash" {
-		core.PrintError("Invalid type. Use 'python' or 'bash', default is 'python'")
+	if moduleType != "python" && moduleType != "bash" && moduleType != "go" {
+		core.PrintError("Invalid type. Use 'python', 'bash' or 'go', default is 'python'")
 		return
 	}
 
@@ -237,6 +420,10 @@ options:
     type: string
     description: Target parameter
     required: true
+  port:
+    type: port
+    description: Target port
+    default: "80"
 required:
   - target
 `, moduleName, moduleType)
@@ -258,24 +445,47 @@ Module: ` + moduleName + `
 Description: Your module description
 """
 
-import os
-import sys
+import lmv
 
 def main():
-    # Get arguments from environment variables
-    target = os.getenv('ARG_TARGET') or 'localhost'
-    
-    print(f"[*] Module executing on {target}")
-    
+    # Options from module.yaml, converted to their declared types
+    opts = lmv.options()
+
+    lmv.info(f"Module executing on {opts.target}:{opts.port}")
+
     try:
-        # Your code here
-        print("[+] Module completed successfully!")
+        # Your code here; report each result as a finding
+        lmv.finding(host=opts.target, port=opts.port, state="checked")
     except Exception as e:
-        print(f"[!] Error: {e}")
-        sys.exit(1)
+        lmv.fail(f"Error: {e}")
 
 if __name__ == '__main__':
     main()
+`
+	} else if moduleType == "go" {
+		scriptName = "main.go"
+		scriptContent = `// Module: ` + moduleName + `
+// Description: Your module description
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	// Get arguments from environment variables
+	target := os.Getenv("ARG_TARGET")
+	if target == "" {
+		target = "localhost"
+	}
+
+	fmt.Printf("[*] Module executing on %s\n", target)
+
+	// Your code here
+
+	fmt.Println("[+] Module completed successfully!")
+}
 `
 	} else {
 		scriptName = "main.sh"
@@ -283,13 +493,15 @@ if __name__ == '__main__':
 # Module: ` + moduleName + `
 # Description: Your module description
 
-TARGET="${ARG_TARGET:-localhost}"
+source "$LMV_SDK/lmv.sh"
 
-echo "[*] Module executing on $TARGET"
+TARGET="$(lmv_opt target localhost)"
+PORT="$(lmv_opt port 80)"
 
-# Your code here
+lmv_info "Module executing on $TARGET:$PORT"
 
-echo "[+] Module completed successfully!"
+# Your code here; report each result as a finding
+lmv_finding host="$TARGET" port="$PORT" state=checked
 `
 	}
 
@@ -317,7 +529,7 @@ func (cli *CLI) EditModule(moduleName string) {
 		editor = "nano"
 	}
 
-	core.PrintInfo(fmt.Sprintf("Edit module '%s' (directory: %s), using editor: %s, press Ctrl+X to save", moduleName, module.Path))
+	core.PrintInfo(fmt.Sprintf("Edit module '%s' (directory: %s), using editor: %s, press Ctrl+X to save", moduleName, module.Path, editor))
 	fmt.Println()
 
 	files, err := ioutil.ReadDir(module.Path)
@@ -382,67 +594,27 @@ func (cli *CLI) DeleteModule(moduleName string) {
 	fmt.Println()
 }
 
-// parseArguments parses command-line arguments with support for quoted strings and variable expansion
-// Supports:
+// parseArguments turns lexed words into module arguments. Quotes and $var
+// references were already handled by the lexer. Supports:
 //   - arg="value with spaces", arg='value', arg=value
-//   - arg=$some_var (expand variable)
-//   - arg=$(builtin_func arg1 arg2) (execute builtin function)
-func (cli *CLI) parseArguments(args []string) map[string]string {
+//   - arg = value (spaces around '=')
+//   - positional values, passed as arg0, arg1, ...
+func (cli *CLI) parseArguments(args []Word) map[string]string {
 	result := make(map[string]string)
 	i := 0
 
 	for i < len(args) {
 		arg := args[i]
 
-		// Check if it's a key=value pair
-		if strings.Contains(arg, "=") {
-			parts := strings.SplitN(arg, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				// Handle quoted values
-				if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-					(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-					// Remove quotes
-					value = value[1 : len(value)-1]
-				} else if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'") {
-					// Handle quoted value that spans multiple args
-					quote := value[0]
-					value = value[1:]
-
-					// Collect remaining parts until closing quote
-					for i++; i < len(args); i++ {
-						value += " " + args[i]
-						if strings.HasSuffix(args[i], string(quote)) {
-							value = value[:len(value)-1] // Remove closing quote
-							break
-						}
-					}
-				}
-
-				// Expand variables and builtins in the value
-				value = cli.expandValue(value)
-				result[key] = value
-			}
-		} else if i+2 < len(args) && args[i+1] == "=" {
+		if arg.IsAssign() {
+			result[arg.Key] = arg.Val
+		} else if i+2 < len(args) && args[i+1].Value == "=" && !args[i+1].Quoted && isValidIdentifier(arg.Value) {
 			// Handle "key = value" format
-			key := strings.TrimSpace(arg)
-			value := strings.TrimSpace(args[i+2])
-
-			// Handle quoted values
-			if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-				(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-				value = value[1 : len(value)-1]
-			}
-
-			// Expand variables and builtins in the value
-			value = cli.expandValue(value)
-			result[key] = value
+			result[arg.Value] = args[i+2].Value
 			i += 2 // Skip the = and value
 		} else {
 			// Positional argument
-			result[fmt.Sprintf("arg%d", i)] = arg
+			result[fmt.Sprintf("arg%d", i)] = arg.Value
 		}
 
 		i++
@@ -469,13 +641,8 @@ func (cli *CLI) expandVariables(value string) string {
 	return variablePattern.ReplaceAllStringFunc(value, func(match string) string {
 		varName := match[1:] // Remove the $
 
-		// First check global environment variables
-		if val, exists := cli.envMgr.Get(varName); exists {
-			return val
-		}
-
-		// Then check system environment variables
-		if val, exists := os.LookupEnv(varName); exists {
+		// Session, global, then system environment variables
+		if val, exists := cli.lookupVar(varName); exists {
 			return val
 		}
 
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// ModuleCommand handles `module [list|install|update|remove|repos]`, the
+// module package manager. --force (or -f) anywhere overwrites or removes
+// modules changed since they were installed
+func (cli *CLI) ModuleCommand(args []string) {
+	usage := "Usage: module [list | repos | install <source> [module...] | update [module...] | remove <module>...] [--force]"
+	force := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--force" || arg == "-f" {
+			force = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	args = rest
+
+	if len(args) == 0 || args[0] == "list" || args[0] == "ls" {
+		cli.listInstalledModules()
+		return
+	}
+
+	switch args[0] {
+	case "repos":
+		cli.listRepos()
+
+	case "install", "add":
+		if len(args) < 2 {
+			cli.usageError(usage)
+			return
+		}
+		src, err := cli.manager.ResolveSource(args[1], CurrentDir)
+		if err != nil {
+			cli.moduleError(err)
+			return
+		}
+		if !cli.quiet && !cli.jsonOut {
+			core.PrintInfo(fmt.Sprintf("Installing from %s (%s)...", src, src.Kind))
+		}
+		results, err := cli.manager.Install(src, args[2:], force)
+		cli.reportInstall(results, err)
+
+	case "update", "upgrade":
+		if !cli.quiet && !cli.jsonOut {
+			core.PrintInfo("Updating modules...")
+		}
+		results, err := cli.manager.Update(args[1:], force)
+		if err == nil && len(results) == 0 && !cli.jsonOut {
+			core.PrintWarning("No modules installed with 'module install'")
+			return
+		}
+		cli.reportInstall(results, err)
+
+	case "remove", "rm", "uninstall":
+		if len(args) < 2 {
+			cli.usageError(usage)
+			return
+		}
+		var results []core.InstallResult
+		for _, name := range args[1:] {
+			result := core.InstallResult{Module: name, Status: "removed"}
+			if err := cli.manager.Remove(name, force); err != nil {
+				result.Status, result.Error = "failed", err.Error()
+			}
+			results = append(results, result)
+		}
+		cli.reportInstall(results, nil)
+
+	default:
+		cli.usageError(fmt.Sprintf("Unknown module command '%s', use list, repos, install, update or remove", args[0]))
+	}
+}
+
+// moduleError reports a failed module command, exit status 1
+func (cli *CLI) moduleError(err error) {
+	cli.lastExit = 1
+	if !cli.jsonError(err) {
+		core.PrintError(err.Error())
+	}
+}
+
+// reportInstall prints what became of each module and loads the modules
+// again, so the changes are usable right away
+func (cli *CLI) reportInstall(results []core.InstallResult, err error) {
+	if len(results) > 0 {
+		cli.reloadModules()
+	}
+	if err != nil {
+		cli.moduleError(err)
+		return
+	}
+	for _, result := range results {
+		if result.Failed() {
+			cli.lastExit = 1
+		}
+	}
+	if cli.jsonOut {
+		cli.printJSON(results)
+		return
+	}
+
+	for _, result := range results {
+		name := core.Color("cyan", result.Module)
+		switch {
+		case result.Failed():
+			core.PrintError(fmt.Sprintf("%s: %s", name, result.Error))
+		case result.Status == "updated" && result.OldVersion != result.Version:
+			core.PrintSuccess(fmt.Sprintf("%s: updated %s → %s%s", name, versionText(result.OldVersion), versionText(result.Version), commitText(result.Commit)))
+		case result.Status == "removed":
+			core.PrintSuccess(fmt.Sprintf("%s: removed", name))
+		default:
+			core.PrintSuccess(fmt.Sprintf("%s: %s %s%s", name, result.Status, versionText(result.Version), commitText(result.Commit)))
+		}
+	}
+	fmt.Println()
+}
+
+func versionText(version string) string {
+	if version == "" {
+		return "(no version)"
+	}
+	return version
+}
+
+func commitText(commit string) string {
+	if commit == "" {
+		return ""
+	}
+	return " @ " + shortCommit(commit)
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 10 {
+		return commit[:10]
+	}
+	return commit
+}
+
+// reloadModules discovers the modules again, keeping the manager and its
+// settings
+func (cli *CLI) reloadModules() {
+	cli.manager.Modules = make(map[string]*core.ModuleConfig)
+	if err := cli.manager.DiscoverModules(); err != nil {
+		core.PrintError(fmt.Sprintf("Failed to load modules: %v", err))
+	}
+}
+
+// installedModule is a module as printed by `module list`
+type installedModule struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Version string `json:"version,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+}
+
+// listInstalledModules lists every module directory and lockfile entry
+// with where it came from and whether it changed since
+func (cli *CLI) listInstalledModules() {
+	lock, err := cli.manager.LoadLock()
+	if err != nil {
+		cli.moduleError(err)
+		return
+	}
+
+	names := make(map[string]bool)
+	for name := range lock.Modules {
+		names[name] = true
+	}
+	entries, _ := os.ReadDir(cli.manager.ModulesDir)
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names[entry.Name()] = true
+		}
+	}
+
+	list := make([]installedModule, 0, len(names))
+	for name := range names {
+		m := installedModule{Name: name, State: cli.manager.ModuleState(lock, name)}
+		if entry := lock.Modules[name]; entry != nil {
+			m.Source, m.Commit, m.Version = entry.Source.String(), entry.Commit, entry.Version
+		} else if module, ok := cli.manager.Modules[name]; ok && module.Metadata != nil {
+			m.Version = module.Metadata.Version
+		}
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	if cli.jsonOut {
+		cli.printJSON(list)
+		return
+	}
+	if len(list) == 0 {
+		core.PrintWarning(fmt.Sprintf("No modules in %s, install some with: module install <source>", cli.manager.ModulesDir))
+		fmt.Println()
+		return
+	}
+
+	table := core.NewTable([]string{"Module", "Version", "State", "Source", "Commit"})
+	for _, m := range list {
+		table.AddRow(m.Name, m.Version, m.State, m.Source, shortCommit(m.Commit))
+	}
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("MODULES: %s", cli.manager.ModulesDir)))
+	fmt.Println(table.Render())
+	fmt.Println()
+}
+
+// listRepos lists the repositories of repo_url.yaml
+func (cli *CLI) listRepos() {
+	repos, err := cli.manager.LoadRepos()
+	if err != nil {
+		cli.moduleError(err)
+		return
+	}
+	if cli.jsonOut {
+		cli.printJSON(repos)
+		return
+	}
+	if len(repos) == 0 {
+		core.PrintWarning(fmt.Sprintf("No repositories in %s", filepath.Join(cli.manager.ModulesDir, core.RepoFile)))
+		fmt.Println()
+		return
+	}
+
+	names := make([]string, 0, len(repos))
+	for name := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	table := core.NewTable([]string{"Repository", "URL"})
+	for _, name := range names {
+		table.AddRow(name, repos[name])
+	}
+	fmt.Println()
+	fmt.Println(core.NmapBox("REPOSITORIES"))
+	fmt.Println(table.Render())
+	fmt.Println()
+}
@@ -0,0 +1,525 @@
+package cli
+
+import (
+	"strconv"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Node is a parsed lmv statement or pipeline stage
+type Node interface {
+	node()
+}
+
+// AssignNode is key=value (set a variable) or key=? (query it)
+type AssignNode struct {
+	Key   string
+	Value string
+	Query bool
+}
+
+// CommandNode is a built-in command or module invocation: name arg...
+type CommandNode struct {
+	Name string
+	Args []Word
+	Pos  int
+}
+
+// LiteralNode is a quoted string used as a pipe stage
+type LiteralNode struct {
+	Value string
+}
+
+// ShellNode is a $-prefixed command handed to the system shell verbatim
+type ShellNode struct {
+	Command string
+}
+
+// MacroNode is any #-prefixed statement; the macro engine parses it itself
+type MacroNode struct {
+	Raw string
+}
+
+// PipelineNode is stage |> stage |> ...
+type PipelineNode struct {
+	Stages []Node
+}
+
+// ForVar binds one loop variable to its source
+type ForVar struct {
+	Name   string
+	Source string // unquoted source text, e.g. "1..10" or "admin|root"
+}
+
+// ForNode is: for [$]var in SOURCE [, var in SOURCE ...] [options] -> BODY
+type ForNode struct {
+	Vars []ForVar
+	Zip  bool   // zip pairs the sources instead of taking their cartesian product
+	Body string // raw body text, re-parsed for every iteration
+
+	Parallel    int  // parallel=N or &N, 1 runs iterations one by one
+	AsCompleted bool // order=completed prints results as they finish
+	FailFast    bool // failfast=true stops at the first failed iteration
+}
+
+// BackgroundNode runs a statement as a background job: stmt &
+type BackgroundNode struct {
+	Stmt   Node
+	Source string // raw text of Stmt, shown in the job table
+}
+
+// RedirectNode sends a statement's output to a file: stmt > file
+type RedirectNode struct {
+	Stmt   Node
+	Source string // raw text of Stmt
+	Op     string // > >> 2> 2>> &> &>>
+	Target string
+}
+
+// CaptureNode keeps a statement's output in a session variable: name := stmt
+type CaptureNode struct {
+	Name   string
+	Stmt   Node
+	Source string // raw text of Stmt
+}
+
+func (*AssignNode) node()     {}
+func (*CommandNode) node()    {}
+func (*LiteralNode) node()    {}
+func (*ShellNode) node()      {}
+func (*MacroNode) node()      {}
+func (*PipelineNode) node()   {}
+func (*ForNode) node()        {}
+func (*RedirectNode) node()   {}
+func (*BackgroundNode) node() {}
+func (*CaptureNode) node()    {}
+
+// Parser builds an AST from one line of lmv input. Tokens are pulled from
+// the lexer on demand, so loop bodies and shell text are never lexed here
+type Parser struct {
+	input  string
+	lx     *Lexer
+	tokens []Token
+	pos    int
+	err    error // first lexing error, reported in preference to parse errors
+}
+
+// ParseCommand parses one line of lmv input. Variables are expanded with
+// expand while lexing; loop and macro bodies are kept raw so they can be
+// expanded later
+func ParseCommand(input string, expand VarLookup) (Node, error) {
+	input = strings.TrimSpace(input)
+
+	// A macro definition keeps its body as typed, a trailing & included
+	if isMacroDefinition(input) {
+		return &MacroNode{Raw: input}, nil
+	}
+
+	// A trailing standalone & runs the whole statement as a job. "&4" (a
+	// loop option) and "&>" (a redirect) are left alone
+	if rest, ok := cutBackground(input); ok {
+		if rest == "" {
+			return nil, &SyntaxError{Input: input, Pos: len(input) - 1, Msg: "missing command before &"}
+		}
+		// A job runs apart from the session, where a capture would be lost
+		if _, _, capture := cutCapture(rest); capture {
+			return nil, &SyntaxError{Input: input, Pos: len(input) - 1, Msg: "cannot capture the output of a background job"}
+		}
+		stmt, err := ParseCommand(rest, expand)
+		if err != nil {
+			return nil, err
+		}
+		return &BackgroundNode{Stmt: stmt, Source: rest}, nil
+	}
+
+	// name := statement keeps the statement's output in $name
+	if name, rest, ok := cutCapture(input); ok {
+		if rest == "" {
+			return nil, &SyntaxError{Input: input, Pos: len(input), Msg: "missing command after :="}
+		}
+		stmt, err := ParseCommand(rest, expand)
+		if err != nil {
+			return nil, err
+		}
+		return &CaptureNode{Name: name, Stmt: stmt, Source: rest}, nil
+	}
+
+	// Macros have their own grammar (|params|, #name(args), #if ... -> ...)
+	if strings.HasPrefix(input, "#") {
+		return &MacroNode{Raw: input}, nil
+	}
+
+	p := &Parser{input: input, lx: NewLexer(input, expand)}
+	node, err := p.parseStatement()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return node, err
+}
+
+// isMacroDefinition reports whether input is #def or #define
+func isMacroDefinition(input string) bool {
+	return strings.HasPrefix(input, "#def ") || strings.HasPrefix(input, "#define ")
+}
+
+// cutBackground strips a trailing " &" from a statement
+func cutBackground(input string) (string, bool) {
+	if !strings.HasSuffix(input, "&") {
+		return input, false
+	}
+	rest := strings.TrimSuffix(input, "&")
+	if rest != "" && rest[len(rest)-1] != ' ' && rest[len(rest)-1] != '\t' {
+		return input, false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// cutCapture splits "name := statement"
+func cutCapture(input string) (string, string, bool) {
+	name, rest, found := strings.Cut(input, ":=")
+	name = strings.TrimSpace(name)
+	if !found || !isValidIdentifier(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+// peekAt returns the token n positions ahead without consuming it
+func (p *Parser) peekAt(n int) Token {
+	for len(p.tokens) <= p.pos+n {
+		if len(p.tokens) > 0 && p.tokens[len(p.tokens)-1].Kind == TokEOF {
+			return p.tokens[len(p.tokens)-1]
+		}
+		tok, err := p.lx.next()
+		if err != nil {
+			if p.err == nil {
+				p.err = err
+			}
+			tok = Token{Kind: TokEOF, Pos: len(p.input), End: len(p.input)}
+		}
+		p.tokens = append(p.tokens, tok)
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *Parser) peek() Token {
+	return p.peekAt(0)
+}
+
+func (p *Parser) advance() Token {
+	tok := p.peek()
+	if tok.Kind != TokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// skipTo drops any buffered lookahead and resumes lexing at a byte offset
+func (p *Parser) skipTo(offset int) {
+	p.tokens = p.tokens[:p.pos]
+	p.lx.pos = offset
+	p.err = nil
+}
+
+func (p *Parser) errorAt(pos int, msg string) error {
+	return &SyntaxError{Input: p.input, Pos: pos, Msg: msg}
+}
+
+// parseStatement := for-loop | assignment | pipeline [redirect]
+func (p *Parser) parseStatement() (Node, error) {
+	first := p.peek()
+
+	if first.Kind == TokWord && !first.Word.Quoted && first.Word.Value == "for" {
+		return p.parseFor()
+	}
+
+	// A lone key=value word sets a variable, key=? queries it
+	if first.Kind == TokWord && first.Word.IsAssign() && p.peekAt(1).Kind == TokEOF {
+		w := first.Word
+		return &AssignNode{Key: w.Key, Value: w.Val, Query: w.Val == "?" && !w.Quoted}, nil
+	}
+
+	stmtStart := first.Pos
+	stmt, err := p.parsePipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Kind == TokRedirect {
+		p.advance()
+		target := p.advance()
+		if target.Kind != TokWord || target.Word.Value == "" {
+			return nil, p.errorAt(target.Pos, "expected a file name after "+tok.Raw)
+		}
+		stmt = &RedirectNode{
+			Stmt:   stmt,
+			Source: strings.TrimSpace(p.input[stmtStart:tok.Pos]),
+			Op:     tok.Raw,
+			Target: target.Word.Value,
+		}
+		tok = p.peek()
+	}
+
+	if tok.Kind != TokEOF {
+		return nil, p.errorAt(tok.Pos, "unexpected "+tok.Kind.String())
+	}
+	return stmt, nil
+}
+
+// parsePipeline := stage ('|>' stage)*
+func (p *Parser) parsePipeline() (Node, error) {
+	var stages []Node
+	for {
+		stage, err := p.parseStage()
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+
+		if p.peek().Kind != TokPipe {
+			break
+		}
+		p.advance()
+	}
+
+	if len(stages) == 1 {
+		return stages[0], nil
+	}
+	return &PipelineNode{Stages: stages}, nil
+}
+
+// parseStage := '$' shell-text | "literal" | name word*
+func (p *Parser) parseStage() (Node, error) {
+	tok := p.peek()
+
+	switch tok.Kind {
+	case TokEOF:
+		return nil, p.errorAt(tok.Pos, "expected a command")
+	case TokWord:
+	default:
+		return nil, p.errorAt(tok.Pos, "expected a command, found "+tok.Kind.String())
+	}
+
+	// Shell stages run verbatim up to the next |> so the shell sees its own
+	// quoting, globbing and redirections
+	if strings.HasPrefix(tok.Raw, "$") {
+		start := tok.Pos
+		end := findPipe(p.input, start)
+		if end < 0 {
+			end = len(p.input)
+		}
+		p.skipTo(end)
+
+		command := strings.TrimSpace(strings.TrimPrefix(p.input[start:end], "$"))
+		if command == "" {
+			return nil, p.errorAt(start, "empty shell command after '$'")
+		}
+		return &ShellNode{Command: command}, nil
+	}
+
+	// A single quoted word is a string literal ("\n", "done", ...)
+	if tok.Word.Quoted && (tok.Raw[0] == '"' || tok.Raw[0] == '\'') && !tok.Word.IsAssign() {
+		next := p.peekAt(1).Kind
+		if next == TokEOF || next == TokPipe || next == TokRedirect {
+			p.advance()
+			return &LiteralNode{Value: tok.Word.Value}, nil
+		}
+	}
+
+	p.advance()
+	cmd := &CommandNode{Name: tok.Word.Value, Pos: tok.Pos}
+	for p.peek().Kind == TokWord {
+		cmd.Args = append(cmd.Args, p.advance().Word)
+	}
+	if p.peek().Kind == TokArrow {
+		return nil, p.errorAt(p.peek().Pos, "unexpected '->' outside of a for-loop or #if")
+	}
+	return cmd, nil
+}
+
+// parseFor := 'for' binding (',' binding)* option* '->' body
+// binding  := ['$']var ['in'] source-word+
+func (p *Parser) parseFor() (Node, error) {
+	p.advance() // for
+
+	loop := &ForNode{Parallel: 1}
+	for {
+		varPos := p.peek().Pos
+		binding, more, err := p.parseForBinding(loop)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range loop.Vars {
+			if v.Name == binding.Name {
+				return nil, p.errorAt(varPos, "loop variable '"+v.Name+"' is bound twice")
+			}
+		}
+		loop.Vars = append(loop.Vars, binding)
+		if !more {
+			break
+		}
+	}
+
+	arrow := p.peek()
+	if arrow.Kind != TokArrow {
+		return nil, p.errorAt(arrow.Pos, "expected '->' before the loop body")
+	}
+
+	body := strings.TrimSpace(p.input[arrow.End:])
+	if body == "" {
+		return nil, p.errorAt(len(p.input), "expected a command after '->'")
+	}
+	loop.Body = body
+	return loop, nil
+}
+
+// parseForBinding reads one "var in source" and reports whether a comma
+// announced another binding
+func (p *Parser) parseForBinding(loop *ForNode) (ForVar, bool, error) {
+	varTok := p.peek()
+	if varTok.Kind != TokWord {
+		return ForVar{}, false, p.errorAt(varTok.Pos, "expected a loop variable")
+	}
+	p.advance()
+
+	// $x and ${x} are accepted as well as x; lexing may have expanded
+	// them, so use the raw text
+	varName := strings.TrimPrefix(varTok.Raw, "$")
+	if strings.HasPrefix(varName, "{") && strings.HasSuffix(varName, "}") {
+		varName = varName[1 : len(varName)-1]
+	}
+	if !isValidIdentifier(varName) {
+		return ForVar{}, false, p.errorAt(varTok.Pos, "invalid loop variable name '"+varTok.Raw+"'")
+	}
+
+	if tok := p.peek(); tok.Kind == TokWord && !tok.Word.Quoted && tok.Word.Value == "in" {
+		p.advance()
+	}
+
+	var sourceParts []string
+	sourcePos := p.peek().Pos
+	more := false
+	for p.peek().Kind == TokWord {
+		tok := p.advance()
+
+		// A module source is lexed when it runs, with the variables of
+		// that moment, so it is kept as typed rather than as lexed here
+		if len(sourceParts) == 0 && strings.HasPrefix(tok.Raw, "<(") {
+			source, comma := p.moduleSource(tok)
+			if comma {
+				return ForVar{Name: varName, Source: source}, true, nil
+			}
+			sourceParts = append(sourceParts, source)
+			continue
+		}
+
+		// A trailing comma, attached or on its own, starts the next binding
+		value := tok.Word.Value
+		if !tok.Word.Quoted && strings.HasSuffix(value, ",") {
+			value = strings.TrimSuffix(value, ",")
+			more = true
+		}
+
+		if value == "zip" && len(sourceParts) == 0 {
+			// A source that is literally "zip", not the option
+			sourceParts = append(sourceParts, value)
+		} else if value != "" {
+			tok.Word.Value = value
+			if tok.Word.IsAssign() {
+				tok.Word.Val = strings.TrimSuffix(tok.Word.Val, ",")
+			}
+			isOption, err := p.parseLoopOption(loop, tok)
+			if err != nil {
+				return ForVar{}, false, err
+			}
+			if !isOption {
+				sourceParts = append(sourceParts, value)
+			}
+		}
+		if more {
+			break
+		}
+	}
+	if len(sourceParts) == 0 {
+		return ForVar{}, false, p.errorAt(sourcePos, "expected a range or list for '"+varName+"'")
+	}
+
+	source := strings.Join(sourceParts, " ")
+	if strings.HasPrefix(source, "<(") {
+		if len(sourceParts) > 1 || !strings.HasPrefix(p.input[sourcePos:], "<(") {
+			return ForVar{}, false, p.errorAt(sourcePos, "a module source must be written out as <(module ...)")
+		}
+	}
+	return ForVar{Name: varName, Source: source}, more, nil
+}
+
+// moduleSource reads a <(module ...) source starting at first up to the
+// word that closes it, and reports whether a comma follows
+func (p *Parser) moduleSource(first Token) (string, bool) {
+	last := first
+	for !strings.HasSuffix(strings.TrimSuffix(last.Raw, ","), ")") && p.peek().Kind == TokWord {
+		last = p.advance()
+	}
+	source := p.input[first.Pos:last.End]
+	if strings.HasSuffix(source, ",") {
+		return strings.TrimSuffix(source, ","), true
+	}
+	return source, false
+}
+
+// parseLoopOption applies parallel=N, &N, order=input|completed,
+// failfast=bool and zip / mode=zip|product; any other word belongs to the
+// loop source
+func (p *Parser) parseLoopOption(loop *ForNode, tok Token) (bool, error) {
+	w := tok.Word
+	if w.Quoted {
+		return false, nil
+	}
+	if w.Value == "zip" {
+		loop.Zip = true
+		return true, nil
+	}
+
+	key, value := w.Key, w.Val
+	if strings.HasPrefix(w.Value, "&") {
+		key, value = "parallel", w.Value[1:]
+	}
+
+	switch key {
+	case "parallel":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return false, p.errorAt(tok.Pos, "parallel needs a positive number of workers, got '"+value+"'")
+		}
+		loop.Parallel = n
+	case "order":
+		switch strings.ToLower(value) {
+		case "input":
+			loop.AsCompleted = false
+		case "completed":
+			loop.AsCompleted = true
+		default:
+			return false, p.errorAt(tok.Pos, "order must be 'input' or 'completed', got '"+value+"'")
+		}
+	case "mode":
+		switch strings.ToLower(value) {
+		case "product":
+			loop.Zip = false
+		case "zip":
+			loop.Zip = true
+		default:
+			return false, p.errorAt(tok.Pos, "mode must be 'product' or 'zip', got '"+value+"'")
+		}
+	case "failfast":
+		b, ok := core.ParseBool(value)
+		if !ok {
+			return false, p.errorAt(tok.Pos, "failfast must be true or false, got '"+value+"'")
+		}
+		loop.FailFast = b
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dumpNode renders a node compactly for comparison
+func dumpNode(n Node) string {
+	switch n := n.(type) {
+	case *AssignNode:
+		if n.Query {
+			return "assign(" + n.Key + "=?)"
+		}
+		return "assign(" + n.Key + "=" + n.Value + ")"
+	case *CommandNode:
+		return "cmd(" + strings.Join(append([]string{n.Name}, wordValues(n.Args)...), ",") + ")"
+	case *LiteralNode:
+		return "lit(" + n.Value + ")"
+	case *ShellNode:
+		return "sh(" + n.Command + ")"
+	case *MacroNode:
+		return "macro(" + n.Raw + ")"
+	case *PipelineNode:
+		stages := make([]string, len(n.Stages))
+		for i, stage := range n.Stages {
+			stages[i] = dumpNode(stage)
+		}
+		return "pipe(" + strings.Join(stages, " | ") + ")"
+	case *ForNode:
+		vars := make([]string, len(n.Vars))
+		for i, v := range n.Vars {
+			vars[i] = v.Name + " in " + v.Source
+		}
+		return fmt.Sprintf("for(%s; zip=%t par=%d completed=%t failfast=%t -> %s)",
+			strings.Join(vars, ", "), n.Zip, n.Parallel, n.AsCompleted, n.FailFast, n.Body)
+	case *RedirectNode:
+		return "redirect(" + dumpNode(n.Stmt) + " " + n.Op + " " + n.Target + ")"
+	case *BackgroundNode:
+		return "bg(" + dumpNode(n.Stmt) + ")"
+	case *CaptureNode:
+		return "capture(" + n.Name + " := " + dumpNode(n.Stmt) + ")"
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func TestParseCommand(t *testing.T) {
+	vars := map[string]string{"host": "10.0.0.1", "sp": "a b"}
+	expand := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// commands and words
+		{"scan", "cmd(scan)"},
+		{"  scan target=$host  ", "cmd(scan,target=10.0.0.1)"},
+		{`scan target="$sp" 'x $host'`, "cmd(scan,target=a b,x $host)"},
+		{`echo a\ b`, "cmd(echo,a b)"},
+
+		// variables
+		{"x=1", "assign(x=1)"},
+		{"x=?", "assign(x=?)"},
+		{`x="?"`, "assign(x=?)"},
+		{"x=1 y=2", "cmd(x=1,y=2)"},
+
+		// pipelines and stages
+		{"scan |> grep open", "pipe(cmd(scan) | cmd(grep,open))"},
+		{`scan |> "done"`, "pipe(cmd(scan) | lit(done))"},
+		{"scan |> $ sort -u | head -1 |> save", "pipe(cmd(scan) | sh(sort -u | head -1) | cmd(save))"},
+		{"$ ls > out.txt", "sh(ls > out.txt)"},
+		{"#def x -> echo", "macro(#def x -> echo)"},
+
+		// redirects
+		{"scan > out.txt", "redirect(cmd(scan) > out.txt)"},
+		{"scan |> grep a >> out.txt", "redirect(pipe(cmd(scan) | cmd(grep,a)) >> out.txt)"},
+		{"scan 2> err.txt", "redirect(cmd(scan) 2> err.txt)"},
+		{"scan &> all.txt", "redirect(cmd(scan) &> all.txt)"},
+
+		// jobs and captures
+		{"scan target=a &", "bg(cmd(scan,target=a))"},
+		{"out := scan |> grep a", "capture(out := pipe(cmd(scan) | cmd(grep,a)))"},
+		{"#sudo scan &", "bg(macro(#sudo scan))"},
+		{"#def bg |m| -> scan target=$m &", "macro(#def bg |m| -> scan target=$m &)"},
+		{"#define up -> $ ping -c1 x &", "macro(#define up -> $ ping -c1 x &)"},
+		{"scan a&", "cmd(scan,a&)"},
+
+		// loops
+		{"for i in 1..3 -> echo $i", "for(i in 1..3; zip=false par=1 completed=false failfast=false -> echo $i)"},
+		{"for $i 1..3 -> echo", "for(i in 1..3; zip=false par=1 completed=false failfast=false -> echo)"},
+		{"for ${i} in a|b -> echo", "for(i in a|b; zip=false par=1 completed=false failfast=false -> echo)"},
+		{"for u in a|b, p in 1..2 zip -> echo", "for(u in a|b, p in 1..2; zip=true par=1 completed=false failfast=false -> echo)"},
+		{"for u in a|b , p in c mode=product -> echo", "for(u in a|b, p in c; zip=false par=1 completed=false failfast=false -> echo)"},
+		{"for i in zip -> echo", "for(i in zip; zip=false par=1 completed=false failfast=false -> echo)"},
+		{"for i in 1..9 &4 order=completed failfast=yes -> echo", "for(i in 1..9; zip=false par=4 completed=true failfast=true -> echo)"},
+		{"for i in 1..9 parallel=2 -> scan |> grep x > out", "for(i in 1..9; zip=false par=2 completed=false failfast=false -> scan |> grep x > out)"},
+		{`for h in <(hosts net=$host tag="a b"), p in 1..2 -> echo`, `for(h in <(hosts net=$host tag="a b"), p in 1..2; zip=false par=1 completed=false failfast=false -> echo)`},
+		{"for h in <(hosts) &2 -> echo", "for(h in <(hosts); zip=false par=2 completed=false failfast=false -> echo)"},
+	}
+	for _, tt := range tests {
+		node, err := ParseCommand(tt.input, expand)
+		if err != nil {
+			t.Errorf("ParseCommand(%q): %v", tt.input, err)
+			continue
+		}
+		if got := dumpNode(node); got != tt.want {
+			t.Errorf("ParseCommand(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+		pos   int
+	}{
+		{"&", "missing command before &", 0},
+		{"out :=", "missing command after :=", 6},
+		{"out := scan &", "cannot capture the output of a background job", 12},
+		{"scan |>", "expected a command", 7},
+		{"|> scan", "expected a command, found '|>'", 0},
+		{"scan >", "expected a file name after >", 6},
+		{"scan > a b", "unexpected word", 9},
+		{"scan -> echo", "unexpected '->' outside of a for-loop or #if", 5},
+		{"$ |> scan", "empty shell command after '$'", 0},
+		{"for i in 1..3", "expected '->' before the loop body", 13},
+		{"for i in 1..3 ->", "expected a command after '->'", 16},
+		{"for a.b in c -> echo", "invalid loop variable name 'a.b'", 4},
+		{"for i in -> echo", "expected a range or list for 'i'", 9},
+		{"for i in a, i in b -> echo", "loop variable 'i' is bound twice", 12},
+		{`for i in "<(rm)" -> echo`, "a module source must be written out as <(module ...)", 9},
+		{"for i in <(hosts) extra -> echo", "a module source must be written out as <(module ...)", 9},
+		{"for i in a parallel=0 -> echo", "parallel needs a positive number of workers, got '0'", 11},
+		{"for i in a &x -> echo", "parallel needs a positive number of workers, got 'x'", 11},
+		{"for i in a order=random -> echo", "order must be 'input' or 'completed', got 'random'", 11},
+		{"for i in a mode=all -> echo", "mode must be 'product' or 'zip', got 'all'", 11},
+		{"for i in a failfast=maybe -> echo", "failfast must be true or false, got 'maybe'", 11},
+	}
+	for _, tt := range tests {
+		_, err := ParseCommand(tt.input, nil)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("ParseCommand(%q) = %v, want a syntax error", tt.input, err)
+			continue
+		}
+		if syntaxErr.Msg != tt.msg || syntaxErr.Pos != tt.pos {
+			t.Errorf("ParseCommand(%q) = %q at %d, want %q at %d", tt.input, syntaxErr.Msg, syntaxErr.Pos, tt.msg, tt.pos)
+		}
+	}
+}
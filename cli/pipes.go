@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// maxEnvInput is the largest piped input also exported as ARG_INPUT.
+// Linux rejects single environment strings above 128 KiB, so bigger
+// inputs are only available on stdin
+const maxEnvInput = 64 * 1024
+
+// pipeValue is what flows between pipe stages: text, or findings as JSON
+// lines when a module emitted structured findings
+type pipeValue struct {
+	text       string
+	structured bool
+}
+
+// executePipeline runs every stage of a |> chain, feeding each stage the
+// previous stage's captured stdout. When streamLast is set the final stage
+// writes to the terminal as it runs; the final output is returned either way
+func (cli *CLI) executePipeline(pipeline *PipelineNode, streamLast bool) (pipeValue, bool, error) {
+	var result pipeValue
+	streamed := false
+
+	for i, stage := range pipeline.Stages {
+		last := i == len(pipeline.Stages)-1
+		var err error
+		result, streamed, err = cli.executePipedCommand(stage, result, last && streamLast)
+		if err != nil {
+			return pipeValue{}, false, fmt.Errorf("stage %d (%s): %w", i+1, stageName(stage), err)
+		}
+	}
+
+	return result, streamed, nil
+}
+
+// stageName describes a pipe stage in error messages
+func stageName(stage Node) string {
+	switch n := stage.(type) {
+	case *CommandNode:
+		return n.Name
+	case *ShellNode:
+		return "$ " + n.Command
+	case *LiteralNode:
+		return fmt.Sprintf("%q", n.Value)
+	}
+	return "?"
+}
+
+// executePipedCommands handles piped commands with |> syntax
+// Example: whoami |> hasher  or  $ cat file.txt |> base64
+func (cli *CLI) executePipedCommands(pipeline *PipelineNode) {
+	result, streamed, err := cli.executePipeline(pipeline, true)
+	if err != nil {
+		cli.lastExit = exitCode(err)
+		core.PrintError(fmt.Sprintf("Pipe error: %v", err))
+		return
+	}
+
+	if streamed {
+		return
+	}
+	if result.structured {
+		fmt.Println()
+		cli.printFindings(parseFindings(result.text), "")
+		return
+	}
+	if cli.redirected() {
+		fmt.Fprintln(cli.out(), result.text)
+		return
+	}
+	fmt.Println()
+	fmt.Println(result.text)
+	fmt.Println()
+}
+
+// executePipedCommand executes a single command in a pipe chain. Supported stages:
+//   - "text" / 'text'   string literal appended to the input (escapes allowed)
+//   - $ shell command   the input is written to the command's stdin
+//   - module [k=v ...]  the input is passed as ARG_INPUT and on stdin
+//
+// A module that emits findings hands them on as JSON lines instead of its
+// text output, and the next module is told so by LMV_INPUT_FORMAT=jsonl.
+// The returned bool reports whether the stage's output already reached the terminal
+func (cli *CLI) executePipedCommand(stage Node, input pipeValue, stream bool) (pipeValue, bool, error) {
+	switch n := stage.(type) {
+	case *LiteralNode:
+		return pipeValue{text: input.text + n.Value}, false, nil
+
+	case *ShellNode:
+		output, err := cli.runShellCaptured(n.Command, input.text)
+		return pipeValue{text: strings.TrimRight(output, "\n")}, false, err
+
+	case *CommandNode:
+		moduleName, args := n.Name, n.Args
+		if moduleName == "run" && len(args) > 0 {
+			moduleName, args = args[0].Value, args[1:]
+		}
+
+		if _, err := cli.manager.GetModule(moduleName); err != nil {
+			return pipeValue{}, false, err
+		}
+		return cli.executeModuleForPipe(moduleName, args, input, stream)
+	}
+
+	return pipeValue{}, false, fmt.Errorf("unsupported pipe stage")
+}
+
+// executeModuleForPipe executes a module with piped input and returns its captured output
+func (cli *CLI) executeModuleForPipe(moduleName string, args []Word, input pipeValue, stream bool) (pipeValue, bool, error) {
+	moduleArgs := make(map[string]string)
+	parsedArgs := cli.parseArguments(args)
+
+	for key, value := range parsedArgs {
+		switch key {
+		case "threads", "save":
+			// Skip these
+		default:
+			moduleArgs[key] = value
+		}
+	}
+
+	if module, err := cli.manager.GetModule(moduleName); err == nil {
+		cli.warnUnknownArguments(module, moduleArgs)
+	}
+
+	// Merge the variables of every scope
+	for key, value := range cli.moduleVars(moduleName) {
+		if _, exists := moduleArgs[key]; !exists {
+			moduleArgs[key] = value
+		}
+	}
+
+	// The previous stage's output wins over a global "input" variable,
+	// but not over an explicit input=... on this stage
+	if _, explicit := parsedArgs["input"]; !explicit {
+		if len(input.text) <= maxEnvInput {
+			moduleArgs["input"] = input.text
+		} else {
+			delete(moduleArgs, "input")
+		}
+	}
+
+	moduleArgs, err := cli.manager.PrepareArguments(moduleName, moduleArgs, CurrentDir)
+	if err != nil {
+		return pipeValue{}, false, err
+	}
+
+	// Stderr always reaches the terminal so failures stay visible
+	opts := cli.runOptions()
+	opts.Stderr = cli.errOut()
+	opts.Stdin = strings.NewReader(input.text)
+	if input.structured {
+		opts.Env = append(opts.Env, structuredInputEnv)
+	}
+	var events *eventRenderer
+	if stream {
+		opts.Stdout = cli.out()
+		events = cli.eventRenderer(moduleName)
+		opts.OnEvent = events.render
+	}
+
+	started := time.Now()
+	result, err := cli.manager.ExecuteModuleWith(moduleName, moduleArgs, opts)
+	if err != nil {
+		return pipeValue{}, false, err
+	}
+	cli.recordRun(moduleName, moduleArgs, 1, 0, started, result)
+	if result.Interrupted {
+		return pipeValue{}, stream, fmt.Errorf("module '%s' was %w", moduleName, errInterrupted)
+	}
+	if result.TimedOut {
+		return pipeValue{}, stream, fmt.Errorf("module '%s' %s", moduleName, result.Error)
+	}
+	if !result.Success {
+		return pipeValue{}, stream, fmt.Errorf("module '%s' failed [exit: %d]", moduleName, result.ExitCode)
+	}
+
+	findings := core.Findings(result.Events)
+	if stream {
+		cli.printFindings(findings, result.Output)
+	}
+	if len(findings) > 0 {
+		return pipeValue{text: findingsJSONL(findings), structured: true}, stream, nil
+	}
+	return pipeValue{text: strings.TrimSpace(result.Output)}, stream, nil
+}
@@ -15,11 +15,18 @@ func (cli *CLI) GetPrompt() string {
 	user, _ := user.Current()
 	hostname, _ := os.Hostname()
 
+	// The workspace is shown unless it is the default one
+	workspace := ""
+	if !cli.workspace.isDefault() {
+		workspace = color.YellowString(" [%s]", cli.workspace.Name)
+	}
+
 	// Simple, colorful prompt
-	return fmt.Sprintf("%s%s%s%s ",
+	return fmt.Sprintf("%s%s%s%s%s ",
 		color.CyanString(user.Username),
 		color.WhiteString("@"),
 		color.MagentaString(hostname),
+		workspace,
 		color.GreenString(" ❯"),
 	)
 }
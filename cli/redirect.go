@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// out is where command output goes: the redirection target or the terminal
+func (cli *CLI) out() io.Writer {
+	if cli.stdout != nil {
+		return cli.stdout
+	}
+	return os.Stdout
+}
+
+// errOut is where command error output goes
+func (cli *CLI) errOut() io.Writer {
+	if cli.stderr != nil {
+		return cli.stderr
+	}
+	return os.Stderr
+}
+
+// redirected reports whether standard output is going to a file, in which
+// case results are written plain, without boxes or numbering
+func (cli *CLI) redirected() bool {
+	return cli.stdout != nil
+}
+
+// runOptions holds what every module run shares: wrappers, Ctrl+C tracking,
+// the job context, the global timeout and the secrets to mask. Output is
+// captured only
+func (cli *CLI) runOptions() core.ExecOptions {
+	return core.ExecOptions{
+		Wrappers:       append(append([]string(nil), cli.wrappers...), cli.sessionWrappers...),
+		OnStart:        cli.processes().track,
+		Context:        cli.ctx,
+		DefaultTimeout: cli.globalTimeout(),
+		Redact:         cli.secretValues(),
+	}
+}
+
+// processes is the executor tracking this CLI's module processes: the
+// global one for the prompt, or a job's own
+func (cli *CLI) processes() *ModuleExecutor {
+	if cli.executor != nil {
+		return cli.executor
+	}
+	return moduleExecutor
+}
+
+// globalTimeout is the "timeout" environment setting, 0 if unset or invalid
+func (cli *CLI) globalTimeout() time.Duration {
+	value, _, ok := cli.lookupScoped("timeout")
+	if !ok {
+		return 0
+	}
+	d, _ := core.ParseTimeout(value)
+	return d
+}
+
+// execOptions streams a module to the current output targets
+func (cli *CLI) execOptions() core.ExecOptions {
+	opts := cli.runOptions()
+	terminal := core.TerminalOptions()
+	opts.Stdin, opts.Foreground = terminal.Stdin, terminal.Foreground
+	opts.Stdout = cli.out()
+	opts.Stderr = cli.errOut()
+	if cli.quiet {
+		// Background iterations must not compete for stdin or the terminal
+		opts.Stdin, opts.Foreground = nil, false
+	}
+	return opts
+}
+
+// executeRedirect runs a statement with its output sent to a file:
+//
+//	>  >>    stdout (truncate / append)
+//	2> 2>>   stderr
+//	&> &>>   both
+//
+// Status messages keep going to the terminal
+func (cli *CLI) executeRedirect(n *RedirectNode) {
+	path := redirectPath(n.Target)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if strings.HasSuffix(n.Op, ">>") {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Cannot open '%s' for writing: %v", n.Target, err))
+		return
+	}
+	defer file.Close()
+
+	prevOut, prevErr := cli.stdout, cli.stderr
+	defer func() {
+		cli.stdout, cli.stderr = prevOut, prevErr
+	}()
+
+	switch {
+	case strings.HasPrefix(n.Op, "2"):
+		cli.stderr = file
+	case strings.HasPrefix(n.Op, "&"):
+		cli.stdout, cli.stderr = file, file
+	default:
+		cli.stdout = file
+	}
+
+	cli.executeNode(n.Stmt)
+}
+
+// executeCapture runs a statement quietly with its standard output kept in
+// a session variable, name := statement. Error output still shows. Trailing
+// newlines are dropped, as with $(...) in shells
+func (cli *CLI) executeCapture(n *CaptureNode) {
+	var buf lockedBuffer
+
+	sub := cli.forkQuiet(&buf)
+	sub.stderr = cli.errOut()
+	sub.executeNode(n.Stmt)
+
+	cli.lastExit = sub.lastExit
+	cli.vars[n.Name] = strings.TrimRight(buf.String(), "\r\n")
+}
+
+// redirectPath resolves a redirection target relative to the shell's
+// working directory, expanding a leading ~
+func redirectPath(target string) string {
+	if target == "~" || strings.HasPrefix(target, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			target = filepath.Join(home, target[1:])
+		}
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(CurrentDir, target)
+	}
+	return target
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		cmd      string
+		wantExit int
+		want     string // the file's contents after the command
+	}{
+		{"env get one > " + out, 0, "1\n"},
+		{"env get two >> " + out, 0, "1\n2\n"},
+		{"env get one > " + out, 0, "1\n"},
+		{"env get two > " + filepath.Join(dir, "missing", "out.txt"), 1, "1\n"},
+	}
+	cli := newTestCLI(t)
+	cli.ExecuteCommand("setg one=1")
+	cli.ExecuteCommand("setg two=2")
+	for _, tt := range tests {
+		cli.lastExit = 0
+		cli.ExecuteCommand(tt.cmd)
+		if cli.lastExit != tt.wantExit {
+			t.Errorf("%q: exit = %d, want %d", tt.cmd, cli.lastExit, tt.wantExit)
+		}
+		data, _ := os.ReadFile(out)
+		if string(data) != tt.want {
+			t.Errorf("%q: file = %q, want %q", tt.cmd, data, tt.want)
+		}
+	}
+}
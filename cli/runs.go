@@ -0,0 +1,439 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// RunRecord is one module execution as kept in the run history
+type RunRecord struct {
+	ID          int               `json:"id"`
+	Module      string            `json:"module"`
+	Args        map[string]string `json:"args"` // as passed to the module, after defaults and env
+	Env         map[string]string `json:"env"`  // variables of every scope at the time of the run
+	Workdir     string            `json:"workdir"`
+	Threads     int               `json:"threads,omitempty"`
+	Timeout     time.Duration     `json:"timeout,omitempty"` // per-run override, see core.ExecOptions
+	Started     time.Time         `json:"started"`
+	Ended       time.Time         `json:"ended"`
+	ExitCode    int               `json:"exit_code"`
+	Success     bool              `json:"success"`
+	Interrupted bool              `json:"interrupted,omitempty"`
+	TimedOut    bool              `json:"timed_out,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Output      string            `json:"output"`
+	Stderr      string            `json:"stderr,omitempty"`
+	Truncated   bool              `json:"truncated,omitempty"`
+	Events      []core.Event      `json:"events,omitempty"`
+}
+
+// status is a one word outcome: ok, failed, interrupted or timeout
+func (r *RunRecord) status() string {
+	switch {
+	case r.Interrupted:
+		return "interrupted"
+	case r.TimedOut:
+		return "timeout"
+	case r.Success:
+		return "ok"
+	default:
+		return "failed"
+	}
+}
+
+// commandLine renders the run the way it could be typed at the prompt
+func (r *RunRecord) commandLine() string {
+	keys := make([]string, 0, len(r.Args))
+	for key := range r.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{r.Module}
+	for _, key := range keys {
+		value := r.Args[key]
+		if value == "" || strings.ContainsAny(value, " \t\"'|") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// RunStore keeps the run history as one JSON file per run
+type RunStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewRunStore creates a run store in dir, a workspace's runs directory
+func NewRunStore(dir string) *RunStore {
+	return &RunStore{dir: dir}
+}
+
+// Save stores a record, assigning it the next free ID
+func (s *RunStore) Save(rec *RunRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	rec.ID = 1
+	if len(ids) > 0 {
+		rec.ID = ids[len(ids)-1] + 1
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	// O_EXCL guards against another lanmanvan session taking the same ID
+	for {
+		f, err := os.OpenFile(s.path(rec.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			rec.ID++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// Load reads one record
+func (s *RunStore) Load(id int) (*RunRecord, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no such run: %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec RunRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("run %d is corrupt: %v", id, err)
+	}
+	return &rec, nil
+}
+
+// List returns every readable record, oldest first
+func (s *RunStore) List() ([]*RunRecord, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*RunRecord
+	for _, id := range ids {
+		if rec, err := s.Load(id); err == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func (s *RunStore) path(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.json", id))
+}
+
+// ids returns the stored run IDs in ascending order
+func (s *RunStore) ids() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if id, err := strconv.Atoi(name); err == nil && name != entry.Name() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// recordRun adds a finished module run to the history and returns its record
+func (cli *CLI) recordRun(moduleName string, args map[string]string, threads int, timeout time.Duration, started time.Time, result *core.ExecutionResult) *RunRecord {
+	if result == nil {
+		return nil
+	}
+
+	// Secrets never reach the disk in the clear; the output was masked
+	// as the module ran
+	env := cli.maskVars(moduleName, cli.moduleVars(moduleName))
+
+	rec := &RunRecord{
+		Module:      moduleName,
+		Args:        cli.maskVars(moduleName, args),
+		Env:         env,
+		Workdir:     CurrentDir,
+		Threads:     threads,
+		Timeout:     timeout,
+		Started:     started,
+		Ended:       time.Now(),
+		ExitCode:    result.ExitCode,
+		Success:     result.Success,
+		Interrupted: result.Interrupted,
+		TimedOut:    result.TimedOut,
+		Error:       result.Error,
+		Output:      result.Output,
+		Stderr:      result.Stderr,
+		Truncated:   result.Truncated,
+		Events:      result.Events,
+	}
+	if err := cli.runs.Save(rec); err != nil {
+		core.PrintWarning(fmt.Sprintf("Could not record run: %v", err))
+	}
+	return rec
+}
+
+// Runs lists the run history, or shows one run with `runs show <id>`.
+// Filters: a module name, module=, status=ok|failed|interrupted|timeout,
+// grep=<text in output> and limit=N (default 20)
+func (cli *CLI) Runs(args []string) {
+	if len(args) > 0 && args[0] == "show" {
+		if len(args) < 2 {
+			cli.lastExit = 2
+			core.PrintError("Usage: runs show <id>")
+			return
+		}
+		cli.ShowRun(args[1])
+		return
+	}
+
+	var module, status, grep string
+	limit := 20
+	for _, arg := range args {
+		key, value, isKV := strings.Cut(arg, "=")
+		switch {
+		case !isKV:
+			module = arg
+		case key == "module":
+			module = value
+		case key == "status":
+			status = value
+		case key == "grep":
+			grep = value
+		case key == "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				cli.lastExit = 2
+				core.PrintError(fmt.Sprintf("Invalid limit '%s'", value))
+				return
+			}
+			limit = n
+		default:
+			cli.lastExit = 2
+			core.PrintError(fmt.Sprintf("Unknown filter '%s', use module=, status=, grep= or limit=", key))
+			return
+		}
+	}
+
+	records, err := cli.runs.List()
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to read run history: %v", err))
+		return
+	}
+
+	var matched []*RunRecord
+	for _, rec := range records {
+		if module != "" && rec.Module != module {
+			continue
+		}
+		if status != "" && rec.status() != status {
+			continue
+		}
+		if grep != "" && !strings.Contains(rec.Output, grep) && !strings.Contains(rec.Stderr, grep) {
+			continue
+		}
+		matched = append(matched, rec)
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+
+	if len(matched) == 0 {
+		core.PrintInfo("No matching runs")
+		fmt.Println()
+		return
+	}
+
+	table := core.NewTable([]string{"ID", "Started", "Status", "Exit", "Time", "Command"})
+	for _, rec := range matched {
+		command := rec.commandLine()
+		if len(command) > 60 {
+			command = command[:57] + "..."
+		}
+		table.AddRow(
+			strconv.Itoa(rec.ID),
+			rec.Started.Format("2006-01-02 15:04:05"),
+			rec.status(),
+			strconv.Itoa(rec.ExitCode),
+			rec.Ended.Sub(rec.Started).Round(time.Millisecond).String(),
+			command,
+		)
+	}
+	fmt.Println()
+	fmt.Println(table.Render())
+	core.PrintInfo("Use 'runs show <id>' to see a run's output, 'rerun <id>' to run it again")
+	fmt.Println()
+}
+
+// loadRun resolves a run ID argument
+func (cli *CLI) loadRun(ref string) (*RunRecord, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(ref, "#"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid run ID '%s'", ref)
+	}
+	return cli.runs.Load(id)
+}
+
+// ShowRun replays a recorded run's output with its details
+func (cli *CLI) ShowRun(ref string) {
+	rec, err := cli.loadRun(ref)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(err.Error())
+		return
+	}
+
+	if cli.redirected() {
+		writeLines(cli.out(), rec.Output)
+		writeLines(cli.errOut(), rec.Stderr)
+		cli.printFindings(core.Findings(rec.Events), "")
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("Run #%d: %s", rec.ID, rec.Module)))
+	fmt.Printf("   ├─ Command:  %s\n", core.Color("cyan", rec.commandLine()))
+	fmt.Printf("   ├─ Started:  %s\n", rec.Started.Format(time.RFC1123))
+	fmt.Printf("   ├─ Duration: %s\n", rec.Ended.Sub(rec.Started).Round(time.Millisecond))
+	fmt.Printf("   ├─ Status:   %s [exit: %d]\n", rec.status(), rec.ExitCode)
+	fmt.Printf("   ├─ Workdir:  %s\n", rec.Workdir)
+	if rec.Error != "" {
+		fmt.Printf("   ├─ Error:    %s\n", core.Color("red", rec.Error))
+	}
+	fmt.Printf("   └─ Env:      %s\n", formatEnvSnapshot(rec.Env))
+	fmt.Println()
+
+	if rec.Output != "" || rec.Stderr != "" {
+		fmt.Println(core.NmapBox("Output"))
+		for _, line := range strings.Split(strings.TrimRight(rec.Output, "\n"), "\n") {
+			fmt.Println(core.NmapSubBox(line))
+		}
+		if strings.TrimSpace(rec.Stderr) != "" {
+			for _, line := range strings.Split(strings.TrimRight(rec.Stderr, "\n"), "\n") {
+				fmt.Println(core.NmapSubBox(core.Color("red", line)))
+			}
+		}
+		fmt.Println()
+	}
+	if findings := core.Findings(rec.Events); len(findings) > 0 {
+		fmt.Println(core.NmapBox(fmt.Sprintf("Findings (%d)", len(findings))))
+		fmt.Println(findingsTable(findings))
+		fmt.Println()
+	}
+	if artifacts := core.Artifacts(rec.Events); len(artifacts) > 0 {
+		fmt.Println(core.NmapBox(fmt.Sprintf("Artifacts (%d)", len(artifacts))))
+		for _, path := range artifacts {
+			fmt.Println(core.NmapSubBox(path))
+		}
+		fmt.Println()
+	}
+	if rec.Truncated {
+		core.PrintWarning("Output was truncated when it was captured")
+		fmt.Println()
+	}
+}
+
+// formatEnvSnapshot lists variables as k=v, sorted
+func formatEnvSnapshot(env map[string]string) string {
+	if len(env) == 0 {
+		return "(none)"
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+env[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+// Rerun executes a recorded run again with the exact same arguments
+func (cli *CLI) Rerun(args []string) {
+	if len(args) == 0 {
+		cli.lastExit = 2
+		core.PrintError("Usage: rerun <id>")
+		return
+	}
+
+	rec, err := cli.loadRun(args[0])
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(err.Error())
+		return
+	}
+	if _, err := cli.manager.GetModule(rec.Module); err != nil {
+		cli.lastExit = 127
+		core.PrintError(err.Error())
+		return
+	}
+
+	if !cli.quiet {
+		fmt.Println()
+		core.PrintInfo(fmt.Sprintf("Re-running #%d: %s", rec.ID, core.Color("cyan", rec.commandLine())))
+	}
+
+	// Secrets were masked in the record; they come from the variables now
+	moduleArgs := make(map[string]string, len(rec.Args))
+	vars := cli.moduleVars(rec.Module)
+	for key, value := range rec.Args {
+		if value == core.RedactMask {
+			if value = vars[key]; value == "" {
+				cli.lastExit = 1
+				core.PrintError(fmt.Sprintf("Run #%d used a secret '%s' that is no longer set", rec.ID, key))
+				return
+			}
+		}
+		moduleArgs[key] = value
+	}
+
+	threads := rec.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	opts := cli.execOptions()
+	opts.Timeout = rec.Timeout
+	cli.executeModule(rec.Module, moduleArgs, threads, false, opts)
+}
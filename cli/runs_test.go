@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunStoreIDs(t *testing.T) {
+	dir := t.TempDir()
+	store := NewRunStore(filepath.Join(dir, "runs"))
+
+	// IDs continue after the highest one, whatever else is in the directory
+	steps := []struct {
+		name   string
+		before func()
+		want   int
+	}{
+		{"first run", nil, 1},
+		{"next run", nil, 2},
+		{"after a gap", func() { os.WriteFile(store.path(7), []byte("{}"), 0600) }, 8},
+		{"other files ignored", func() {
+			os.WriteFile(filepath.Join(store.dir, "99"), nil, 0600)
+			os.WriteFile(filepath.Join(store.dir, "notes.json"), nil, 0600)
+		}, 9},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		rec := &RunRecord{Module: "scan"}
+		if err := store.Save(rec); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if rec.ID != step.want {
+			t.Errorf("%s: ID = %d, want %d", step.name, rec.ID, step.want)
+		}
+	}
+
+	ids, err := store.ids()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(ids); got != 5 {
+		t.Errorf("ids = %v, want 5 of them", ids)
+	}
+}
+
+func TestRunStoreConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	// Two stores on one directory stand for two sessions
+	stores := []*RunStore{NewRunStore(dir), NewRunStore(dir)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(store *RunStore) {
+			defer wg.Done()
+			if err := store.Save(&RunRecord{Module: "scan"}); err != nil {
+				t.Error(err)
+			}
+		}(stores[i%2])
+	}
+	wg.Wait()
+
+	records, err := stores[0].List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 20 {
+		t.Fatalf("%d records, want 20", len(records))
+	}
+	for i, rec := range records {
+		if rec.ID != i+1 {
+			t.Errorf("record %d has ID %d", i, rec.ID)
+		}
+	}
+}
+
+func TestRunStoreLoad(t *testing.T) {
+	store := NewRunStore(t.TempDir())
+	saved := &RunRecord{Module: "scan", Args: map[string]string{"target": "10.0.0.1"}, Output: "open\n", ExitCode: 3}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(store.path(2), []byte("{broken"), 0600)
+
+	tests := []struct {
+		id      int
+		wantErr string
+	}{
+		{1, ""},
+		{2, "corrupt"},
+		{3, "no such run"},
+	}
+	for _, tt := range tests {
+		rec, err := store.Load(tt.id)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load(%d) error = %v, want %q", tt.id, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Load(%d): %v", tt.id, err)
+		}
+		if rec.Module != saved.Module || rec.Args["target"] != "10.0.0.1" || rec.Output != saved.Output || rec.ExitCode != 3 {
+			t.Errorf("Load(%d) = %+v, want %+v", tt.id, rec, saved)
+		}
+	}
+
+	// List skips the corrupt record
+	records, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != 1 {
+		t.Errorf("List() = %d records", len(records))
+	}
+}
+
+func TestRunRecordStatus(t *testing.T) {
+	tests := []struct {
+		rec  RunRecord
+		want string
+	}{
+		{RunRecord{Success: true}, "ok"},
+		{RunRecord{}, "failed"},
+		{RunRecord{TimedOut: true}, "timeout"},
+		{RunRecord{Interrupted: true, TimedOut: true}, "interrupted"},
+	}
+	for _, tt := range tests {
+		if got := tt.rec.status(); got != tt.want {
+			t.Errorf("status(%+v) = %q, want %q", tt.rec, got, tt.want)
+		}
+	}
+}
+
+func TestRunRecordCommandLine(t *testing.T) {
+	rec := &RunRecord{Module: "scan", Args: map[string]string{"target": "a b", "ports": "80", "note": ""}}
+	want := `scan note="" ports=80 target="a b"`
+	if got := rec.commandLine(); got != want {
+		t.Errorf("commandLine() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,553 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Scripts (.lmv files) are run with `source file.lmv`, `lanmanvan file.lmv`
+// or `-rc file.lmv`. Every statement goes through ExecuteCommand, exactly as
+// if it was typed at the prompt. On top of that a script may use:
+//
+//	# a comment (a # followed by a space; #name is still a macro)
+//	portscan host=$target \
+//	    ports=1-1024                continues on the next line
+//	set -e                          stop at the first failing statement
+//	set +e                          keep going after failures (default)
+//	banner := $ curl -sI $url       capture a statement's output in $banner
+//	if $? == 0                      blocks on the last exit code ...
+//	elif $banner =~ nginx           ... or on variables
+//	else
+//	end                             (fi works too)
+//
+// Conditions are `ok`, `failed`, a single value (true when it reads as a
+// true boolean or a non-zero number, or is any other non-empty text), or a
+// comparison: == != < <= > >= (numeric when both sides are numbers),
+// =~ (regular expression) and contains. `not` negates a condition
+
+// maxSourceDepth bounds nested `source` calls, which would otherwise recurse
+// forever on a script that sources itself
+const maxSourceDepth = 16
+
+// scriptLine is one logical line: continuations joined, numbered by the
+// physical line it starts on
+type scriptLine struct {
+	num  int
+	text string
+}
+
+// scriptStmt is a statement, or an if block when isIf is set
+type scriptStmt struct {
+	line int
+	text string // the statement, or the condition of an if
+	isIf bool
+	then []scriptStmt
+	els  []scriptStmt
+}
+
+// scriptLines splits a script into logical lines, dropping blank lines and
+// comments
+func scriptLines(data string) []scriptLine {
+	var lines []scriptLine
+	var pending strings.Builder
+	start := 0
+
+	for i, raw := range strings.Split(data, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if pending.Len() == 0 {
+			start = i + 1
+		}
+
+		// A trailing backslash joins the next line to this one
+		trimmed := strings.TrimRight(raw, " \t")
+		if strings.HasSuffix(trimmed, "\\") && !strings.HasSuffix(trimmed, "\\\\") {
+			pending.WriteString(strings.TrimSuffix(trimmed, "\\"))
+			pending.WriteByte(' ')
+			continue
+		}
+		pending.WriteString(raw)
+		text := strings.TrimSpace(pending.String())
+		pending.Reset()
+
+		if text == "" || isScriptComment(text) || (start == 1 && strings.HasPrefix(text, "#!")) {
+			continue
+		}
+		lines = append(lines, scriptLine{num: start, text: text})
+	}
+	if text := strings.TrimSpace(pending.String()); text != "" {
+		lines = append(lines, scriptLine{num: start, text: text})
+	}
+	return lines
+}
+
+// isScriptComment reports whether a line is a comment: # followed by
+// whitespace or nothing. #name lines are macros
+func isScriptComment(text string) bool {
+	return text == "#" || strings.HasPrefix(text, "# ") || strings.HasPrefix(text, "#\t")
+}
+
+// scriptKeyword splits off a block keyword (if, elif, else, end, fi)
+func scriptKeyword(text string) (string, string) {
+	word, rest := text, ""
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		word, rest = text[:i], text[i+1:]
+	}
+	switch word {
+	case "if", "elif", "else", "end":
+		return word, strings.TrimSpace(rest)
+	case "fi":
+		return "end", strings.TrimSpace(rest)
+	}
+	return "", text
+}
+
+// scriptParser builds the block structure of a script
+type scriptParser struct {
+	name  string
+	lines []scriptLine
+	pos   int
+}
+
+func (p *scriptParser) errorAt(line int, format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", p.name, line, fmt.Sprintf(format, a...))
+}
+
+// parseScript reads a whole script, checking that its blocks are balanced
+// before anything runs
+func parseScript(name, data string) ([]scriptStmt, error) {
+	p := &scriptParser{name: name, lines: scriptLines(data)}
+	stmts, err := p.statements()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		kw, _ := scriptKeyword(l.text)
+		return nil, p.errorAt(l.num, "'%s' without a matching if", kw)
+	}
+	return stmts, nil
+}
+
+// statements parses up to the end of the script or the next else, elif or
+// end, which is left for the caller
+func (p *scriptParser) statements() ([]scriptStmt, error) {
+	var stmts []scriptStmt
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		kw, rest := scriptKeyword(l.text)
+		switch kw {
+		case "else", "elif", "end":
+			return stmts, nil
+		case "if":
+			p.pos++
+			stmt, err := p.ifBlock(l, rest)
+			if err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, stmt)
+		default:
+			stmts = append(stmts, scriptStmt{line: l.num, text: l.text})
+			p.pos++
+		}
+	}
+	return stmts, nil
+}
+
+// ifBlock parses the rest of an if whose line has been consumed, up to
+// and including its end
+func (p *scriptParser) ifBlock(start scriptLine, cond string) (scriptStmt, error) {
+	if cond == "" {
+		return scriptStmt{}, p.errorAt(start.num, "if needs a condition")
+	}
+	stmt := scriptStmt{line: start.num, text: cond, isIf: true}
+
+	then, err := p.statements()
+	if err != nil {
+		return stmt, err
+	}
+	stmt.then = then
+
+	if p.pos >= len(p.lines) {
+		return stmt, p.errorAt(start.num, "if without a matching end")
+	}
+	l := p.lines[p.pos]
+	kw, rest := scriptKeyword(l.text)
+	p.pos++
+
+	switch kw {
+	case "end":
+		if rest != "" {
+			return stmt, p.errorAt(l.num, "unexpected '%s' after end", rest)
+		}
+		return stmt, nil
+
+	case "elif":
+		// The nested if takes the shared end with it
+		nested, err := p.ifBlock(l, rest)
+		if err != nil {
+			return stmt, err
+		}
+		stmt.els = []scriptStmt{nested}
+		return stmt, nil
+	}
+
+	// else, or else if
+	if rest != "" {
+		if kw2, cond2 := scriptKeyword(rest); kw2 == "if" {
+			nested, err := p.ifBlock(l, cond2)
+			if err != nil {
+				return stmt, err
+			}
+			stmt.els = []scriptStmt{nested}
+			return stmt, nil
+		}
+		return stmt, p.errorAt(l.num, "unexpected '%s' after else", rest)
+	}
+	els, err := p.statements()
+	if err != nil {
+		return stmt, err
+	}
+	stmt.els = els
+	if p.pos >= len(p.lines) {
+		return stmt, p.errorAt(start.num, "if without a matching end")
+	}
+	l = p.lines[p.pos]
+	if kw, rest := scriptKeyword(l.text); kw != "end" || rest != "" {
+		return stmt, p.errorAt(l.num, "expected end, found '%s'", l.text)
+	}
+	p.pos++
+	return stmt, nil
+}
+
+// scriptRunner executes one script
+type scriptRunner struct {
+	cli     *CLI
+	name    string
+	dir     string // relative `source` paths start here
+	errexit bool   // set -e
+	depth   int
+}
+
+// run executes statements and reports whether the script has to stop
+func (r *scriptRunner) run(stmts []scriptStmt) bool {
+	cli := r.cli
+	for _, stmt := range stmts {
+		if !cli.running {
+			return true
+		}
+		where := fmt.Sprintf("%s:%d", r.name, stmt.line)
+
+		if stmt.isIf {
+			ok, err := cli.evalCondition(stmt.text)
+			if err != nil {
+				cli.lastExit = 2
+				core.PrintError(fmt.Sprintf("%s: %v", where, err))
+				return true
+			}
+			body := stmt.els
+			if ok {
+				body = stmt.then
+			}
+			if r.run(body) {
+				return true
+			}
+			continue
+		}
+
+		switch stmt.text {
+		case "set -e":
+			r.errexit = true
+			continue
+		case "set +e":
+			r.errexit = false
+			continue
+		}
+
+		prev := cli.location
+		cli.location = where
+		cli.ExecuteCommand(stmt.text)
+		cli.location = prev
+
+		switch {
+		case cli.lastExit == 0:
+		case cli.lastExit == exitInterrupted:
+			core.PrintWarning(fmt.Sprintf("%s: interrupted, stopping %s", where, r.name))
+			return true
+		case r.errexit:
+			core.PrintError(fmt.Sprintf("%s: '%s' failed [exit: %d], stopping (set -e)", where, stmt.text, cli.lastExit))
+			return true
+		default:
+			core.PrintWarning(fmt.Sprintf("%s: '%s' failed [exit: %d]", where, stmt.text, cli.lastExit))
+		}
+	}
+	return false
+}
+
+// runScript parses and runs a script's text. name is used in error
+// messages, as file:line, and dir is the directory the script is in, if any
+func (cli *CLI) runScript(name, dir, data string) {
+	stmts, err := parseScript(name, data)
+	if err != nil {
+		cli.lastExit = 2
+		core.PrintError(err.Error())
+		return
+	}
+
+	// A sourced script inherits set -e from the script sourcing it
+	runner := &scriptRunner{cli: cli, name: name, dir: dir}
+	parent := cli.script
+	if parent != nil {
+		if parent.depth+1 >= maxSourceDepth {
+			cli.lastExit = 2
+			core.PrintError(fmt.Sprintf("%s: scripts nested too deeply (more than %d levels)", name, maxSourceDepth))
+			return
+		}
+		runner.errexit = parent.errexit
+		runner.depth = parent.depth + 1
+	}
+
+	cli.script = runner
+	defer func() { cli.script = parent }()
+
+	cli.lastExit = 0
+	runner.run(stmts)
+}
+
+// Source runs a script file within the current session, the `source`
+// command. Relative paths are taken from the directory of the script
+// doing the sourcing, or the current directory at the prompt
+func (cli *CLI) Source(name string) {
+	path := name
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	if !filepath.IsAbs(path) {
+		base := CurrentDir
+		if cli.script != nil && cli.script.dir != "" {
+			base = cli.script.dir
+		}
+		path = filepath.Join(base, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Cannot read script: %v", err))
+		return
+	}
+	cli.runScript(name, filepath.Dir(path), string(data))
+}
+
+// RunScript runs a script read from r without a prompt, e.g. a file given
+// on the command line or commands piped on stdin. The script is read in
+// full first so modules that read stdin do not eat the rest of it
+func (cli *CLI) RunScript(name string, r io.Reader, banner bool) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := cli.setup(banner); err != nil {
+		return err
+	}
+
+	// Scripts read from a pipe source files from the working directory
+	dir, _ := os.Getwd()
+	if f, ok := r.(*os.File); ok && f != os.Stdin {
+		if abs, err := filepath.Abs(f.Name()); err == nil {
+			dir = filepath.Dir(abs)
+		}
+	}
+
+	cli.runScript(name, dir, string(data))
+	cli.finishJobs()
+	return nil
+}
+
+// SetRC names a script to run at startup, before the prompt or the
+// command line's own command. A relative path is taken from the process's
+// working directory
+func (cli *CLI) SetRC(path string) {
+	if path != "" && !strings.HasPrefix(path, "~") {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	cli.rcFile = path
+}
+
+// runRC runs the startup script. With --json its chatter goes to stderr so
+// that stdout holds only the JSON
+func (cli *CLI) runRC() {
+	if cli.rcFile == "" {
+		return
+	}
+	if cli.jsonOut {
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = stdout }()
+	}
+	cli.Source(cli.rcFile)
+}
+
+// evalCondition evaluates the condition of a script if. Variables are
+// expanded here, unset ones as empty, and $? is the last exit status
+func (cli *CLI) evalCondition(cond string) (bool, error) {
+	cond = strings.TrimSpace(cond)
+	if rest, ok := cutWord(cond, "not"); ok {
+		truth, err := cli.evalCondition(rest)
+		return !truth, err
+	}
+	if rest, ok := cutWord(cond, "!"); ok {
+		truth, err := cli.evalCondition(rest)
+		return !truth, err
+	}
+	switch cond {
+	case "ok":
+		return cli.lastExit == 0, nil
+	case "failed":
+		return cli.lastExit != 0, nil
+	}
+
+	left, op, right, found := cutOperator(cond)
+	if !found {
+		value, err := cli.conditionValue(cond)
+		if err != nil {
+			return false, err
+		}
+		return truthy(value), nil
+	}
+
+	a, err := cli.conditionValue(left)
+	if err != nil {
+		return false, err
+	}
+	b, err := cli.conditionValue(right)
+	if err != nil {
+		return false, err
+	}
+
+	switch op {
+	case "=~":
+		re, err := regexp.Compile(b)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression %q: %v", b, err)
+		}
+		return re.MatchString(a), nil
+	case "contains":
+		return strings.Contains(a, b), nil
+	}
+
+	// Numbers compare as numbers, anything else as text
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	numeric := errA == nil && errB == nil
+	cmp := strings.Compare(a, b)
+	if numeric {
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default: // >=
+		return cmp >= 0, nil
+	}
+}
+
+// conditionValue expands one side of a condition into a single string
+func (cli *CLI) conditionValue(text string) (string, error) {
+	lookup := func(name string) (string, bool) {
+		if name == "?" {
+			return strconv.Itoa(cli.lastExit), true
+		}
+		if value, ok := cli.lookupVar(name); ok {
+			return value, true
+		}
+		return "", true
+	}
+	words, err := lexWords(text, lookup, false)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(wordValues(words), " "), nil
+}
+
+// conditionOperators are tried longest first so <= is not read as <
+var conditionOperators = []string{"contains", "==", "!=", "=~", "<=", ">=", "<", ">"}
+
+// cutOperator splits a condition at the first comparison operator that
+// stands on its own, outside quotes
+func cutOperator(cond string) (string, string, string, bool) {
+	var quote byte
+	for i := 0; i < len(cond); i++ {
+		ch := cond[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+			continue
+		case ch == '"' || ch == '\'':
+			quote = ch
+			continue
+		case ch == '\\':
+			i++
+			continue
+		}
+		if i == 0 || (cond[i-1] != ' ' && cond[i-1] != '\t') {
+			continue
+		}
+		for _, op := range conditionOperators {
+			rest := cond[i:]
+			if strings.HasPrefix(rest, op) && (len(rest) == len(op) || rest[len(op)] == ' ' || rest[len(op)] == '\t') {
+				return strings.TrimSpace(cond[:i]), op, strings.TrimSpace(cond[i+len(op):]), true
+			}
+		}
+	}
+	return "", "", "", false
+}
+
+// cutWord removes a leading word followed by whitespace
+func cutWord(text, word string) (string, bool) {
+	if !strings.HasPrefix(text, word+" ") && !strings.HasPrefix(text, word+"\t") {
+		return text, false
+	}
+	return strings.TrimSpace(text[len(word):]), true
+}
+
+// truthy is how a lone value reads as a condition
+func truthy(value string) bool {
+	value = strings.TrimSpace(value)
+	if b, ok := core.ParseBool(value); ok {
+		return b
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n != 0
+	}
+	return value != ""
+}
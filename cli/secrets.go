@@ -0,0 +1,612 @@
+package cli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chzyer/readline"
+
+	"lanmanvan/core"
+)
+
+// Secret variables (`secret pass=...`, or any variable named after an
+// option of `type: secret`) are kept out of env.json, in the workspace's
+// secrets.json, sealed with AES-256-GCM under a key derived from a
+// passphrase with PBKDF2-HMAC-SHA256. The passphrase comes from
+// $LMV_PASSPHRASE or is asked for once per session, the first time a
+// secret is needed. $LMV_PASSPHRASE is taken out of the environment when
+// lanmanvan starts, so modules and shell commands never see it, and it
+// does not expand. Names stay readable so secrets can be listed and
+// masked without unlocking. Their values are masked in `env`, history,
+// logs, run records and module output
+
+const (
+	passphraseEnv    = "LMV_PASSPHRASE"
+	secretIterations = 210000
+	secretKeyLen     = 32
+	secretCheck      = "lanmanvan" // sealed with the key to recognise a wrong passphrase
+)
+
+var errWrongPassphrase = errors.New("wrong passphrase")
+
+// secretFile is secrets.json
+type secretFile struct {
+	Salt       string            `json:"salt"`
+	Iterations int               `json:"iterations"`
+	Check      string            `json:"check"`
+	Secrets    map[string]string `json:"secrets"` // name -> base64(nonce + sealed value)
+}
+
+// SecretStore keeps a workspace's secret variables. It is shared by
+// parallel loop iterations and jobs
+type SecretStore struct {
+	mu       sync.Mutex
+	filePath string
+	file     secretFile
+	key      []byte            // nil while locked
+	values   map[string]string // decrypted on unlock
+}
+
+// NewSecretStore opens the secrets kept in filePath, locked
+func NewSecretStore(filePath string) *SecretStore {
+	s := &SecretStore{filePath: filePath}
+	if err := s.load(); err != nil {
+		core.PrintWarning(fmt.Sprintf("Could not read secrets: %v", err))
+	}
+	if s.file.Secrets == nil {
+		s.file.Secrets = make(map[string]string)
+	}
+	return s
+}
+
+func (s *SecretStore) load() error {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &s.file)
+}
+
+func (s *SecretStore) save() error {
+	data, err := json.MarshalIndent(s.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.filePath, data, 0600)
+}
+
+// Has reports whether name is a secret, locked or not
+func (s *SecretStore) Has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.file.Secrets[name]
+	return ok
+}
+
+// Names lists the secrets, sorted
+func (s *SecretStore) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.file.Secrets))
+	for name := range s.file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Locked reports whether the passphrase is still needed
+func (s *SecretStore) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.key == nil
+}
+
+// isNew reports whether no passphrase was ever chosen for the store
+func (s *SecretStore) isNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Salt == ""
+}
+
+// Unlock derives the key from the passphrase and decrypts every secret.
+// A new store takes the passphrase as its own
+func (s *SecretStore) Unlock(passphrase string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		key := pbkdf2SHA256([]byte(passphrase), salt, secretIterations, secretKeyLen)
+		check, err := sealSecret(key, secretCheck)
+		if err != nil {
+			return err
+		}
+		s.file.Salt = base64.StdEncoding.EncodeToString(salt)
+		s.file.Iterations = secretIterations
+		s.file.Check = check
+		s.key, s.values = key, make(map[string]string)
+		return nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(s.file.Salt)
+	if err != nil || s.file.Iterations <= 0 {
+		return fmt.Errorf("%s is damaged", s.filePath)
+	}
+	key := pbkdf2SHA256([]byte(passphrase), salt, s.file.Iterations, secretKeyLen)
+	if check, err := openSecret(key, s.file.Check); err != nil || check != secretCheck {
+		return errWrongPassphrase
+	}
+
+	values := make(map[string]string, len(s.file.Secrets))
+	for name, sealed := range s.file.Secrets {
+		value, err := openSecret(key, sealed)
+		if err != nil {
+			return fmt.Errorf("secret '%s' cannot be decrypted: %v", name, err)
+		}
+		values[name] = value
+	}
+	s.key, s.values = key, values
+	return nil
+}
+
+// Get returns a secret's value; the store must be unlocked
+func (s *SecretStore) Get(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// Values returns every decrypted value, none while locked
+func (s *SecretStore) Values() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make([]string, 0, len(s.values))
+	for _, value := range s.values {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Set encrypts and saves a secret; the store must be unlocked
+func (s *SecretStore) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key == nil {
+		return errors.New("secrets are locked")
+	}
+	sealed, err := sealSecret(s.key, value)
+	if err != nil {
+		return err
+	}
+	s.file.Secrets[name] = sealed
+	s.values[name] = value
+	return s.save()
+}
+
+// Delete removes a secret, locked or not
+func (s *SecretStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.file.Secrets, name)
+	delete(s.values, name)
+	return s.save()
+}
+
+// sealSecret encrypts a value with AES-GCM under a fresh nonce
+func sealSecret(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret reverses sealSecret
+func openSecret(key []byte, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("sealed value too short")
+	}
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	return string(value), err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key from a password as in RFC 8018, with
+// HMAC-SHA256 as the pseudorandom function
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		var index [4]byte
+		binary.BigEndian.PutUint32(index[:], uint32(block))
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(index[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// unlockSecrets makes the workspace's secrets readable, asking for the
+// passphrase if this session does not know it yet. It reports failures
+// itself
+func (cli *CLI) unlockSecrets() bool {
+	if !cli.secrets.Locked() {
+		return true
+	}
+
+	// $LMV_PASSPHRASE, or the passphrase given for an earlier workspace,
+	// before asking
+	cli.takeEnvPassphrase()
+	known := []string{cli.envPassphrase, cli.passphrase}
+	passphrase := ""
+	var tried error
+	for _, candidate := range known {
+		if candidate == "" {
+			continue
+		}
+		if cli.secrets.isNew() {
+			passphrase = candidate
+			break
+		}
+		if tried = cli.secrets.Unlock(candidate); tried == nil {
+			passphrase = candidate
+			break
+		}
+	}
+	if passphrase == "" {
+		var err error
+		if passphrase, err = cli.askPassphrase(); err != nil {
+			if tried != nil {
+				err = tried
+			}
+			core.PrintError(fmt.Sprintf("Secrets are locked: %v", err))
+			return false
+		}
+	}
+	if cli.secrets.Locked() {
+		if err := cli.secrets.Unlock(passphrase); err != nil {
+			core.PrintError(fmt.Sprintf("Secrets are locked: %v", err))
+			return false
+		}
+	}
+	cli.passphrase = passphrase
+	return true
+}
+
+// takeEnvPassphrase moves $LMV_PASSPHRASE out of the process environment,
+// which every module, shell command and wrapper inherits
+func (cli *CLI) takeEnvPassphrase() {
+	if value, ok := os.LookupEnv(passphraseEnv); ok {
+		cli.envPassphrase = value
+		os.Unsetenv(passphraseEnv)
+	}
+}
+
+// askPassphrase reads the passphrase from the terminal, twice when it is
+// being chosen
+func (cli *CLI) askPassphrase() (string, error) {
+	if cli.secrets.isNew() {
+		passphrase, err := cli.readPassword("New passphrase for secrets: ")
+		if err != nil {
+			return "", err
+		}
+		if passphrase == "" {
+			return "", errors.New("empty passphrase")
+		}
+		again, err := cli.readPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+		return passphrase, nil
+	}
+	return cli.readPassword(fmt.Sprintf("Passphrase for the secrets of workspace '%s': ", cli.workspace.Name))
+}
+
+// readPassword reads a line without echoing it
+func (cli *CLI) readPassword(prompt string) (string, error) {
+	var value []byte
+	var err error
+	switch {
+	case cli.noPrompt:
+		return "", fmt.Errorf("cannot ask for the passphrase in the background, use a secret at the prompt first or set %s", passphraseEnv)
+	case cli.rl != nil:
+		value, err = cli.rl.ReadPassword(prompt)
+	case readline.IsTerminal(int(os.Stdin.Fd())):
+		value, err = readline.Password(prompt)
+	default:
+		return "", fmt.Errorf("no terminal to ask on, set %s", passphraseEnv)
+	}
+	return string(value), err
+}
+
+// secretValue returns a secret's value, unlocking the store if needed
+func (cli *CLI) secretValue(name string) (string, bool) {
+	if !cli.unlockSecrets() {
+		return "", false
+	}
+	return cli.secrets.Get(name)
+}
+
+// moduleSecrets lists the stored secrets a module declares in its
+// module.yaml. A module without one gets none
+func (cli *CLI) moduleSecrets(moduleName string) []string {
+	module, err := cli.manager.GetModule(moduleName)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, name := range cli.secrets.Names() {
+		if module.Metadata.Declares(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// secretWordRegex finds the words of a statement that may name a secret
+// or a module
+var secretWordRegex = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_.-]*`)
+
+// referencesSecret reports whether a statement's text uses a stored
+// secret, as a variable or through a module that takes it
+func (cli *CLI) referencesSecret(text string) bool {
+	for _, word := range secretWordRegex.FindAllString(text, -1) {
+		if cli.secrets.Has(word) || len(cli.moduleSecrets(word)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecretName reports whether a variable holds a secret: it is one, or
+// some module declares an option of that name with type secret
+func (cli *CLI) isSecretName(name string) bool {
+	if cli.secrets.Has(name) {
+		return true
+	}
+	for _, module := range cli.manager.ListModules() {
+		if module.Metadata != nil && module.Metadata.Options[name].IsSecret() {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValues lists the values to mask: unlocked secrets, the passphrase
+// and variables named like secrets
+func (cli *CLI) secretValues() []string {
+	values := append(cli.secrets.Values(), cli.envPassphrase, cli.passphrase)
+	for _, vars := range []map[string]string{cli.vars, cli.envMgr.GetAll(), cli.globalEnv.GetAll()} {
+		for name, value := range vars {
+			if cli.isSecretName(name) {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+// shownValue is a variable's value as it may be printed
+func (cli *CLI) shownValue(name, value string) string {
+	if cli.isSecretName(name) {
+		return core.RedactMask
+	}
+	return value
+}
+
+// maskVars returns vars with secret values masked, for a module's run
+// record: secret names, the module's secret options and any known secret
+// value
+func (cli *CLI) maskVars(moduleName string, vars map[string]string) map[string]string {
+	var options map[string]core.OptionMeta
+	if module, err := cli.manager.GetModule(moduleName); err == nil && module.Metadata != nil {
+		options = module.Metadata.Options
+	}
+	redactor := core.NewRedactor(cli.secretValues())
+
+	masked := make(map[string]string, len(vars))
+	for name, value := range vars {
+		if options[name].IsSecret() || cli.isSecretName(name) {
+			value = core.RedactMask
+		}
+		masked[name] = redactor.String(value)
+	}
+	return masked
+}
+
+// historyAssignRegex finds name=value words in a command line
+var historyAssignRegex = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)=("[^"]*"|'[^']*'|\S+)`)
+
+// maskHistory masks secrets in a command line before it is kept in the
+// history: every value given to `secret`, values of secret names, and
+// any known secret value
+func (cli *CLI) maskHistory(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return line
+	}
+	all := fields[0] == "secret"
+
+	line = historyAssignRegex.ReplaceAllStringFunc(line, func(m string) string {
+		name := m[:strings.Index(m, "=")]
+		if all || cli.isSecretName(name) {
+			return name + "=" + core.RedactMask
+		}
+		return m
+	})
+	// set name value, setg name value and env set name value, the value
+	// possibly quoted or of several words
+	command := fields[:1]
+	if (fields[0] == "env" || fields[0] == "envs") && len(fields) > 1 {
+		command = fields[:2]
+	}
+	rest := fields[len(command):]
+	switch strings.Join(command, " ") {
+	case "set", "setg", "env set", "envs set":
+		if len(rest) >= 2 && cli.isSecretName(rest[0]) {
+			line = strings.Join(append(append([]string(nil), command...), rest[0], core.RedactMask), " ")
+		}
+	}
+	return core.NewRedactor(cli.secretValues()).String(line)
+}
+
+// saveVar saves a variable in the workspace, or among the secrets when it
+// is one. It reports the scope it went to
+func (cli *CLI) saveVar(name, value string) (string, error) {
+	if cli.isSecretName(name) {
+		if !cli.unlockSecrets() {
+			return "", errors.New("secrets are locked")
+		}
+		return scopeSecret, cli.secrets.Set(name, value)
+	}
+	if !cli.workspaceScope() {
+		return scopeGlobal, cli.envMgr.Set(name, value)
+	}
+	return scopeWorkspace, cli.envMgr.Set(name, value)
+}
+
+// SecretCommand handles `secret` (list), `secret name=value...` and
+// `secret name`, which asks for the value without echoing it
+func (cli *CLI) SecretCommand(args []Word) {
+	if len(args) == 0 {
+		cli.listSecrets()
+		return
+	}
+
+	var pairs [][2]string
+	if len(args) == 1 && !args[0].IsAssign() {
+		name := args[0].Value
+		if !isValidIdentifier(name) {
+			cli.usageError(fmt.Sprintf("Invalid variable name '%s'", name))
+			return
+		}
+		value, err := cli.readPassword(fmt.Sprintf("Value for %s: ", name))
+		if err != nil {
+			cli.lastExit = 1
+			core.PrintError(fmt.Sprintf("Could not read the value: %v", err))
+			return
+		}
+		pairs = append(pairs, [2]string{name, value})
+	} else {
+		var ok bool
+		if pairs, ok = setPairs(args); !ok || len(args) == 2 && !args[0].IsAssign() {
+			cli.usageError("Usage: secret <name>=<value>... | secret <name>")
+			return
+		}
+	}
+
+	if !cli.unlockSecrets() {
+		cli.lastExit = 1
+		return
+	}
+	for _, pair := range pairs {
+		name, value := pair[0], pair[1]
+		if !isValidIdentifier(name) {
+			cli.usageError(fmt.Sprintf("Invalid variable name '%s'", name))
+			return
+		}
+		if err := cli.secrets.Set(name, value); err != nil {
+			cli.lastExit = 1
+			core.PrintError(fmt.Sprintf("Failed to save secret: %v", err))
+			return
+		}
+		// A plain copy left in env.json, the workspace's or the global
+		// one, would defeat the point
+		for _, env := range []*EnvironmentManager{cli.envMgr, cli.globalEnv} {
+			if _, ok := env.Get(name); ok {
+				env.Delete(name)
+			}
+		}
+		if !cli.quiet {
+			core.PrintSuccess(fmt.Sprintf("Set %s = %s (%s)", name, core.RedactMask, scopeSecret))
+		}
+	}
+}
+
+func (cli *CLI) listSecrets() {
+	names := cli.secrets.Names()
+	if cli.jsonOut {
+		cli.printJSON(names)
+		return
+	}
+	if len(names) == 0 {
+		core.PrintInfo("No secrets set, use 'secret <name>=<value>' or 'secret <name>'")
+		fmt.Println()
+		return
+	}
+	state := "locked"
+	if !cli.secrets.Locked() {
+		state = "unlocked"
+	}
+	fmt.Println()
+	fmt.Println(core.NmapBox(fmt.Sprintf("SECRETS (%d, %s)", len(names), state)))
+	for i, name := range names {
+		prefix := "   ├─ "
+		if i == len(names)-1 {
+			prefix = "   └─ "
+		}
+		fmt.Printf("%s%s = %s\n", prefix, core.Color("cyan", name), core.RedactMask)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lanmanvan/core"
+)
+
+// captureStdout returns what fn prints to the terminal
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+// Test vectors of RFC 7914, section 11
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"passwd", "salt", 1, 20, "55ac046e56e3089fec1691c22544b605f9418521"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+		}
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	key := pbkdf2SHA256([]byte("pass"), []byte("salt"), 1, secretKeyLen)
+	for _, value := range []string{"", "hunter2", "ünïcödé and spaces"} {
+		sealed, err := sealSecret(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := openSecret(key, sealed); err != nil || got != value {
+			t.Errorf("openSecret(sealSecret(%q)) = %q, %v", value, got, err)
+		}
+	}
+
+	sealed, _ := sealSecret(key, "hunter2")
+	other := pbkdf2SHA256([]byte("other"), []byte("salt"), 1, secretKeyLen)
+	if _, err := openSecret(other, sealed); err == nil {
+		t.Error("opened with the wrong key")
+	}
+}
+
+func TestSecretStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	store := NewSecretStore(path)
+	if err := store.Set("pass", "x"); err == nil {
+		t.Fatal("Set on a locked store succeeded")
+	}
+	if err := store.Unlock("right"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("pass", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewSecretStore(path)
+	if !reopened.Locked() || !reopened.Has("pass") {
+		t.Fatalf("reopened store: locked=%t has=%t, want locked with pass", reopened.Locked(), reopened.Has("pass"))
+	}
+	if err := reopened.Unlock("wrong"); err != errWrongPassphrase {
+		t.Errorf("Unlock(wrong) = %v, want %v", err, errWrongPassphrase)
+	}
+	if err := reopened.Unlock("right"); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := reopened.Get("pass"); !ok || value != "hunter2" {
+		t.Errorf("Get(pass) = %q, %t", value, ok)
+	}
+}
+
+// Making a variable secret removes its plain copies, global ones too
+func TestSecretRemovesPlainCopies(t *testing.T) {
+	cli := newTestCLI(t)
+	t.Setenv(passphraseEnv, "pp")
+	if err := cli.UseWorkspace("engagement", true); err != nil {
+		t.Fatal(err)
+	}
+
+	cli.ExecuteCommand("setg token=global")
+	cli.ExecuteCommand("env set token workspace")
+	cli.ExecuteCommand("secret token=s3cret")
+	if cli.lastExit != 0 {
+		t.Fatalf("secret exit = %d", cli.lastExit)
+	}
+	if value, ok := cli.globalEnv.Get("token"); ok {
+		t.Errorf("global copy left: %q", value)
+	}
+	if value, ok := cli.envMgr.Get("token"); ok {
+		t.Errorf("workspace copy left: %q", value)
+	}
+	if value, _ := cli.secrets.Get("token"); value != "s3cret" {
+		t.Errorf("secret = %q, want s3cret", value)
+	}
+}
+
+// env set confirms a secret without showing its value
+func TestEnvSetHidesSecret(t *testing.T) {
+	cli := newTestCLI(t)
+	t.Setenv(passphraseEnv, "pp")
+	cli.ExecuteCommand("secret token=first")
+
+	for _, jsonOut := range []bool{false, true} {
+		cli.jsonOut = jsonOut
+		output := captureStdout(t, func() { cli.ExecuteCommand("env set token hunter2") })
+		if cli.lastExit != 0 {
+			t.Fatalf("env set exit = %d", cli.lastExit)
+		}
+		if strings.Contains(output, "hunter2") || !strings.Contains(output, core.RedactMask) {
+			t.Errorf("json=%t: env set printed %q", jsonOut, output)
+		}
+	}
+	if value, _ := cli.secrets.Get("token"); value != "hunter2" {
+		t.Errorf("secret = %q, want hunter2", value)
+	}
+}
+
+func TestMaskHistory(t *testing.T) {
+	cli := newTestCLI(t)
+	t.Setenv(passphraseEnv, "pp")
+	cli.ExecuteCommand("secret token=s3cret")
+
+	mask := core.RedactMask
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"env set token hunter2", "env set token " + mask},
+		{`env set token "two words"`, "env set token " + mask},
+		{"envs set token=hunter2", "envs set token=" + mask},
+		{"set token hunter2", "set token " + mask},
+		{"setg token hunter2", "setg token " + mask},
+		{"scan token=hunter2 target=x", "scan token=" + mask + " target=x"},
+		{"secret api=abc", "secret api=" + mask},
+		{"scan target=s3cret", "scan target=" + mask},
+		{"env set target 10.0.0.1", "env set target 10.0.0.1"},
+		{"env get token", "env get token"},
+		{"env set token", "env set token"},
+	}
+	for _, tt := range tests {
+		if got := cli.maskHistory(tt.line); got != tt.want {
+			t.Errorf("maskHistory(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// $LMV_PASSPHRASE unlocks the secrets but reaches no module or shell
+// command, and never shows
+func TestPassphraseLeavesEnvironment(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(passphraseEnv, "correct horse")
+	modules := t.TempDir()
+	dir := filepath.Join(modules, "envdump")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "module.yaml"), []byte("name: envdump\ntype: bash\npassthrough_env: true\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.sh"), []byte("#!/bin/bash\nenv\n"), 0755)
+
+	cli := NewCLI(modules)
+	cli.RefreshModules()
+	if _, ok := os.LookupEnv(passphraseEnv); ok {
+		t.Fatalf("%s is still in the environment", passphraseEnv)
+	}
+	cli.ExecuteCommand("secret token=s3cret")
+	if cli.lastExit != 0 {
+		t.Fatalf("secret exit = %d", cli.lastExit)
+	}
+	if _, ok := cli.lookupVar(passphraseEnv); ok {
+		t.Errorf("$%s expands", passphraseEnv)
+	}
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+	for _, command := range []string{
+		"envdump > " + out,
+		"$ bash env >> " + out,
+		"$ bash echo \"[$" + passphraseEnv + "]\" >> " + out,
+	} {
+		cli.ExecuteCommand(command)
+		if cli.lastExit != 0 {
+			t.Fatalf("%s: exit = %d", command, cli.lastExit)
+		}
+	}
+	data, _ := os.ReadFile(out)
+	if strings.Contains(string(data), "correct horse") || strings.Contains(string(data), passphraseEnv) {
+		t.Errorf("the passphrase reached a child process:\n%s", data)
+	}
+	if !strings.Contains(string(data), "[]") {
+		t.Errorf("shell output missing:\n%s", data)
+	}
+	if got := cli.maskHistory("echo correct horse"); strings.Contains(got, "correct horse") {
+		t.Errorf("maskHistory kept the passphrase: %q", got)
+	}
+}
@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"os/user"
 	"strings"
+	"syscall"
 	"time"
 
 	"lanmanvan/core"
@@ -35,34 +37,31 @@ func (cli *CLI) ExecuteShellCommand(input string) {
 		return
 	}
 
-	var shell string
-	var cmd *exec.Cmd
-
-	// Determine which shell to use
-	if strings.HasPrefix(input, "bash ") {
-		shell = "bash"
-		input = strings.TrimPrefix(input, "bash ")
-		cmd = exec.Command("bash", "-c", input)
-	} else if strings.HasPrefix(input, "zsh ") {
-		shell = "zsh"
-		input = strings.TrimPrefix(input, "zsh ")
-		cmd = exec.Command("zsh", "-c", input)
-	} else {
-		// Default to zsh
-		shell = "zsh"
-		cmd = exec.Command("zsh", "-c", input)
+	shell, input := selectShell(input)
+	cmd, err := cli.shellCommand(shell, input)
+	if err != nil {
+		cli.lastExit = 1
+		core.PrintError(err.Error())
+		return
 	}
 
 	startTime := time.Now()
-	fmt.Println()
-	core.PrintInfo(fmt.Sprintf("Executing in %s", core.Color("cyan", shell)))
+	if !cli.quiet {
+		fmt.Println()
+		core.PrintInfo(fmt.Sprintf("Executing in %s", core.Color("cyan", shell)))
+	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	cmd.Stdout = cli.out()
+	cmd.Stderr = cli.errOut()
 	cmd.Dir = CurrentDir // Set working directory
 
-	err := cmd.Run()
+	if cli.ctx != nil {
+		// A background job: keep it off the terminal, like a module
+		err = core.RunDetached(cli.ctx, shell, cmd, cli.processes().track)
+	} else {
+		cmd.Stdin = os.Stdin
+		err = cmd.Run()
+	}
 	duration := time.Since(startTime)
 
 	// Update current directory if cd command
@@ -79,12 +78,18 @@ func (cli *CLI) ExecuteShellCommand(input string) {
 				updateDir = exec.Command(shell, "-c", fmt.Sprintf("cd %s && pwd", newDir))
 			}
 			updateDir.Dir = CurrentDir
+			updateDir.Env = cmd.Env
 			if output, err := updateDir.Output(); err == nil {
 				CurrentDir = strings.TrimSpace(string(output))
 			}
 		}
 	}
 
+	cli.lastExit = exitCode(err)
+	if cli.quiet {
+		return
+	}
+
 	fmt.Println()
 	if err == nil {
 		core.PrintSuccess(fmt.Sprintf("Command completed in %s", duration.String()))
@@ -93,3 +98,75 @@ func (cli *CLI) ExecuteShellCommand(input string) {
 	}
 	fmt.Println()
 }
+
+// shellCommand builds the process for a shell stage. In a loop body the
+// loop variables are passed in its environment and the shell expands them
+// itself, so a value from a file or a module is never read as shell syntax
+func (cli *CLI) shellCommand(shell, input string) (*exec.Cmd, error) {
+	cmd := exec.Command(shell, "-c", input)
+	if env := cli.loop.environ(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return core.WrapCommand(cmd, cli.wrappers)
+}
+
+// exitCode maps a command error to a shell-style exit status. A command
+// killed by a signal exits with 128 plus its number, so Ctrl+C gives
+// exitInterrupted
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, errInterrupted) {
+		return exitInterrupted
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		if exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode()
+		}
+	}
+	return 1
+}
+
+// selectShell picks the shell for a command line: an explicit "bash " or
+// "zsh " prefix wins, otherwise zsh, falling back to bash and sh when
+// zsh is not installed
+func selectShell(input string) (string, string) {
+	if strings.HasPrefix(input, "bash ") {
+		return "bash", strings.TrimPrefix(input, "bash ")
+	}
+	if strings.HasPrefix(input, "zsh ") {
+		return "zsh", strings.TrimPrefix(input, "zsh ")
+	}
+	for _, shell := range []string{"zsh", "bash", "sh"} {
+		if _, err := exec.LookPath(shell); err == nil {
+			return shell, input
+		}
+	}
+	return "sh", input
+}
+
+// runShellCaptured runs a shell command with the given stdin and returns its stdout.
+// Stderr goes to the current error output so errors stay visible
+func (cli *CLI) runShellCaptured(input string, stdin string) (string, error) {
+	input = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), "$"))
+	if input == "" {
+		return "", fmt.Errorf("empty shell command")
+	}
+
+	shell, input := selectShell(input)
+	cmd, err := cli.shellCommand(shell, input)
+	if err != nil {
+		return "", err
+	}
+	cmd.Dir = CurrentDir
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stderr = cli.errOut()
+
+	output, err := cmd.Output()
+	return string(output), err
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	run := func(script string) error {
+		return exec.Command("sh", "-c", script).Run()
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"exit status", run("exit 3"), 3},
+		{"interrupted", run("kill -INT $$"), exitInterrupted},
+		{"terminated", run("kill -TERM $$"), 143},
+		{"killed", run("kill -KILL $$"), 137},
+		{"wrapped exit status", fmt.Errorf("stage 1: %w", run("exit 4")), 4},
+		{"interrupted module", fmt.Errorf("stage 2: module 'x' was %w", errInterrupted), exitInterrupted},
+		{"other error", errors.New("no such module"), 1},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+// A shell stage stopped with Ctrl+C stops a sequential loop
+func TestLoopStopsOnInterruptedShell(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	cli := newTestCLI(t)
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	tests := []string{
+		"for i in 1..3 -> $ bash echo $i >> " + out + "; kill -INT $$",
+		"for i in 1..3 -> $ bash echo $i >> " + out + "; kill -INT $$ |> $ cat",
+	}
+	for _, command := range tests {
+		cli.ExecuteCommand(command)
+		if cli.lastExit != exitInterrupted {
+			t.Errorf("%s: exit = %d, want %d", command, cli.lastExit, exitInterrupted)
+		}
+	}
+	if data, _ := os.ReadFile(out); string(data) != "1\n1\n" {
+		t.Errorf("iterations ran: %q, want one per loop", data)
+	}
+}
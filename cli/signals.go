@@ -1,30 +1,108 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
+
+	"lanmanvan/core"
 )
 
-// ModuleExecutor tracks the currently running module process
+// exitInterrupted is the exit status of a run stopped with Ctrl+C, as in shells
+const exitInterrupted = 130
+
+// errInterrupted is returned for a pipe stage stopped with Ctrl+C
+var errInterrupted = errors.New("interrupted")
+
+// exitTimedOut is the exit status of a run stopped by its timeout, as with timeout(1)
+const exitTimedOut = 124
+
+// ModuleExecutor tracks the currently running module processes
 type ModuleExecutor struct {
-	running bool
-	pid     int
+	mu         sync.Mutex
+	procs      map[*core.Process]struct{}
+	interrupts int // Ctrl+C presses since the running processes started
+}
+
+// moduleExecutor is a global instance tracking foreground module execution
+var moduleExecutor = newModuleExecutor()
+
+func newModuleExecutor() *ModuleExecutor {
+	return &ModuleExecutor{procs: make(map[*core.Process]struct{})}
 }
 
-// moduleExecutor is a global instance tracking module execution
-var moduleExecutor = &ModuleExecutor{running: false, pid: 0}
+// track records a started module process until it exits. It is used as
+// core.ExecOptions.OnStart
+func (e *ModuleExecutor) track(p *core.Process) {
+	e.mu.Lock()
+	e.procs[p] = struct{}{}
+	e.mu.Unlock()
 
-// startModuleExecution marks the start of module execution
-func (cli *CLI) startModuleExecution() {
-	moduleExecutor.running = true
+	go func() {
+		<-p.Done()
+		e.mu.Lock()
+		delete(e.procs, p)
+		if len(e.procs) == 0 {
+			e.interrupts = 0
+		}
+		e.mu.Unlock()
+	}()
 }
 
-// stopModuleExecution marks the end of module execution
-func (cli *CLI) stopModuleExecution() {
-	moduleExecutor.running = false
-	moduleExecutor.pid = 0
+// running returns the tracked processes
+func (e *ModuleExecutor) running() []*core.Process {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	procs := make([]*core.Process, 0, len(e.procs))
+	for p := range e.procs {
+		procs = append(procs, p)
+	}
+	return procs
+}
+
+// interrupt handles one Ctrl+C: the first press sends SIGINT to every
+// module's process group, the next ones send SIGTERM followed by SIGKILL
+// after core.KillGracePeriod. It reports whether any module was running
+func (e *ModuleExecutor) interrupt() bool {
+	procs := e.running()
+	if len(procs) == 0 {
+		return false
+	}
+
+	e.mu.Lock()
+	e.interrupts++
+	presses := e.interrupts
+	e.mu.Unlock()
+
+	fmt.Println()
+	if presses == 1 {
+		for _, p := range procs {
+			_ = p.Interrupt()
+		}
+		core.PrintWarning(fmt.Sprintf("Interrupting %s, press Ctrl+C again to terminate", describeProcesses(procs)))
+		return true
+	}
+
+	for _, p := range procs {
+		_ = p.Terminate()
+		// The group is killed even if the leader exits first, children
+		// left behind would otherwise keep running
+		time.AfterFunc(core.KillGracePeriod, func() { _ = p.Kill() })
+	}
+	core.PrintWarning(fmt.Sprintf("Terminating %s, killing in %s if still running", describeProcesses(procs), core.KillGracePeriod))
+	return true
+}
+
+// describeProcesses names the module for one process, or counts them
+func describeProcesses(procs []*core.Process) string {
+	if len(procs) == 1 {
+		return fmt.Sprintf("'%s' (pgid %d)", procs[0].Module, procs[0].Pgid)
+	}
+	return fmt.Sprintf("%d module processes", len(procs))
 }
 
 // setupSignalHandler sets up Ctrl+C handling
@@ -34,20 +112,18 @@ func (cli *CLI) setupSignalHandler() {
 
 	go func() {
 		for range sigChan {
-			if moduleExecutor.running {
-				// Module is running - just mark it as interrupted
-				// The module process will handle its own cleanup
-				fmt.Println()
-				fmt.Println()
-				// Return to prompt without exiting the CLI
+			// Modules run in their own process group and do not see the
+			// terminal's SIGINT, so it is forwarded to them
+			if moduleExecutor.interrupt() {
 				continue
-			} else {
-				// CLI is idle - ask user if they want to exit
-				fmt.Println()
-				fmt.Println()
-				// Just continue, readline will handle the interrupt
+			}
+			// The prompt may be blocked on a job with fg or wait
+			if cli.jobs.interrupt() {
 				continue
 			}
+			// CLI is idle or running a shell command (which receives the
+			// signal itself); readline handles the prompt
+			fmt.Println()
 		}
 	}()
 }
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"lanmanvan/core"
+)
+
+// A module that ignores SIGINT and SIGTERM survives the first Ctrl+C and is
+// killed once the grace period after the second one is over
+func TestInterruptKillsStubbornModule(t *testing.T) {
+	cli := newTestCLI(t)
+	ready := filepath.Join(t.TempDir(), "ready")
+	dir := filepath.Join(cli.manager.ModulesDir, "stubborn")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "main.sh"), []byte("#!/bin/bash\ntrap '' INT TERM\ntouch "+ready+"\nsleep 30\n"), 0755)
+	cli.RefreshModules()
+
+	executor := newModuleExecutor()
+	opts := cli.runOptions()
+	opts.OnStart = executor.track
+	opts.Foreground = true
+	done := make(chan *core.ExecutionResult, 1)
+	go func() {
+		result, err := cli.manager.ExecuteModuleWith("stubborn", nil, opts)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the module did not start")
+		}
+	}
+
+	if !executor.interrupt() {
+		t.Fatal("interrupt() found no running module")
+	}
+	select {
+	case <-done:
+		t.Fatal("the module stopped on SIGINT although it ignores it")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	pressed := time.Now()
+	executor.interrupt()
+	select {
+	case result := <-done:
+		if elapsed := time.Since(pressed); elapsed > core.KillGracePeriod+time.Second {
+			t.Errorf("killed after %s, want within %s", elapsed, core.KillGracePeriod)
+		}
+		if result == nil {
+			return
+		}
+		if !result.Interrupted || result.ExitCode != 128+int(syscall.SIGKILL) {
+			t.Errorf("result: interrupted=%t exit=%d, want interrupted with exit %d", result.Interrupted, result.ExitCode, 128+int(syscall.SIGKILL))
+		}
+	case <-time.After(core.KillGracePeriod + 5*time.Second):
+		t.Fatal("the module was not killed")
+	}
+}
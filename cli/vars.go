@@ -0,0 +1,335 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"lanmanvan/core"
+)
+
+// Variables live in layered scopes. From the weakest to the strongest:
+//
+//	global      setg name=value      ~/.lanmanvan/env.json, every workspace
+//	workspace   name=value           the workspace's env.json
+//	secret      secret name=value    the workspace's secrets.json, encrypted
+//	session     set name=value       this session only, never saved
+//	module      set -m mod k=v       this session, one module only
+//
+// $name expands to the strongest value outside the module scope. A module
+// gets every scope merged, its own key=value arguments winning over all,
+// and keeps the options it declares. In the default workspace the
+// workspace and global scopes are one file
+
+const (
+	scopeGlobal    = "global"
+	scopeWorkspace = "workspace"
+	scopeSecret    = "secret"
+	scopeSession   = "session"
+	scopeModule    = "module"
+)
+
+// scopedVar is a variable as shown by `env`
+type scopedVar struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Scope    string `json:"scope"`
+	Module   string `json:"module,omitempty"`
+	Shadowed bool   `json:"shadowed,omitempty"` // a stronger scope has the same name
+}
+
+// workspaceScope reports whether the workspace has variables of its own,
+// apart from the global ones
+func (cli *CLI) workspaceScope() bool {
+	return cli.envMgr != cli.globalEnv
+}
+
+// lookupScoped resolves a variable from the session, secret, workspace and
+// global scopes and tells which one it came from
+func (cli *CLI) lookupScoped(name string) (string, string, bool) {
+	if val, ok := cli.vars[name]; ok {
+		return val, scopeSession, true
+	}
+	if cli.secrets.Has(name) {
+		val, ok := cli.secretValue(name)
+		return val, scopeSecret, ok
+	}
+	if cli.workspaceScope() {
+		if val, ok := cli.envMgr.Get(name); ok {
+			return val, scopeWorkspace, true
+		}
+	}
+	if val, ok := cli.globalEnv.Get(name); ok {
+		return val, scopeGlobal, true
+	}
+	return "", "", false
+}
+
+// scopeOf names the scope $name comes from, "" when it is not set
+func (cli *CLI) scopeOf(name string) string {
+	if _, ok := cli.vars[name]; ok {
+		return scopeSession
+	}
+	if cli.secrets.Has(name) {
+		return scopeSecret
+	}
+	_, scope, _ := cli.lookupScoped(name)
+	return scope
+}
+
+// moduleVars merges every scope for a module run, the strongest last. The
+// module is passed only the ones it declares, see core.DeclaredArguments
+func (cli *CLI) moduleVars(module string) map[string]string {
+	merged := make(map[string]string)
+	layers := []map[string]string{cli.globalEnv.GetAll()}
+	if cli.workspaceScope() {
+		layers = append(layers, cli.envMgr.GetAll())
+	}
+	// The passphrase is only asked for when the module takes a secret
+	if names := cli.moduleSecrets(module); len(names) > 0 && cli.unlockSecrets() {
+		secrets := make(map[string]string, len(names))
+		for _, name := range names {
+			secrets[name], _ = cli.secrets.Get(name)
+		}
+		layers = append(layers, secrets)
+	}
+	layers = append(layers, cli.vars, cli.moduleScope[module])
+	for _, layer := range layers {
+		for key, value := range layer {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// scopedVars lists every variable of every scope, sorted by name with the
+// strongest scope first
+func (cli *CLI) scopedVars() []scopedVar {
+	var list []scopedVar
+	add := func(scope, module string, vars map[string]string) {
+		for name, value := range vars {
+			list = append(list, scopedVar{Name: name, Value: value, Scope: scope, Module: module})
+		}
+	}
+	for module, vars := range cli.moduleScope {
+		add(scopeModule, module, vars)
+	}
+	add(scopeSession, "", cli.vars)
+	for _, name := range cli.secrets.Names() {
+		list = append(list, scopedVar{Name: name, Value: core.RedactMask, Scope: scopeSecret})
+	}
+	if cli.workspaceScope() {
+		add(scopeWorkspace, "", cli.envMgr.GetAll())
+	}
+	add(scopeGlobal, "", cli.globalEnv.GetAll())
+
+	rank := map[string]int{scopeModule: 0, scopeSession: 1, scopeSecret: 2, scopeWorkspace: 3, scopeGlobal: 4}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		if list[i].Scope != list[j].Scope {
+			return rank[list[i].Scope] < rank[list[j].Scope]
+		}
+		return list[i].Module < list[j].Module
+	})
+
+	// Module values only shadow within their module, so only the others count
+	seen := make(map[string]bool)
+	for i := range list {
+		list[i].Value = cli.shownValue(list[i].Name, list[i].Value)
+		if list[i].Scope == scopeModule {
+			continue
+		}
+		list[i].Shadowed = seen[list[i].Name]
+		seen[list[i].Name] = true
+	}
+	return list
+}
+
+// displayVars prints every variable with the scope it comes from
+func (cli *CLI) displayVars() {
+	list := cli.scopedVars()
+	if cli.jsonOut {
+		if list == nil {
+			list = []scopedVar{}
+		}
+		cli.printJSON(list)
+		return
+	}
+	if len(list) == 0 {
+		core.PrintWarning("No variables set, use 'set <key>=<value>' for this session or 'setg <key>=<value>' for good")
+		fmt.Println()
+		return
+	}
+
+	table := core.NewTable([]string{"Name", "Value", "Scope"})
+	for _, v := range list {
+		scope := v.Scope
+		if v.Module != "" {
+			scope += " (" + v.Module + ")"
+		}
+		if v.Shadowed {
+			scope += ", shadowed"
+		}
+		table.AddRow(v.Name, v.Value, scope)
+	}
+	fmt.Println()
+	fmt.Println(core.NmapBox("VARIABLES"))
+	fmt.Println(table.Render())
+	fmt.Println()
+}
+
+// SetCommand handles `set` (session), `set -m <module>` (module) and
+// `setg` (global). Each takes name=value pairs, or a single name value;
+// without them it lists the variables
+func (cli *CLI) SetCommand(cmd string, args []Word) {
+	usage := "Usage: set [-m <module>] <name>=<value>... | set <name> <value> | setg <name>=<value>..."
+	if len(args) == 0 {
+		cli.displayVars()
+		return
+	}
+
+	scope, module := scopeSession, ""
+	var config *core.ModuleConfig
+	if cmd == "setg" {
+		scope = scopeGlobal
+	} else if args[0].Value == "-m" {
+		if len(args) < 2 {
+			cli.usageError(usage)
+			return
+		}
+		module = args[1].Value
+		var err error
+		if config, err = cli.manager.GetModule(module); err != nil {
+			cli.lastExit = 127
+			core.PrintError(fmt.Sprintf("Module not found: %s, try: 'search %s'", module, module))
+			return
+		}
+		scope, args = scopeModule, args[2:]
+	}
+
+	pairs, ok := setPairs(args)
+	if !ok {
+		cli.usageError(usage)
+		return
+	}
+
+	for _, pair := range pairs {
+		name, value := pair[0], pair[1]
+		if !isValidIdentifier(name) {
+			cli.usageError(fmt.Sprintf("Invalid variable name '%s'", name))
+			return
+		}
+		where := scope
+		switch {
+		case scope == scopeGlobal && cli.isSecretName(name):
+			// Saved secrets are kept encrypted, in the workspace
+			if !cli.unlockSecrets() {
+				cli.lastExit = 1
+				return
+			}
+			if err := cli.secrets.Set(name, value); err != nil {
+				cli.lastExit = 1
+				core.PrintError(fmt.Sprintf("Failed to save secret: %v", err))
+				return
+			}
+			where = scopeSecret
+		case scope == scopeGlobal:
+			if err := cli.globalEnv.Set(name, value); err != nil {
+				cli.lastExit = 1
+				core.PrintError(fmt.Sprintf("Failed to set variable: %v", err))
+				return
+			}
+		case scope == scopeModule:
+			cli.warnUnknownArguments(config, map[string]string{name: value})
+			if cli.moduleScope[module] == nil {
+				cli.moduleScope[module] = make(map[string]string)
+			}
+			cli.moduleScope[module][name] = value
+			where += " " + module
+		default:
+			cli.vars[name] = value
+		}
+		if !cli.quiet {
+			core.PrintSuccess(fmt.Sprintf("Set %s = %s (%s)", name, cli.shownValue(name, value), where))
+		}
+	}
+}
+
+// setPairs reads name=value words, or a lone name followed by its value
+func setPairs(args []Word) ([][2]string, bool) {
+	if len(args) == 2 && !args[0].IsAssign() {
+		return [][2]string{{args[0].Value, args[1].Value}}, true
+	}
+	var pairs [][2]string
+	for _, arg := range args {
+		if !arg.IsAssign() {
+			return nil, false
+		}
+		pairs = append(pairs, [2]string{arg.Key, arg.Val})
+	}
+	return pairs, len(pairs) > 0
+}
+
+// UnsetCommand handles `unset [-m <module> | -g] <name>...`. Without a flag
+// a name is removed from the strongest scope that has it, as $name would
+// see it
+func (cli *CLI) UnsetCommand(args []string) {
+	usage := "Usage: unset [-m <module> | -g] <name>..."
+	module, global := "", false
+	switch {
+	case len(args) > 0 && args[0] == "-m":
+		if len(args) < 2 {
+			cli.usageError(usage)
+			return
+		}
+		module, args = args[1], args[2:]
+	case len(args) > 0 && args[0] == "-g":
+		global, args = true, args[1:]
+	}
+	if len(args) == 0 {
+		cli.usageError(usage)
+		return
+	}
+
+	for _, name := range args {
+		var scope string
+		var err error
+		switch {
+		case module != "":
+			if _, ok := cli.moduleScope[module][name]; ok {
+				delete(cli.moduleScope[module], name)
+				scope = scopeModule + " " + module
+			}
+		case global:
+			if _, ok := cli.globalEnv.Get(name); ok {
+				err = cli.globalEnv.Delete(name)
+				scope = scopeGlobal
+			}
+		default:
+			// Without reading a secret, which would need the passphrase
+			scope = cli.scopeOf(name)
+			switch scope {
+			case scopeSession:
+				delete(cli.vars, name)
+			case scopeSecret:
+				err = cli.secrets.Delete(name)
+			case scopeWorkspace:
+				err = cli.envMgr.Delete(name)
+			case scopeGlobal:
+				err = cli.globalEnv.Delete(name)
+			}
+		}
+
+		switch {
+		case err != nil:
+			cli.lastExit = 1
+			core.PrintError(fmt.Sprintf("Failed to unset variable: %v", err))
+		case scope == "":
+			cli.lastExit = 1
+			core.PrintWarning(fmt.Sprintf("Variable '%s' not set", name))
+		case !cli.quiet:
+			core.PrintSuccess(fmt.Sprintf("Unset %s (%s)", name, scope))
+		}
+	}
+}
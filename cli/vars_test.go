@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Secrets go only to modules that declare them in module.yaml
+func TestModuleVarsSecrets(t *testing.T) {
+	cli := newTestCLI(t)
+	t.Setenv(passphraseEnv, "pp")
+	modules := cli.manager.ModulesDir
+	metadata := map[string]string{
+		"bare":        "",
+		"declares":    "name: declares\ntype: bash\noptions:\n  token:\n    type: secret\n",
+		"allows":      "name: allows\ntype: bash\nallow_env: [token]\n",
+		"passthrough": "name: passthrough\ntype: bash\npassthrough_env: true\n",
+		"other":       "name: other\ntype: bash\noptions:\n  target:\n    type: string\n",
+	}
+	for name, meta := range metadata {
+		dir := filepath.Join(modules, name)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "main.sh"), []byte("#!/bin/bash\n"), 0755)
+		if meta != "" {
+			os.WriteFile(filepath.Join(dir, "module.yaml"), []byte(meta), 0644)
+		}
+	}
+	cli.RefreshModules()
+	cli.ExecuteCommand("secret token=s3cret")
+	cli.ExecuteCommand("target=10.0.0.1")
+
+	tests := []struct {
+		module string
+		want   bool
+	}{
+		{"bare", false},
+		{"declares", true},
+		{"allows", true},
+		{"passthrough", true},
+		{"other", false},
+	}
+	for _, tt := range tests {
+		vars := cli.moduleVars(tt.module)
+		if _, got := vars["token"]; got != tt.want {
+			t.Errorf("%s gets the secret: %t, want %t", tt.module, got, tt.want)
+		}
+		if vars["target"] != "10.0.0.1" {
+			t.Errorf("%s lost the plain variable: %v", tt.module, vars)
+		}
+	}
+
+	// and only they need the passphrase
+	for _, tt := range tests {
+		if got := len(cli.moduleSecrets(tt.module)) > 0; got != tt.want {
+			t.Errorf("%s needs the secrets: %t, want %t", tt.module, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Workspaces keep engagements apart: each has its own global variables,
+// command history, run records, logs and loot. The default workspace is the
+// layout lanmanvan always had, files directly under ~/.lanmanvan and logs in
+// ./logs. Named ones live in ~/.lanmanvan/workspaces/<name>
+
+const defaultWorkspace = "default"
+
+var workspaceNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Workspace is a workspace and the directory holding its files
+type Workspace struct {
+	Name string
+	Dir  string
+}
+
+// configDir is ~/.lanmanvan
+func configDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan")
+	}
+	return filepath.Join(homeDir, ".lanmanvan")
+}
+
+// workspacesDir is where named workspaces are kept
+func workspacesDir() string {
+	return filepath.Join(configDir(), "workspaces")
+}
+
+// workspaceFor returns the workspace called name, which may not exist yet
+func workspaceFor(name string) Workspace {
+	if name == defaultWorkspace {
+		return Workspace{Name: name, Dir: configDir()}
+	}
+	return Workspace{Name: name, Dir: filepath.Join(workspacesDir(), name)}
+}
+
+func (w Workspace) isDefault() bool {
+	return w.Name == defaultWorkspace
+}
+
+func (w Workspace) envFile() string     { return filepath.Join(w.Dir, "env.json") }
+func (w Workspace) historyFile() string { return filepath.Join(w.Dir, "history") }
+func (w Workspace) runsDir() string     { return filepath.Join(w.Dir, "runs") }
+func (w Workspace) secretsFile() string { return filepath.Join(w.Dir, "secrets.json") }
+
+func (w Workspace) logsDir() string {
+	if w.isDefault() {
+		return "./logs"
+	}
+	return filepath.Join(w.Dir, "logs")
+}
+
+func (w Workspace) lootDir() string {
+	if w.isDefault() {
+		return core.LootDir()
+	}
+	return filepath.Join(w.Dir, "loot")
+}
+
+// exists reports whether the workspace has been created
+func (w Workspace) exists() bool {
+	info, err := os.Stat(w.Dir)
+	return err == nil && info.IsDir()
+}
+
+// checkWorkspaceName rejects names that cannot be a directory of their own
+func checkWorkspaceName(name string) error {
+	if !workspaceNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid workspace name '%s': use letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// listWorkspaces returns the default workspace followed by the named ones,
+// sorted
+func listWorkspaces() ([]Workspace, error) {
+	entries, err := os.ReadDir(workspacesDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && checkWorkspaceName(entry.Name()) == nil && entry.Name() != defaultWorkspace {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	list := []Workspace{workspaceFor(defaultWorkspace)}
+	for _, name := range names {
+		list = append(list, workspaceFor(name))
+	}
+	return list, nil
+}
+
+// UseWorkspace switches the session to a workspace: saved variables, secrets, run
+// records, logs, loot and the history file all come from it from now on.
+// Session variables and macros are kept. With create a missing workspace is
+// created, otherwise it is an error
+func (cli *CLI) UseWorkspace(name string, create bool) error {
+	if err := checkWorkspaceName(name); err != nil {
+		return err
+	}
+	ws := workspaceFor(name)
+	if !ws.isDefault() && !ws.exists() {
+		if !create {
+			return fmt.Errorf("no workspace named '%s', create it with: workspace create %s", name, name)
+		}
+		if err := os.MkdirAll(ws.Dir, 0700); err != nil {
+			return fmt.Errorf("failed to create workspace: %v", err)
+		}
+	}
+
+	if ws.Name != cli.workspace.Name {
+		cli.history = make([]string, 0)
+	}
+	cli.workspace = ws
+	if cli.globalEnv == nil {
+		cli.globalEnv = NewEnvironmentManager(workspaceFor(defaultWorkspace).envFile())
+	}
+	cli.envMgr = cli.globalEnv
+	if !ws.isDefault() {
+		cli.envMgr = NewEnvironmentManager(ws.envFile())
+	}
+	cli.secrets = NewSecretStore(ws.secretsFile())
+	cli.runs = NewRunStore(ws.runsDir())
+	cli.logger = NewLogger(ws.logsDir())
+	cli.manager.LootDir = ws.lootDir()
+	return nil
+}
+
+// WorkspaceCommand handles `workspace [list|create|use|delete] <name>`
+func (cli *CLI) WorkspaceCommand(args []string) {
+	if len(args) == 0 || args[0] == "list" || args[0] == "ls" {
+		cli.listWorkspaces()
+		return
+	}
+	if len(args) != 2 {
+		cli.usageError("Usage: workspace [list | create <name> | use <name> | delete <name>]")
+		return
+	}
+
+	name := args[1]
+	switch args[0] {
+	case "create", "add":
+		if err := checkWorkspaceName(name); err != nil {
+			cli.usageError(err.Error())
+			return
+		}
+		if ws := workspaceFor(name); ws.isDefault() || ws.exists() {
+			cli.lastExit = 1
+			core.PrintError(fmt.Sprintf("Workspace '%s' already exists, switch to it with: workspace use %s", name, name))
+			return
+		}
+		if err := cli.UseWorkspace(name, true); err != nil {
+			cli.lastExit = 1
+			core.PrintError(err.Error())
+			return
+		}
+		core.PrintSuccess(fmt.Sprintf("Created workspace '%s' and switched to it", name))
+
+	case "use", "switch":
+		if err := cli.UseWorkspace(name, false); err != nil {
+			cli.lastExit = 1
+			core.PrintError(err.Error())
+			return
+		}
+		core.PrintSuccess(fmt.Sprintf("Now in workspace '%s'", name))
+
+	case "delete", "rm", "del":
+		cli.deleteWorkspace(name)
+
+	default:
+		cli.usageError(fmt.Sprintf("Unknown workspace command '%s', use list, create, use or delete", args[0]))
+	}
+}
+
+// deleteWorkspace removes a named workspace and everything in it, after
+// asking. The default and the current workspace cannot be deleted
+func (cli *CLI) deleteWorkspace(name string) {
+	ws := workspaceFor(name)
+	switch {
+	case ws.isDefault():
+		cli.lastExit = 1
+		core.PrintError("The default workspace cannot be deleted")
+		return
+	case ws.Name == cli.workspace.Name:
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Workspace '%s' is in use, switch to another one first", name))
+		return
+	case checkWorkspaceName(name) != nil || !ws.exists():
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("No workspace named '%s'", name))
+		return
+	}
+
+	fmt.Println()
+	core.PrintWarning(fmt.Sprintf("About to delete workspace '%s' with its variables, secrets, runs, logs and loot: %s", name, ws.Dir))
+	fmt.Printf("Are you sure? (yes/no): ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(response)) != "yes" {
+		core.PrintInfo("Cancelled")
+		return
+	}
+
+	if err := os.RemoveAll(ws.Dir); err != nil {
+		cli.lastExit = 1
+		core.PrintError(fmt.Sprintf("Failed to delete workspace: %v", err))
+		return
+	}
+	core.PrintSuccess(fmt.Sprintf("Workspace '%s' deleted", name))
+	fmt.Println()
+}
+
+// workspaceJSON is a workspace as printed by `workspace list` with --json
+type workspaceJSON struct {
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Current bool   `json:"current"`
+	Runs    int    `json:"runs"`
+}
+
+func (cli *CLI) listWorkspaces() {
+	list, err := listWorkspaces()
+	if err != nil {
+		cli.lastExit = 1
+		if !cli.jsonError(err) {
+			core.PrintError(fmt.Sprintf("Failed to list workspaces: %v", err))
+		}
+		return
+	}
+
+	rows := make([]workspaceJSON, len(list))
+	for i, ws := range list {
+		ids, _ := NewRunStore(ws.runsDir()).ids()
+		rows[i] = workspaceJSON{Name: ws.Name, Dir: ws.Dir, Current: ws.Name == cli.workspace.Name, Runs: len(ids)}
+	}
+	if cli.jsonOut {
+		cli.printJSON(rows)
+		return
+	}
+
+	table := core.NewTable([]string{"", "Workspace", "Runs", "Directory"})
+	for _, row := range rows {
+		marker := ""
+		if row.Current {
+			marker = "*"
+		}
+		table.AddRow(marker, row.Name, fmt.Sprint(row.Runs), row.Dir)
+	}
+	fmt.Println()
+	fmt.Println(core.NmapBox("WORKSPACES"))
+	fmt.Println(table.Render())
+	fmt.Println()
+}
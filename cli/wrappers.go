@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"lanmanvan/core"
+)
+
+// Wrappers handles the `wrap` command, which manages the session's execution
+// wrappers. They are kept on the CLI, so reloading modules keeps them, and
+// applied to every module run, after any #sudo style prefix and before the
+// module's own wrappers from module.yaml:
+//
+//	wrap                       list
+//	wrap add <wrapper>         e.g. wrap add proxychains, wrap add "nice -n 5"
+//	wrap remove <wrapper>
+//	wrap clear
+func (cli *CLI) Wrappers(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		cli.listWrappers()
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		wrapper := strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+		if wrapper == "" {
+			core.PrintError("Usage: wrap add <wrapper>  (" + strings.Join(core.WrapperNames(), ", ") + " or a custom prefix)")
+			return
+		}
+		if err := core.CheckWrapper(wrapper); err != nil {
+			core.PrintError(err.Error())
+			return
+		}
+		if containsString(cli.sessionWrappers, wrapper) {
+			core.PrintWarning(fmt.Sprintf("Wrapper '%s' is already active", wrapper))
+			return
+		}
+		cli.sessionWrappers = append(cli.sessionWrappers, wrapper)
+		core.PrintSuccess(fmt.Sprintf("Modules now run under: %s", strings.Join(cli.sessionWrappers, " → ")))
+
+	case "remove", "rm", "del":
+		wrapper := strings.Join(strings.Fields(strings.Join(args[1:], " ")), " ")
+		kept := cli.sessionWrappers[:0]
+		found := false
+		for _, w := range cli.sessionWrappers {
+			if w == wrapper {
+				found = true
+				continue
+			}
+			kept = append(kept, w)
+		}
+		cli.sessionWrappers = kept
+		if !found {
+			core.PrintWarning(fmt.Sprintf("Wrapper '%s' is not active", wrapper))
+			return
+		}
+		core.PrintSuccess(fmt.Sprintf("Removed wrapper '%s'", wrapper))
+
+	case "clear":
+		cli.sessionWrappers = nil
+		core.PrintSuccess("Cleared all session wrappers")
+
+	default:
+		core.PrintError("Usage: wrap [list|add <wrapper>|remove <wrapper>|clear]")
+	}
+}
+
+func (cli *CLI) listWrappers() {
+	fmt.Println()
+	if len(cli.sessionWrappers) == 0 {
+		core.PrintInfo("No session wrappers, modules run directly")
+	} else {
+		core.PrintInfo("Modules run under: " + core.Color("yellow", strings.Join(cli.sessionWrappers, " → ")))
+	}
+	fmt.Printf("   Built-in: %s, or any prefix such as \"timeout 30s\"\n", strings.Join(core.WrapperNames(), ", "))
+	fmt.Println()
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Session wrappers survive reloading the modules and reach every run after
+// the #sudo style ones
+func TestSessionWrappers(t *testing.T) {
+	cli := newTestCLI(t)
+
+	cli.Wrappers([]string{"add", "nice", "-n", "5"})
+	cli.Wrappers([]string{"add", "nice", "-n", "5"}) // already active
+	cli.RefreshModules()
+	cli.reloadModules()
+	if want := []string{"nice -n 5"}; !reflect.DeepEqual(cli.sessionWrappers, want) {
+		t.Fatalf("session wrappers = %q, want %q", cli.sessionWrappers, want)
+	}
+
+	cli.wrappers = []string{"sudo"}
+	if got, want := cli.runOptions().Wrappers, []string{"sudo", "nice -n 5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("run wrappers = %q, want %q", got, want)
+	}
+
+	cli.Wrappers([]string{"remove", "nice", "-n", "5"})
+	if len(cli.sessionWrappers) != 0 {
+		t.Errorf("session wrappers = %q after remove", cli.sessionWrappers)
+	}
+}
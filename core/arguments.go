@@ -0,0 +1,138 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A module only receives the arguments it declares in module.yaml: its
+// options, its required names and its allow_env list, plus the few the
+// framework passes to every module. Variables set for the whole session no
+// longer reach modules that never asked for them. Modules without metadata,
+// and legacy ones with passthrough_env: true, still get everything
+
+// AllowedArguments reach every module, declared or not: the output of the
+// previous pipe stage
+var AllowedArguments = []string{"input"}
+
+// positionalRegex matches the names given to positional arguments
+var positionalRegex = regexp.MustCompile(`^arg[0-9]+$`)
+
+// Accepts reports whether the module takes an argument called name
+func (meta *ModuleMetadata) Accepts(name string) bool {
+	if meta == nil || meta.Passthrough {
+		return true
+	}
+	if _, ok := meta.Options[name]; ok {
+		return true
+	}
+	return containsString(meta.Required, name) ||
+		containsString(meta.AllowEnv, name) ||
+		containsString(AllowedArguments, name) ||
+		positionalRegex.MatchString(name)
+}
+
+// Declares reports whether module.yaml names the argument: as an option,
+// a required name or in allow_env, or passes everything with
+// passthrough_env. Unlike Accepts it is false without metadata; secrets
+// only go to modules that declare them
+func (meta *ModuleMetadata) Declares(name string) bool {
+	if meta == nil {
+		return false
+	}
+	if _, ok := meta.Options[name]; ok {
+		return true
+	}
+	return meta.Passthrough || containsString(meta.Required, name) || containsString(meta.AllowEnv, name)
+}
+
+// DeclaredArguments returns the arguments the module accepts, the others
+// left out
+func DeclaredArguments(meta *ModuleMetadata, args map[string]string) map[string]string {
+	kept := make(map[string]string, len(args))
+	for key, value := range args {
+		if meta.Accepts(key) {
+			kept[key] = value
+		}
+	}
+	return kept
+}
+
+// UnknownArguments lists, sorted, the names in args the module does not
+// accept
+func UnknownArguments(meta *ModuleMetadata, args map[string]string) []string {
+	var unknown []string
+	for key := range args {
+		if !meta.Accepts(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Suggest returns the declared name closest to a mistyped one, "" when
+// none is close enough to be what was meant
+func (meta *ModuleMetadata) Suggest(name string) string {
+	if meta == nil {
+		return ""
+	}
+	candidates := append([]string{}, meta.Required...)
+	candidates = append(candidates, meta.AllowEnv...)
+	candidates = append(candidates, AllowedArguments...)
+	for option := range meta.Options {
+		candidates = append(candidates, option)
+	}
+	sort.Strings(candidates)
+
+	// Up to a third of the name may be wrong, and always one typo
+	maxDistance := len(name) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b, with two
+// swapped neighbours counted as one edit
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,34 @@
+package core
+
+import "testing"
+
+func TestAcceptsAndDeclares(t *testing.T) {
+	meta := &ModuleMetadata{
+		Options:  map[string]OptionMeta{"token": {Type: "secret"}},
+		Required: []string{"target"},
+		AllowEnv: []string{"proxy"},
+	}
+	tests := []struct {
+		meta     *ModuleMetadata
+		name     string
+		accepts  bool
+		declares bool
+	}{
+		{meta, "token", true, true},
+		{meta, "target", true, true},
+		{meta, "proxy", true, true},
+		{meta, "input", true, false},
+		{meta, "arg1", true, false},
+		{meta, "other", false, false},
+		{nil, "token", true, false},
+		{&ModuleMetadata{Passthrough: true}, "token", true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.meta.Accepts(tt.name); got != tt.accepts {
+			t.Errorf("Accepts(%q) = %t, want %t (meta %+v)", tt.name, got, tt.accepts, tt.meta)
+		}
+		if got := tt.meta.Declares(tt.name); got != tt.declares {
+			t.Errorf("Declares(%q) = %t, want %t (meta %+v)", tt.name, got, tt.declares, tt.meta)
+		}
+	}
+}
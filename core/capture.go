@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// DefaultCaptureLimit caps how many bytes of each stream are kept in an ExecutionResult
+const DefaultCaptureLimit = 1 << 20 // 1 MiB
+
+// ExecOptions controls where a module's standard streams go
+type ExecOptions struct {
+	Stdout       io.Writer // live copy of stdout, nil to capture only
+	Stderr       io.Writer // live copy of stderr, nil to capture only
+	Stdin        io.Reader // nil means no input
+	CaptureLimit int       // per stream, 0 means DefaultCaptureLimit
+	Wrappers     []string  // execution wrappers for this run and session, outermost first
+
+	// Foreground marks a run the user waits for at the terminal. The
+	// terminal stays with lmv, which forwards Ctrl+C to the module's
+	// process group and escalates on further presses; a sudo wrapper
+	// asks for its password on the terminal before the module starts
+	Foreground bool
+
+	// Context, if set, stops the module's process group when cancelled
+	Context context.Context
+	// Timeout bounds this run, overriding the module's own timeout.
+	// A negative value runs without any timeout
+	Timeout time.Duration
+	// DefaultTimeout applies when neither Timeout nor the module sets one
+	DefaultTimeout time.Duration
+
+	// Env holds extra KEY=VALUE entries for the module's environment
+	Env []string
+
+	// Redact lists values, such as passwords, masked out of the module's
+	// output and events, live and captured alike
+	Redact []string
+
+	// OnEvent, if set, receives each structured event as the module emits
+	// it, e.g. to draw progress. Events are also collected in the result
+	OnEvent func(Event)
+
+	// OnStart, if set, is called with the running process, e.g. so it can
+	// be interrupted. It must not block
+	OnStart func(*Process)
+}
+
+// TerminalOptions streams to the terminal, like a normal run. Stdin is
+// passed on only when it is not the terminal: modules run in their own
+// process group and would be stopped by SIGTTIN when reading from it
+func TerminalOptions() ExecOptions {
+	opts := ExecOptions{
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		Foreground: isTerminal(os.Stdin),
+	}
+	if !opts.Foreground {
+		opts.Stdin = os.Stdin
+	}
+	return opts
+}
+
+// isTerminal reports whether f is a terminal. /dev/null and other
+// character devices are not
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd())
+}
+
+// cappedBuffer records writes up to a limit and silently drops the rest,
+// so a chatty module can never exhaust memory
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	if limit <= 0 {
+		limit = DefaultCaptureLimit
+	}
+	return &cappedBuffer{limit: limit}
+}
+
+// Write always reports success so the tee keeps streaming after the cap
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	room := b.limit - b.buf.Len()
+	if room <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *cappedBuffer) Truncated() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.truncated
+}
+
+// teeWriter returns a writer feeding both the live destination (if any) and the capture buffer
+func teeWriter(live io.Writer, capture *cappedBuffer) io.Writer {
+	if live == nil {
+		return capture
+	}
+	return io.MultiWriter(live, capture)
+}
@@ -0,0 +1,312 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Modules can report structured events next to their normal output, one
+// JSON object per line, either on the file descriptor named by
+// LMV_EVENTS_FD or on stdout behind the LMV_EVENTS_PREFIX marker:
+//
+//	@@lmv {"type":"finding","host":"10.0.0.5","port":22,"service":"ssh"}
+//	@@lmv {"type":"progress","pct":40,"msg":"scanning 10.0.0.0/24"}
+//	@@lmv {"type":"log","level":"warn","msg":"host is filtering probes"}
+//	@@lmv {"type":"artifact","path":"/home/me/.lanmanvan/loot/scan/x/hosts.txt"}
+//
+// Event lines never show up in the module's captured output
+const EventPrefix = "@@lmv "
+
+// Event types understood by the CLI; other types are kept as they are
+const (
+	EventFinding  = "finding"
+	EventProgress = "progress"
+	EventLog      = "log"
+	EventArtifact = "artifact"
+)
+
+// Event is one structured record emitted by a module
+type Event struct {
+	Type    string                 `json:"type"`
+	Level   string                 `json:"level,omitempty"` // log: debug, info, warn or error
+	Message string                 `json:"msg,omitempty"`   // log and progress
+	Percent float64                `json:"pct,omitempty"`   // progress, 0 to 100
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Keys    []string               `json:"keys,omitempty"` // Fields in the order the module wrote them
+}
+
+// Field returns a field as text, "" if it is missing
+func (e Event) Field(name string) string {
+	v, ok := e.Fields[name]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// JSON renders the event's fields as one flat object, in the module's
+// field order, which is the form passed down a pipe
+func (e Event) JSON() string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range e.Keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(e.Fields[key])
+		if err != nil {
+			v = []byte("null")
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// ParseEvent reads one JSON object into an Event. Objects without a
+// string "type" are not events. A missing type is taken as a finding when
+// defaultType is EventFinding, which is how piped input is read back
+func ParseEvent(line []byte, defaultType string) (Event, bool) {
+	fields, keys, ok := decodeObject(line)
+	if !ok {
+		return Event{}, false
+	}
+
+	ev := Event{Fields: fields, Keys: keys, Type: defaultType}
+	if t, ok := fields["type"].(string); ok {
+		ev.Type = t
+	} else if _, present := fields["type"]; present || defaultType == "" {
+		return Event{}, false
+	}
+
+	ev.Message = firstString(fields, "msg", "message")
+	switch ev.Type {
+	case EventLog:
+		ev.Level = firstString(fields, "level")
+		if ev.Level == "" {
+			ev.Level = "info"
+		}
+	case EventProgress:
+		if pct, ok := fields["pct"].(float64); ok {
+			ev.Percent = pct
+		} else if cur, ok := fields["current"].(float64); ok {
+			if total, ok := fields["total"].(float64); ok && total > 0 {
+				ev.Percent = cur * 100 / total
+			}
+		}
+	case EventFinding:
+		// The type is implied once the event is known to be a finding
+		delete(ev.Fields, "type")
+		ev.Keys = removeKey(ev.Keys, "type")
+	}
+	return ev, true
+}
+
+// decodeObject decodes a JSON object keeping the order of its keys
+func decodeObject(data []byte) (map[string]interface{}, []string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, nil, false
+	}
+
+	fields := make(map[string]interface{})
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, false
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, nil, false
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, false
+		}
+		if _, seen := fields[key]; !seen {
+			keys = append(keys, key)
+		}
+		fields[key] = value
+	}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('}') {
+		return nil, nil, false
+	}
+	// Nothing may follow the object on the line
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, false
+	}
+	return fields, keys, true
+}
+
+func firstString(fields map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if s, ok := fields[name].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func removeKey(keys []string, key string) []string {
+	out := keys[:0]
+	for _, k := range keys {
+		if k != key {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// Findings returns the finding events of a run
+func Findings(events []Event) []Event {
+	var findings []Event
+	for _, ev := range events {
+		if ev.Type == EventFinding {
+			findings = append(findings, ev)
+		}
+	}
+	return findings
+}
+
+// Artifacts returns the paths of the files a run saved
+func Artifacts(events []Event) []string {
+	var paths []string
+	for _, ev := range events {
+		if ev.Type == EventArtifact {
+			if path := ev.Field("path"); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// eventCollector gathers events from stdout and the events fd, which are
+// read concurrently, and hands each one to ExecOptions.OnEvent
+type eventCollector struct {
+	mu       sync.Mutex
+	events   []Event
+	onEvent  func(Event)
+	redactor *Redactor // masks secrets in events from the event pipe
+}
+
+func (c *eventCollector) add(ev Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ev = c.redactor.Event(ev)
+	c.events = append(c.events, ev)
+	if c.onEvent != nil {
+		c.onEvent(ev)
+	}
+}
+
+func (c *eventCollector) all() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.events...)
+}
+
+// readEvents collects one event per line from r until EOF. Lines that are
+// not events are dropped
+func (c *eventCollector) readEvents(r io.Reader) {
+	data := make([]byte, 0, 4096)
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		data = append(data, buf[:n]...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if ev, ok := ParseEvent(bytes.TrimSpace(data[:i]), ""); ok {
+				c.add(ev)
+			}
+			data = data[i+1:]
+		}
+		if err != nil {
+			if ev, ok := ParseEvent(bytes.TrimSpace(data), ""); ok {
+				c.add(ev)
+			}
+			return
+		}
+	}
+}
+
+// eventFilter sits on a module's stdout and takes out lines starting with
+// EventPrefix. Everything else is passed through as soon as it is clear
+// it cannot be an event line, so prompts without a newline still show
+type eventFilter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	events  *eventCollector
+	pending []byte
+	midLine bool // the start of the pending line was already passed through
+}
+
+func (f *eventFilter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pending = append(f.pending, p...)
+	for {
+		i := bytes.IndexByte(f.pending, '\n')
+		if i < 0 {
+			break
+		}
+		f.line(f.pending[:i+1])
+		f.pending = f.pending[i+1:]
+		f.midLine = false
+	}
+
+	if len(f.pending) > 0 && (f.midLine || !couldBeEvent(f.pending)) {
+		f.out.Write(f.pending)
+		f.pending = nil
+		f.midLine = true
+	}
+	if len(f.pending) == 0 {
+		f.pending = nil
+	}
+	return len(p), nil
+}
+
+// Flush handles a last line without a trailing newline
+func (f *eventFilter) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) > 0 {
+		f.line(f.pending)
+		f.pending = nil
+	}
+}
+
+func (f *eventFilter) line(line []byte) {
+	if !f.midLine && bytes.HasPrefix(line, []byte(EventPrefix)) {
+		if ev, ok := ParseEvent(bytes.TrimSpace(line[len(EventPrefix):]), ""); ok {
+			f.events.add(ev)
+			return
+		}
+	}
+	f.out.Write(line)
+}
+
+// couldBeEvent reports whether a partial line may still turn out to be an
+// event line
+func couldBeEvent(partial []byte) bool {
+	prefix := []byte(EventPrefix)
+	return bytes.HasPrefix(partial, prefix) || bytes.HasPrefix(prefix, partial)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goBuildCacheDir returns the directory holding compiled Go module binaries
+func goBuildCacheDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "cache", "go")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "cache", "go")
+}
+
+// goSourceFiles lists the files that influence a Go module build, sorted
+func goSourceFiles(moduleDir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(moduleDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != moduleDir && (strings.HasPrefix(info.Name(), ".") || info.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := info.Name()
+		if strings.HasSuffix(name, ".go") || name == "go.mod" || name == "go.sum" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// hashGoSources computes a hash over the module's Go sources and the
+// package being built
+func hashGoSources(moduleDir string, pkg string, files []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", pkg)
+	for _, path := range files {
+		rel, _ := filepath.Rel(moduleDir, path)
+		fmt.Fprintf(h, "%s\x00", rel)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// goPackageDir returns the directory of the package to build: the
+// entrypoint's own, or the entrypoint when it is a directory. It has to be
+// inside the module
+func goPackageDir(module *ModuleConfig, entrypoint string) (string, string, error) {
+	dir := entrypoint
+	if info, err := os.Stat(entrypoint); err != nil || !info.IsDir() {
+		dir = filepath.Dir(entrypoint)
+	}
+	rel, err := filepath.Rel(module.Path, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("entrypoint '%s' is outside the module", entrypoint)
+	}
+	return dir, filepath.ToSlash(rel), nil
+}
+
+// goModuleBinary returns the compiled binary for a Go module, built from
+// the package of its entrypoint, rebuilding it only when the sources have
+// changed since the last build
+func goModuleBinary(module *ModuleConfig, entrypoint string) (string, error) {
+	pkgDir, pkg, err := goPackageDir(module, entrypoint)
+	if err != nil {
+		return "", err
+	}
+	files, err := goSourceFiles(module.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan Go sources: %w", err)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no Go sources found in module")
+	}
+
+	hash, err := hashGoSources(module.Path, pkg, files)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash Go sources: %w", err)
+	}
+
+	cacheDir := goBuildCacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create build cache: %w", err)
+	}
+
+	binPath := filepath.Join(cacheDir, fmt.Sprintf("%s-%s", module.Name, hash[:16]))
+	if _, err := os.Stat(binPath); err == nil {
+		return binPath, nil
+	}
+
+	PrintInfo(fmt.Sprintf("Compiling Go module '%s'...", module.Name))
+
+	// Build into a temporary file of our own first, so an interrupted
+	// build never leaves a half-written binary in the cache and builds
+	// running at the same time do not write over each other
+	tmp, err := os.CreateTemp(cacheDir, "."+module.Name+"-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build output: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+
+	var cmd *exec.Cmd
+	if _, err := os.Stat(filepath.Join(module.Path, "go.mod")); err == nil {
+		cmd = exec.Command("go", "build", "-o", tmpPath, "./"+pkg)
+		cmd.Dir = module.Path
+	} else {
+		buildArgs := []string{"build", "-o", tmpPath}
+		entries, _ := os.ReadDir(pkgDir)
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+				buildArgs = append(buildArgs, name)
+			}
+		}
+		cmd = exec.Command("go", buildArgs...)
+		// -mod flags only make sense inside a Go module
+		cmd.Env = append(os.Environ(), "GOFLAGS=")
+		cmd.Dir = pkgDir
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("go build failed: %v\n%s", err, strings.TrimSpace(string(output)))
+	}
+
+	if err := os.Rename(tmpPath, binPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to store binary in cache: %w", err)
+	}
+
+	// Drop stale builds of the same module (name + "-" + 16 hex chars)
+	stale, _ := filepath.Glob(filepath.Join(cacheDir, module.Name+"-*"))
+	for _, old := range stale {
+		if old != binPath && len(filepath.Base(old)) == len(filepath.Base(binPath)) {
+			os.Remove(old)
+		}
+	}
+
+	return binPath, nil
+}
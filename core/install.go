@@ -0,0 +1,373 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Modules installed with `module install` are recorded in the lockfile,
+// modules.lock in the modules directory: where each came from, the commit
+// and version installed, and a hash of its files. The hash tells a module
+// changed by hand from one that is as installed, and only those are
+// replaced or removed without --force
+
+// LockFile is the name of the lockfile in the modules directory
+const LockFile = "modules.lock"
+
+// Module states, as `module list` shows them
+const (
+	ModuleInstalled = "installed" // as installed
+	ModuleModified  = "modified"  // changed since it was installed
+	ModuleLocal     = "local"     // not installed by `module install`
+	ModuleMissing   = "missing"   // in the lockfile, its directory gone
+)
+
+var (
+	// ErrModified is returned for a module changed since it was installed
+	ErrModified = errors.New("changed since it was installed")
+	// ErrNotManaged is returned for a module `module install` did not install
+	ErrNotManaged = errors.New("not installed by 'module install'")
+)
+
+// LockEntry is an installed module in the lockfile
+type LockEntry struct {
+	Source
+	Path      string    `json:"path,omitempty"`   // the module's directory within the source
+	Commit    string    `json:"commit,omitempty"` // for git sources
+	Version   string    `json:"version,omitempty"`
+	Checksum  string    `json:"checksum"` // HashModule of the installed files
+	Installed time.Time `json:"installed"`
+}
+
+// Lock is the lockfile
+type Lock struct {
+	Modules map[string]*LockEntry `json:"modules"`
+
+	path string
+}
+
+// LoadLock reads the lockfile of the modules directory, empty when there
+// is none yet
+func (mm *ModuleManager) LoadLock() (*Lock, error) {
+	lock := &Lock{Modules: make(map[string]*LockEntry), path: filepath.Join(mm.ModulesDir, LockFile)}
+	data, err := os.ReadFile(lock.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", LockFile, err)
+	}
+	if lock.Modules == nil {
+		lock.Modules = make(map[string]*LockEntry)
+	}
+	return lock, nil
+}
+
+// Save writes the lockfile
+func (l *Lock) Save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, append(data, '\n'), 0644)
+}
+
+// ModuleState tells whether a module is as installed, see the Module*
+// states
+func (mm *ModuleManager) ModuleState(lock *Lock, name string) string {
+	dir := filepath.Join(mm.ModulesDir, name)
+	entry := lock.Modules[name]
+	if _, err := os.Stat(dir); err != nil {
+		if entry != nil {
+			return ModuleMissing
+		}
+		return ""
+	}
+	if entry == nil {
+		return ModuleLocal
+	}
+	if hash, err := HashModule(dir); err != nil || hash != entry.Checksum {
+		return ModuleModified
+	}
+	return ModuleInstalled
+}
+
+// checkOverwrite refuses to replace or remove a module that is not as
+// installed, unless forced. action is what would be done to it
+func (mm *ModuleManager) checkOverwrite(lock *Lock, name string, force bool, action string) error {
+	if force {
+		return nil
+	}
+	switch mm.ModuleState(lock, name) {
+	case ModuleModified:
+		return fmt.Errorf("%w, use --force to %s it", ErrModified, action)
+	case ModuleLocal:
+		return fmt.Errorf("%w, use --force to %s it", ErrNotManaged, action)
+	}
+	return nil
+}
+
+// InstallResult is what became of one module
+type InstallResult struct {
+	Module     string `json:"module"`
+	Status     string `json:"status"` // installed, updated, unchanged or failed
+	Version    string `json:"version,omitempty"`
+	OldVersion string `json:"old_version,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Failed reports whether the module could not be installed
+func (r InstallResult) Failed() bool {
+	return r.Error != ""
+}
+
+// Install installs the modules of a source, or only the named ones. A
+// module already there is replaced only if it is as installed, or with
+// force
+func (mm *ModuleManager) Install(src Source, only []string, force bool) ([]InstallResult, error) {
+	lock, err := mm.LoadLock()
+	if err != nil {
+		return nil, err
+	}
+	fetched, err := fetchSource(src)
+	if err != nil {
+		return nil, err
+	}
+	defer fetched.Close()
+
+	found, err := findModules(fetched.Dir, src)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no module.yaml found in %s", src)
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	if len(only) > 0 {
+		for _, name := range only {
+			if _, ok := found[name]; !ok {
+				return nil, fmt.Errorf("no module named '%s' in %s", name, src)
+			}
+		}
+		names = only
+	}
+	sort.Strings(names)
+
+	var results []InstallResult
+	for _, name := range names {
+		results = append(results, mm.installModule(lock, name, found[name], fetched, src, force))
+	}
+	return results, lock.Save()
+}
+
+// Update reinstalls installed modules, all of them or the named ones, from
+// where they came from. Each source is fetched once
+func (mm *ModuleManager) Update(names []string, force bool) ([]InstallResult, error) {
+	lock, err := mm.LoadLock()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		for name := range lock.Modules {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bySource := make(map[Source][]string)
+	var sources []Source
+	var results []InstallResult
+	for _, name := range names {
+		entry, ok := lock.Modules[name]
+		if !ok {
+			results = append(results, InstallResult{Module: name, Status: "failed", Error: "not installed by 'module install'"})
+			continue
+		}
+		if _, seen := bySource[entry.Source]; !seen {
+			sources = append(sources, entry.Source)
+		}
+		bySource[entry.Source] = append(bySource[entry.Source], name)
+	}
+
+	for _, src := range sources {
+		results = append(results, mm.updateFrom(lock, src, bySource[src], force)...)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Module < results[j].Module })
+	return results, lock.Save()
+}
+
+func (mm *ModuleManager) updateFrom(lock *Lock, src Source, names []string, force bool) []InstallResult {
+	var results []InstallResult
+	fail := func(err error) []InstallResult {
+		for _, name := range names {
+			results = append(results, InstallResult{Module: name, Status: "failed", Error: err.Error()})
+		}
+		return results
+	}
+
+	fetched, err := fetchSource(src)
+	if err != nil {
+		return fail(err)
+	}
+	defer fetched.Close()
+	found, err := findModules(fetched.Dir, src)
+	if err != nil {
+		return fail(err)
+	}
+
+	for _, name := range names {
+		dir, ok := found[name]
+		if !ok {
+			results = append(results, InstallResult{Module: name, Status: "failed", Error: fmt.Sprintf("no longer in %s", src)})
+			continue
+		}
+		results = append(results, mm.installModule(lock, name, dir, fetched, src, force))
+	}
+	return results
+}
+
+// installModule copies one module of a fetched source into the modules
+// directory and records it in the lockfile
+func (mm *ModuleManager) installModule(lock *Lock, name, dir string, fetched *fetchedSource, src Source, force bool) InstallResult {
+	result := InstallResult{Module: name, Commit: fetched.Commit}
+	if meta, err := loadMetadata(filepath.Join(dir, "module.yaml")); err == nil {
+		result.Version = meta.Version
+	}
+	failed := func(err error) InstallResult {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+
+	if !isModuleName(name) {
+		return failed(fmt.Errorf("invalid module name"))
+	}
+	hash, err := HashModule(dir)
+	if err != nil {
+		return failed(err)
+	}
+
+	dest := filepath.Join(mm.ModulesDir, name)
+	old := lock.Modules[name]
+	_, statErr := os.Stat(dest)
+	exists := statErr == nil
+	if exists {
+		if err := mm.checkOverwrite(lock, name, force, "overwrite"); err != nil {
+			return failed(err)
+		}
+	}
+
+	result.Status = "installed"
+	if old != nil && exists {
+		result.Status, result.OldVersion = "updated", old.Version
+		if current, err := HashModule(dest); err == nil && current == hash {
+			result.Status = "unchanged"
+		}
+	}
+
+	if result.Status != "unchanged" {
+		if err := replaceDir(dir, dest); err != nil {
+			return failed(err)
+		}
+	}
+
+	rel, _ := filepath.Rel(fetched.Dir, dir)
+	if rel == "." {
+		rel = ""
+	}
+	lock.Modules[name] = &LockEntry{
+		Source:    src,
+		Path:      filepath.ToSlash(rel),
+		Commit:    fetched.Commit,
+		Version:   result.Version,
+		Checksum:  hash,
+		Installed: time.Now(),
+	}
+	return result
+}
+
+// Remove deletes an installed module. One that is not as installed is
+// only removed with force
+func (mm *ModuleManager) Remove(name string, force bool) error {
+	if !isModuleName(name) {
+		return fmt.Errorf("invalid module name '%s'", name)
+	}
+	lock, err := mm.LoadLock()
+	if err != nil {
+		return err
+	}
+	if mm.ModuleState(lock, name) == "" {
+		return fmt.Errorf("no module named '%s'", name)
+	}
+	if err := mm.checkOverwrite(lock, name, force, "remove"); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(mm.ModulesDir, name)); err != nil {
+		return err
+	}
+	delete(lock.Modules, name)
+	delete(mm.Modules, name)
+	return lock.Save()
+}
+
+// replaceDir puts a copy of src in place of dest. The copy is made next to
+// dest first, so a failure leaves dest as it was
+func replaceDir(src, dest string) error {
+	staging := filepath.Join(filepath.Dir(dest), "."+filepath.Base(dest)+".new")
+	os.RemoveAll(staging)
+	if err := copyTree(src, staging); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	if err := os.RemoveAll(dest); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	return os.Rename(staging, dest)
+}
+
+// copyTree copies a directory, leaving out hidden directories such as .git
+func copyTree(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			if path != src && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return writeFile(target, f, info.Mode().Perm())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeModule creates a bash module in dir/name
+func writeModule(t *testing.T, dir, name, version, script string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	meta := "name: " + name + "\ntype: bash\nversion: " + version + "\n"
+	if err := os.WriteFile(filepath.Join(path, "module.yaml"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "main.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstallLifecycle(t *testing.T) {
+	modulesDir := t.TempDir()
+	sourceDir := t.TempDir()
+	writeModule(t, sourceDir, "scan", "1.0", "echo scan\n")
+	writeModule(t, sourceDir, "grab", "1.0", "echo grab\n")
+	mm := NewModuleManager(modulesDir)
+	src, err := mm.ResolveSource(sourceDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name   string
+		run    func() ([]InstallResult, error)
+		want   map[string]string // module -> status
+		states map[string]string // module -> ModuleState after the step
+	}{
+		{
+			name:   "install one",
+			run:    func() ([]InstallResult, error) { return mm.Install(src, []string{"scan"}, false) },
+			want:   map[string]string{"scan": "installed"},
+			states: map[string]string{"scan": ModuleInstalled, "grab": ""},
+		},
+		{
+			name:   "install all",
+			run:    func() ([]InstallResult, error) { return mm.Install(src, nil, false) },
+			want:   map[string]string{"scan": "unchanged", "grab": "installed"},
+			states: map[string]string{"scan": ModuleInstalled, "grab": ModuleInstalled},
+		},
+		{
+			name: "update a new version",
+			run: func() ([]InstallResult, error) {
+				writeModule(t, sourceDir, "scan", "1.1", "echo scan v2\n")
+				return mm.Update(nil, false)
+			},
+			want:   map[string]string{"scan": "updated", "grab": "unchanged"},
+			states: map[string]string{"scan": ModuleInstalled, "grab": ModuleInstalled},
+		},
+		{
+			name: "changed by hand is kept",
+			run: func() ([]InstallResult, error) {
+				os.WriteFile(filepath.Join(modulesDir, "grab", "main.sh"), []byte("echo mine\n"), 0755)
+				return mm.Update([]string{"grab"}, false)
+			},
+			want:   map[string]string{"grab": "failed"},
+			states: map[string]string{"grab": ModuleModified},
+		},
+		{
+			name:   "forced",
+			run:    func() ([]InstallResult, error) { return mm.Update([]string{"grab"}, true) },
+			want:   map[string]string{"grab": "updated"},
+			states: map[string]string{"grab": ModuleInstalled},
+		},
+	}
+	for _, step := range steps {
+		results, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		got := make(map[string]string)
+		for _, r := range results {
+			got[r.Module] = r.Status
+		}
+		for module, status := range step.want {
+			if got[module] != status {
+				t.Errorf("%s: %s status = %q, want %q (results %+v)", step.name, module, got[module], status, results)
+			}
+		}
+		lock, err := mm.LoadLock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for module, state := range step.states {
+			if got := mm.ModuleState(lock, module); got != state {
+				t.Errorf("%s: %s state = %q, want %q", step.name, module, got, state)
+			}
+		}
+	}
+
+	lock, _ := mm.LoadLock()
+	entry := lock.Modules["scan"]
+	if entry == nil || entry.Version != "1.1" || entry.Source != src || entry.Checksum == "" {
+		t.Errorf("lockfile entry for scan = %+v", entry)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	modulesDir := t.TempDir()
+	sourceDir := t.TempDir()
+	writeModule(t, sourceDir, "scan", "1.0", "echo scan\n")
+	writeModule(t, modulesDir, "mine", "1.0", "echo mine\n")
+	mm := NewModuleManager(modulesDir)
+	src, _ := mm.ResolveSource(sourceDir, "")
+	if _, err := mm.Install(src, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		module  string
+		force   bool
+		wantErr error
+	}{
+		{"mine", false, ErrNotManaged},
+		{"nothing", false, nil}, // any error
+		{"../x", false, nil},
+		{"scan", false, nil},
+		{"mine", true, nil},
+	}
+	for _, tt := range tests {
+		err := mm.Remove(tt.module, tt.force)
+		switch {
+		case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+			t.Errorf("Remove(%q) = %v, want %v", tt.module, err, tt.wantErr)
+		case tt.module == "nothing" || tt.module == "../x":
+			if err == nil {
+				t.Errorf("Remove(%q) succeeded", tt.module)
+			}
+		case tt.wantErr == nil && err != nil:
+			t.Errorf("Remove(%q) = %v", tt.module, err)
+		}
+	}
+
+	lock, _ := mm.LoadLock()
+	if len(lock.Modules) != 0 {
+		t.Errorf("lockfile still lists %v", lock.Modules)
+	}
+	for _, name := range []string{"scan", "mine"} {
+		if _, err := os.Stat(filepath.Join(modulesDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+}
+
+func TestHashModule(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "scan", "1.0", "echo scan\n")
+	path := filepath.Join(dir, "scan")
+	base, err := HashModule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func()
+		changed bool
+	}{
+		{"bytecode", func() {
+			os.MkdirAll(filepath.Join(path, "__pycache__"), 0755)
+			os.WriteFile(filepath.Join(path, "__pycache__", "x.pyc"), []byte("x"), 0644)
+		}, false},
+		{"hidden directory", func() {
+			os.MkdirAll(filepath.Join(path, ".git"), 0755)
+			os.WriteFile(filepath.Join(path, ".git", "HEAD"), []byte("x"), 0644)
+		}, false},
+		{"executable bit", func() { os.Chmod(filepath.Join(path, "main.sh"), 0644) }, true},
+		{"contents", func() { os.WriteFile(filepath.Join(path, "main.sh"), []byte("echo other\n"), 0755) }, true},
+	}
+	for _, tt := range tests {
+		tt.change()
+		hash, err := HashModule(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed := hash != base; changed != tt.changed {
+			t.Errorf("%s: hash changed = %t, want %t", tt.name, changed, tt.changed)
+		}
+		base = hash
+	}
+}
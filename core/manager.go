@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -15,6 +16,9 @@ import (
 type ModuleManager struct {
 	ModulesDir string
 	Modules    map[string]*ModuleConfig
+	LootDir    string // where module artifacts go, LootDir() when empty
+
+	sdkWarning sync.Once
 }
 
 // NewModuleManager creates a new module manager
@@ -37,7 +41,8 @@ func (mm *ModuleManager) DiscoverModules() error {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// Hidden directories are not modules, nor is one being installed
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			moduleDir := filepath.Join(mm.ModulesDir, entry.Name())
 			mm.loadModuleFromDir(moduleDir)
 		}
@@ -66,6 +71,9 @@ func (mm *ModuleManager) loadModuleFromDir(moduleDir string) {
 		}
 		moduleConfig.Metadata = metadata
 		moduleConfig.Type = metadata.Type
+		if moduleConfig.Type == "" {
+			moduleConfig.Type = mm.inferModuleType(moduleDir)
+		}
 	} else {
 		// Try to infer type from available files
 		moduleConfig.Type = mm.inferModuleType(moduleDir)
@@ -75,19 +83,27 @@ func (mm *ModuleManager) loadModuleFromDir(moduleDir string) {
 	mm.Modules[moduleName] = moduleConfig
 }
 
-// inferModuleType determines module type based on file extensions
+// inferModuleType determines module type by asking each registered runtime,
+// falling back to any file with a known script extension
 func (mm *ModuleManager) inferModuleType(moduleDir string) string {
+	for _, rt := range Runtimes() {
+		if rt.Detect(moduleDir) {
+			return rt.Name()
+		}
+	}
+
 	entries, _ := os.ReadDir(moduleDir)
 	for _, entry := range entries {
-		name := entry.Name()
-		if strings.HasSuffix(name, ".py") {
-			return "python"
-		}
-		if strings.HasSuffix(name, ".sh") {
-			return "bash"
-		}
-		if strings.HasSuffix(name, ".go") {
-			return "go"
+		for _, rt := range Runtimes() {
+			ir, ok := rt.(*InterpreterRuntime)
+			if !ok {
+				continue
+			}
+			for _, ext := range ir.Extensions {
+				if strings.HasSuffix(entry.Name(), ext) {
+					return ir.Name()
+				}
+			}
 		}
 	}
 	return "unknown"
@@ -105,109 +121,186 @@ func (mm *ModuleManager) GetModule(name string) (*ModuleConfig, error) {
 	return module, nil
 }
 
-// ExecuteModule runs a module with given arguments
+// ExecuteModule runs a module with given arguments, streaming to the terminal
 func (mm *ModuleManager) ExecuteModule(moduleName string, args map[string]string) (*ExecutionResult, error) {
+	return mm.ExecuteModuleWith(moduleName, args, TerminalOptions())
+}
+
+// ExecuteModuleWith runs a module with explicit stream options. Output is
+// always captured into the result, whether or not it is also streamed
+func (mm *ModuleManager) ExecuteModuleWith(moduleName string, args map[string]string, opts ExecOptions) (*ExecutionResult, error) {
 	module, err := mm.GetModule(moduleName)
 	if err != nil {
 		return nil, err
 	}
 
-	switch module.Type {
-	case "python":
-		return executePythonModule(module, args)
-	case "bash":
-		return executeBashModule(module, args)
-	case "go":
-		return executeGoModule(module, args)
-	default:
-		return nil, fmt.Errorf("unsupported module type: %s, supported types are: python, bash", module.Type)
+	rt, err := mm.runtimeFor(module)
+	if err != nil {
+		return nil, err
 	}
+
+	// Only what the module declares becomes its ARG_* environment
+	args = DeclaredArguments(module.Metadata, args)
+
+	// The SDK environment comes first so callers can override any of it
+	opts.Env = append(mm.sdkEnvironment(module), opts.Env...)
+
+	// Values of secret options are masked like the caller's own secrets
+	if module.Metadata != nil {
+		for name, opt := range module.Metadata.Options {
+			if value := args[name]; opt.IsSecret() && value != "" {
+				opts.Redact = append(opts.Redact, value)
+			}
+		}
+	}
+
+	return executeWithRuntime(module, rt, args, mm.moduleWrappers(module, opts), opts)
 }
 
-// executePythonModule runs a Python module with real-time output
-func executePythonModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
+// runtimeFor resolves the runtime responsible for a module
+func (mm *ModuleManager) runtimeFor(module *ModuleConfig) (Runtime, error) {
+	if rt, ok := LookupRuntime(module.Type); ok {
+		return rt, nil
+	}
+
+	// A module.yaml declaring both interpreter and entrypoint can run
+	// under any type name, even one that has no registered runtime
+	if module.Metadata != nil && module.Metadata.Interpreter != "" && module.Metadata.Entrypoint != "" {
+		return &InterpreterRuntime{
+			TypeName:    module.Type,
+			Label:       "??",
+			Interpreter: declaredInterpreter(module),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported module type: %s, supported types are: %s", module.Type, strings.Join(RuntimeNames(), ", "))
+}
+
+// executeWithRuntime runs a module through its runtime, teeing output into the result
+func executeWithRuntime(module *ModuleConfig, rt Runtime, args map[string]string, wrappers []string, opts ExecOptions) (*ExecutionResult, error) {
 	result := &ExecutionResult{
 		Timestamp: time.Now(),
 	}
 
-	// Find the main Python script
-	scriptPath := findMainScript(module.Path, ".py")
-	if scriptPath == "" {
+	entrypoint, err := rt.Entrypoint(module)
+	if err != nil {
 		result.Success = false
-		result.Error = "no Python script found in module, expected .py file, e.g., main.py or run.py"
+		result.Error = err.Error()
 		result.ExitCode = 1
 		return result, nil
 	}
 
-	// Build command
-	cmd := exec.Command("python3", scriptPath)
+	cmd, err := rt.Command(module, entrypoint)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		result.ExitCode = 1
+		return result, nil
+	}
 	cmd.Dir = module.Path
+	cmd.Env = rt.Environment(module, args)
+	cmd.Env = append(cmd.Env, "LMV_EVENTS_PREFIX="+EventPrefix)
+	cmd.Env = append(cmd.Env, opts.Env...)
 
-	// Set environment variables for arguments
-	env := os.Environ()
-	for key, value := range args {
-		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	cmd, err = WrapCommand(cmd, wrappers)
+	if err != nil {
+		result.Success = false
+		result.Error = err.Error()
+		result.ExitCode = 1
+		return result, nil
 	}
-	cmd.Env = env
-
-	// Stream output in real-time
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	err := cmd.Run()
 
+	timeout, err := moduleTimeout(module, opts)
 	if err != nil {
 		result.Success = false
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-		} else {
-			result.ExitCode = 1
-		}
 		result.Error = err.Error()
-	} else {
-		result.Success = true
-		result.ExitCode = 0
+		result.ExitCode = 1
+		return result, nil
 	}
-
-	return result, nil
-}
-
-// executeBashModule runs a Bash script module with real-time output
-func executeBashModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
-	result := &ExecutionResult{
-		Timestamp: time.Now(),
+	ctx, cancel := runContext(opts, timeout)
+	defer cancel()
+
+	// Stream output in real-time while keeping a copy for the result;
+	// event lines are taken out of stdout on the way
+	stdout := newCappedBuffer(opts.CaptureLimit)
+	stderr := newCappedBuffer(opts.CaptureLimit)
+	redactor := NewRedactor(opts.Redact)
+	events := &eventCollector{onEvent: opts.OnEvent, redactor: redactor}
+	filter := &eventFilter{out: teeWriter(opts.Stdout, stdout), events: events}
+	cmd.Stdout = filter
+	cmd.Stderr = teeWriter(opts.Stderr, stderr)
+	var redacted []*RedactWriter
+	if redactor != nil {
+		// Secrets are masked before anything else sees the output
+		outR, errR := redactor.Writer(cmd.Stdout), redactor.Writer(cmd.Stderr)
+		cmd.Stdout, cmd.Stderr = outR, errR
+		redacted = append(redacted, outR, errR)
 	}
+	cmd.Stdin = opts.Stdin
 
-	scriptPath := findMainScript(module.Path, ".sh")
-	if scriptPath == "" {
+	eventsR, eventsW, err := eventPipe(cmd)
+	if err != nil {
 		result.Success = false
-		result.Error = "no Bash script found in module"
+		result.Error = fmt.Sprintf("failed to create event pipe: %v", err)
 		result.ExitCode = 1
 		return result, nil
 	}
-
-	cmd := exec.Command("bash", scriptPath)
-	cmd.Dir = module.Path
-
-	// Set environment variables
-	env := os.Environ()
-	for key, value := range args {
-		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	eventsDone := make(chan struct{})
+	if eventsR != nil {
+		go func() {
+			events.readEvents(eventsR)
+			eventsR.Close()
+			close(eventsDone)
+		}()
+	} else {
+		close(eventsDone)
+	}
+	onStart := func(p *Process) {
+		// Only the module may hold the write end, or reading never ends
+		if eventsW != nil {
+			eventsW.Close()
+		}
+		if opts.OnStart != nil {
+			opts.OnStart(p)
+		}
 	}
-	cmd.Env = env
 
-	// Stream output in real-time
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	// The module runs in a process group of its own, away from the
+	// terminal, so a sudo password is asked for before it starts
+	if opts.Foreground {
+		if err := authenticateWrappers(wrappers); err != nil {
+			if eventsW != nil {
+				eventsW.Close()
+			}
+			<-eventsDone
+			result.Success = false
+			result.Error = err.Error()
+			result.ExitCode = 1
+			return result, nil
+		}
+	}
+	proc, err := runProcess(ctx, module.Name, cmd, onStart)
+	if proc != nil {
+		result.Interrupted = proc.Interrupted()
+		result.TimedOut = proc.TimedOut()
+	} else if eventsW != nil {
+		eventsW.Close()
+	}
+	for _, w := range redacted {
+		w.Flush()
+	}
+	filter.Flush()
+	<-eventsDone
 
-	err := cmd.Run()
+	result.Events = events.all()
+	result.Output = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.Truncated() || stderr.Truncated()
 
 	if err != nil {
 		result.Success = false
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
+			result.ExitCode = exitStatus(exitErr)
 		} else {
 			result.ExitCode = 1
 		}
@@ -217,17 +310,12 @@ func executeBashModule(module *ModuleConfig, args map[string]string) (*Execution
 		result.ExitCode = 0
 	}
 
-	return result, nil
-}
-
-// executeGoModule runs a Go module
-func executeGoModule(module *ModuleConfig, args map[string]string) (*ExecutionResult, error) {
-	result := &ExecutionResult{
-		Timestamp: time.Now(),
-		Success:   false,
-		Error:     "Go module execution not yet implemented, please build and run manually, thanks!",
-		ExitCode:  1,
+	// A module that catches SIGTERM and exits cleanly still ran out of time
+	if result.TimedOut {
+		result.Success = false
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
 	}
+
 	return result, nil
 }
 
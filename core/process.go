@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+)
+
+// Process is a running module. Modules are started in their own process
+// group, so signals reach every child they spawn, not just the interpreter
+type Process struct {
+	Module string
+	Pid    int
+	Pgid   int // equal to Pid where process groups are supported, else 0
+
+	cmd         *exec.Cmd
+	done        chan struct{}
+	interrupted atomic.Bool
+	timedOut    atomic.Bool
+}
+
+func newProcess(module string, cmd *exec.Cmd) *Process {
+	return &Process{
+		Module: module,
+		Pid:    cmd.Process.Pid,
+		Pgid:   processGroupID(cmd),
+		cmd:    cmd,
+		done:   make(chan struct{}),
+	}
+}
+
+// Done is closed once the process has exited
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Interrupt sends SIGINT to the process group
+func (p *Process) Interrupt() error {
+	return p.Signal(syscall.SIGINT)
+}
+
+// Terminate sends SIGTERM to the process group
+func (p *Process) Terminate() error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+// Kill sends SIGKILL to the process group. Unlike the other signals it is
+// delivered even after the leader exited, so children that ignored SIGTERM
+// and outlived the interpreter are cleaned up too
+func (p *Process) Kill() error {
+	p.interrupted.Store(true)
+	return signalProcess(p.cmd, syscall.SIGKILL)
+}
+
+// Signal delivers sig to the whole process group and marks the run as
+// interrupted
+func (p *Process) Signal(sig syscall.Signal) error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	p.interrupted.Store(true)
+	return signalProcess(p.cmd, sig)
+}
+
+// Interrupted reports whether the process was signalled by us, other than
+// for running out of time
+func (p *Process) Interrupted() bool {
+	return p.interrupted.Load() && !p.timedOut.Load()
+}
+
+// TimedOut reports whether the process was stopped by its timeout
+func (p *Process) TimedOut() bool {
+	return p.timedOut.Load()
+}
+
+// RunDetached runs a command in its own process group, like a module: it
+// gets no terminal signals and is terminated when ctx is done. onStart, if
+// set, receives the process as in ExecOptions
+func RunDetached(ctx context.Context, name string, cmd *exec.Cmd, onStart func(*Process)) error {
+	_, err := runProcess(ctx, name, cmd, onStart)
+	return err
+}
+
+// runProcess starts cmd in a new process group and waits for it, stopping
+// the group if ctx is done first. The process is nil if it failed to start
+func runProcess(ctx context.Context, name string, cmd *exec.Cmd, onStart func(*Process)) (*Process, error) {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := newProcess(name, cmd)
+	if onStart != nil {
+		onStart(proc)
+	}
+	watched := make(chan struct{})
+	go func() {
+		proc.watch(ctx)
+		close(watched)
+	}()
+	err := cmd.Wait()
+	close(proc.done)
+	<-watched
+	return proc, err
+}
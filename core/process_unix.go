@@ -0,0 +1,59 @@
+//go:build !windows
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes the command the leader of a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func processGroupID(cmd *exec.Cmd) int {
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+	if err != nil {
+		return cmd.Process.Pid
+	}
+	return pgid
+}
+
+// signalProcess signals every process in the command's group. A group
+// stopped for reading the terminal from the background is continued, or
+// it would never act on the signal
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal) error {
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+		return err
+	}
+	if sig != syscall.SIGKILL {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT)
+	}
+	return nil
+}
+
+// exitStatus reports a death by signal as 128+signal, as shells do
+func exitStatus(err *exec.ExitError) int {
+	if ws, ok := err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return err.ExitCode()
+}
+
+// eventPipe passes the command a pipe for structured events, announced to
+// the module in LMV_EVENTS_FD. The caller closes w once the command started
+func eventPipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("LMV_EVENTS_FD=%d", 2+len(cmd.ExtraFiles)))
+	return r, w, nil
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op, Windows has no POSIX process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func processGroupID(cmd *exec.Cmd) int {
+	return 0
+}
+
+// signalProcess kills the process; Windows cannot deliver SIGINT or SIGTERM
+// to another process
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
+
+func exitStatus(err *exec.ExitError) int {
+	return err.ExitCode()
+}
+
+// eventPipe is unavailable, Windows cannot pass extra descriptors; modules
+// use the LMV_EVENTS_PREFIX lines on stdout instead
+func eventPipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	return nil, nil, nil
+}
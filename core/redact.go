@@ -0,0 +1,127 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+)
+
+// RedactMask replaces secret values wherever they would be shown or stored
+const RedactMask = "********"
+
+// Redactor masks a set of secret values in text
+type Redactor struct {
+	secrets [][]byte // longest first, so a secret containing another is masked whole
+}
+
+// NewRedactor returns a redactor for the given values, nil when there is
+// nothing to mask. Empty values are ignored
+func NewRedactor(secrets []string) *Redactor {
+	r := &Redactor{}
+	seen := make(map[string]bool)
+	for _, s := range secrets {
+		if s != "" && !seen[s] {
+			seen[s] = true
+			r.secrets = append(r.secrets, []byte(s))
+		}
+	}
+	if len(r.secrets) == 0 {
+		return nil
+	}
+	sort.Slice(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+	return r
+}
+
+// String masks every secret in s
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	return string(r.bytes([]byte(s)))
+}
+
+func (r *Redactor) bytes(p []byte) []byte {
+	for _, secret := range r.secrets {
+		p = bytes.ReplaceAll(p, secret, []byte(RedactMask))
+	}
+	return p
+}
+
+// Event masks every secret in an event's message and text fields
+func (r *Redactor) Event(ev Event) Event {
+	if r == nil {
+		return ev
+	}
+	ev.Message = r.String(ev.Message)
+	if len(ev.Fields) > 0 {
+		fields := make(map[string]interface{}, len(ev.Fields))
+		for key, value := range ev.Fields {
+			if s, ok := value.(string); ok {
+				value = r.String(s)
+			}
+			fields[key] = value
+		}
+		ev.Fields = fields
+	}
+	return ev
+}
+
+// Writer returns a writer that masks secrets on their way to w. The end of
+// a write that could be the start of a secret is held back until the next
+// write or Flush
+func (r *Redactor) Writer(w io.Writer) *RedactWriter {
+	return &RedactWriter{r: r, w: w}
+}
+
+// RedactWriter is a Redactor in front of a writer
+type RedactWriter struct {
+	mu      sync.Mutex
+	r       *Redactor
+	w       io.Writer
+	pending []byte
+}
+
+func (rw *RedactWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	data := rw.r.bytes(append(rw.pending, p...))
+	keep := rw.partialSecret(data)
+	rw.pending = append([]byte(nil), data[len(data)-keep:]...)
+	if _, err := rw.w.Write(data[:len(data)-keep]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out whatever was held back
+func (rw *RedactWriter) Flush() {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if len(rw.pending) > 0 {
+		rw.w.Write(rw.pending)
+		rw.pending = nil
+	}
+}
+
+// partialSecret returns the length of the longest end of data that is the
+// beginning of a secret
+func (rw *RedactWriter) partialSecret(data []byte) int {
+	longest := 0
+	for _, secret := range rw.r.secrets {
+		n := len(secret) - 1
+		if n > len(data) {
+			n = len(data)
+		}
+		for ; n > longest; n-- {
+			if bytes.HasSuffix(data, secret[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactorString(t *testing.T) {
+	tests := []struct {
+		secrets []string
+		in      string
+		want    string
+	}{
+		{[]string{"hunter2"}, "pass=hunter2 ok", "pass=" + RedactMask + " ok"},
+		{[]string{"abc", "abcdef"}, "abcdef abc", RedactMask + " " + RedactMask},
+		{[]string{"x"}, "xx", RedactMask + RedactMask},
+		{[]string{"", "s"}, "s", RedactMask},
+		{nil, "nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := NewRedactor(tt.secrets).String(tt.in); got != tt.want {
+			t.Errorf("NewRedactor(%q).String(%q) = %q, want %q", tt.secrets, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactorNil(t *testing.T) {
+	if r := NewRedactor([]string{"", ""}); r != nil {
+		t.Errorf("NewRedactor of empty values = %v, want nil", r)
+	}
+}
+
+// A secret split across writes is still masked
+func TestRedactWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"whole", []string{"user hunter2\n"}, "user " + RedactMask + "\n"},
+		{"split", []string{"user hun", "ter2\n"}, "user " + RedactMask + "\n"},
+		{"byte by byte", []string{"h", "u", "n", "t", "e", "r", "2"}, RedactMask},
+		{"false start", []string{"hunt", "ing\n"}, "hunting\n"},
+		{"held at the end", []string{"ends with hun"}, "ends with hun"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		w := NewRedactor([]string{"hunter2"}).Writer(&out)
+		for _, p := range tt.writes {
+			if n, err := w.Write([]byte(p)); err != nil || n != len(p) {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, p, n, err)
+			}
+		}
+		w.Flush()
+		if out.String() != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestRedactorEvent(t *testing.T) {
+	r := NewRedactor([]string{"hunter2"})
+	ev := r.Event(Event{Message: "cred hunter2", Fields: map[string]interface{}{"cred": "hunter2", "port": 22}})
+	if ev.Message != "cred "+RedactMask {
+		t.Errorf("message = %q", ev.Message)
+	}
+	if ev.Fields["cred"] != RedactMask || ev.Fields["port"] != 22 {
+		t.Errorf("fields = %v", ev.Fields)
+	}
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Runtime knows how to detect, locate and launch modules of one type
+type Runtime interface {
+	// Name is the module type as written in module.yaml (e.g. "python")
+	Name() string
+	// Badge returns a short label and a color name for listings
+	Badge() (string, string)
+	// Detect reports whether a module directory looks like this runtime
+	Detect(moduleDir string) bool
+	// Entrypoint returns the absolute path of the file to execute
+	Entrypoint(module *ModuleConfig) (string, error)
+	// Command builds the process used to run the entrypoint
+	Command(module *ModuleConfig, entrypoint string) (*exec.Cmd, error)
+	// Environment returns the process environment for the given arguments
+	Environment(module *ModuleConfig, args map[string]string) []string
+}
+
+var (
+	runtimeMu      sync.RWMutex
+	runtimes       = make(map[string]Runtime)
+	runtimeAliases = make(map[string]string)
+	runtimeOrder   []string
+)
+
+// RegisterRuntime adds a runtime to the registry, replacing any runtime
+// already registered under the same name. Aliases are alternative type
+// names accepted in module.yaml (e.g. "python3" for "python")
+func RegisterRuntime(rt Runtime, aliases ...string) {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	name := rt.Name()
+	if _, exists := runtimes[name]; !exists {
+		runtimeOrder = append(runtimeOrder, name)
+	}
+	runtimes[name] = rt
+	for _, alias := range aliases {
+		runtimeAliases[alias] = name
+	}
+}
+
+// LookupRuntime returns the runtime registered for a module type or alias
+func LookupRuntime(moduleType string) (Runtime, bool) {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+
+	moduleType = strings.ToLower(strings.TrimSpace(moduleType))
+	if name, ok := runtimeAliases[moduleType]; ok {
+		moduleType = name
+	}
+	rt, ok := runtimes[moduleType]
+	return rt, ok
+}
+
+// Runtimes returns all registered runtimes in registration order
+func Runtimes() []Runtime {
+	runtimeMu.RLock()
+	defer runtimeMu.RUnlock()
+
+	list := make([]Runtime, 0, len(runtimeOrder))
+	for _, name := range runtimeOrder {
+		list = append(list, runtimes[name])
+	}
+	return list
+}
+
+// RuntimeNames returns the sorted names of all registered runtimes
+func RuntimeNames() []string {
+	var names []string
+	for _, rt := range Runtimes() {
+		names = append(names, rt.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// moduleEnvironment builds the ARG_* environment shared by all runtimes
+func moduleEnvironment(args map[string]string) []string {
+	env := os.Environ()
+	for key, value := range args {
+		env = append(env, fmt.Sprintf("ARG_%s=%s", strings.ToUpper(key), value))
+	}
+	return env
+}
+
+// declaredEntrypoint resolves the `entrypoint` field from module.yaml, if any
+func declaredEntrypoint(module *ModuleConfig) (string, bool, error) {
+	if module.Metadata == nil || module.Metadata.Entrypoint == "" {
+		return "", false, nil
+	}
+
+	path := module.Metadata.Entrypoint
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(module.Path, path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", true, fmt.Errorf("entrypoint '%s' declared in module.yaml not found", module.Metadata.Entrypoint)
+	}
+	return path, true, nil
+}
+
+// declaredInterpreter returns the `interpreter` field from module.yaml split into argv
+func declaredInterpreter(module *ModuleConfig) []string {
+	if module.Metadata == nil {
+		return nil
+	}
+	return strings.Fields(module.Metadata.Interpreter)
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Interpreter runtime (python, bash, node, ruby, perl, pwsh...)
+// ────────────────────────────────────────────────────────────────────────────────
+
+// InterpreterRuntime runs a script file through an interpreter program
+type InterpreterRuntime struct {
+	TypeName    string
+	Label       string
+	ColorName   string
+	Interpreter []string // e.g. ["python3"] or ["pwsh", "-NoLogo", "-File"]
+	Extensions  []string // first one is the preferred main.<ext>
+}
+
+func (r *InterpreterRuntime) Name() string { return r.TypeName }
+
+func (r *InterpreterRuntime) Badge() (string, string) { return r.Label, r.ColorName }
+
+func (r *InterpreterRuntime) Detect(moduleDir string) bool {
+	for _, ext := range r.Extensions {
+		if findMainScript(moduleDir, ext) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *InterpreterRuntime) Entrypoint(module *ModuleConfig) (string, error) {
+	if path, declared, err := declaredEntrypoint(module); declared {
+		return path, err
+	}
+	for _, ext := range r.Extensions {
+		if path := findMainScript(module.Path, ext); path != "" {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no %s script found in module, expected main%s", r.TypeName, r.Extensions[0])
+}
+
+func (r *InterpreterRuntime) Command(module *ModuleConfig, entrypoint string) (*exec.Cmd, error) {
+	argv := declaredInterpreter(module)
+	if len(argv) == 0 {
+		argv = r.Interpreter
+	}
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return nil, fmt.Errorf("interpreter '%s' for %s modules not found in PATH", argv[0], r.TypeName)
+	}
+
+	args := append(append([]string{}, argv[1:]...), entrypoint)
+	return exec.Command(argv[0], args...), nil
+}
+
+func (r *InterpreterRuntime) Environment(module *ModuleConfig, args map[string]string) []string {
+	return moduleEnvironment(args)
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Go runtime (compiled and cached, see gobuild.go)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type goRuntime struct{}
+
+func (goRuntime) Name() string { return "go" }
+
+func (goRuntime) Badge() (string, string) { return "GO", "magenta" }
+
+func (goRuntime) Detect(moduleDir string) bool {
+	return findMainScript(moduleDir, ".go") != ""
+}
+
+func (goRuntime) Entrypoint(module *ModuleConfig) (string, error) {
+	if path, declared, err := declaredEntrypoint(module); declared {
+		return path, err
+	}
+	if path := findMainScript(module.Path, ".go"); path != "" {
+		return path, nil
+	}
+	return "", fmt.Errorf("no Go source found in module, expected main.go")
+}
+
+func (goRuntime) Command(module *ModuleConfig, entrypoint string) (*exec.Cmd, error) {
+	binPath, err := goModuleBinary(module, entrypoint)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(binPath), nil
+}
+
+func (goRuntime) Environment(module *ModuleConfig, args map[string]string) []string {
+	return moduleEnvironment(args)
+}
+
+// ────────────────────────────────────────────────────────────────────────────────
+// Executable runtime (prebuilt binaries or scripts with a shebang)
+// ────────────────────────────────────────────────────────────────────────────────
+
+type execRuntime struct{}
+
+// execCandidates are the file names tried when no entrypoint is declared
+var execCandidates = []string{"main", "run", "module"}
+
+func (execRuntime) Name() string { return "exec" }
+
+func (execRuntime) Badge() (string, string) { return "EX", "yellow" }
+
+func (execRuntime) Detect(moduleDir string) bool {
+	for _, name := range execCandidates {
+		if isExecutableFile(filepath.Join(moduleDir, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (execRuntime) Entrypoint(module *ModuleConfig) (string, error) {
+	if path, declared, err := declaredEntrypoint(module); declared {
+		return path, err
+	}
+	for _, name := range execCandidates {
+		path := filepath.Join(module.Path, name)
+		if isExecutableFile(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no executable found in module, expected one of: %s", strings.Join(execCandidates, ", "))
+}
+
+func (execRuntime) Command(module *ModuleConfig, entrypoint string) (*exec.Cmd, error) {
+	if argv := declaredInterpreter(module); len(argv) > 0 {
+		return exec.Command(argv[0], append(argv[1:], entrypoint)...), nil
+	}
+	if !isExecutableFile(entrypoint) {
+		return nil, fmt.Errorf("entrypoint '%s' is not executable", filepath.Base(entrypoint))
+	}
+	return exec.Command(entrypoint), nil
+}
+
+func (execRuntime) Environment(module *ModuleConfig, args map[string]string) []string {
+	return moduleEnvironment(args)
+}
+
+// isExecutableFile reports whether path is a regular file with an exec bit set
+func isExecutableFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return info.Mode()&0111 != 0
+}
+
+func init() {
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "python", Label: "PY", ColorName: "blue",
+		Interpreter: []string{"python3"}, Extensions: []string{".py"},
+	}, "python3", "py")
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "bash", Label: "SH", ColorName: "cyan",
+		Interpreter: []string{"bash"}, Extensions: []string{".sh"},
+	}, "sh", "shell")
+	RegisterRuntime(goRuntime{}, "golang")
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "node", Label: "JS", ColorName: "yellow",
+		Interpreter: []string{"node"}, Extensions: []string{".js", ".mjs"},
+	}, "nodejs", "javascript", "js")
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "ruby", Label: "RB", ColorName: "red",
+		Interpreter: []string{"ruby"}, Extensions: []string{".rb"},
+	}, "rb")
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "perl", Label: "PL", ColorName: "blue",
+		Interpreter: []string{"perl"}, Extensions: []string{".pl"},
+	}, "pl")
+	RegisterRuntime(&InterpreterRuntime{
+		TypeName: "powershell", Label: "PS", ColorName: "blue",
+		Interpreter: []string{"pwsh", "-NoLogo", "-NoProfile", "-File"}, Extensions: []string{".ps1"},
+	}, "pwsh", "ps1")
+	RegisterRuntime(execRuntime{}, "executable", "binary")
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeclaredEntrypoint(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "main.py", "src/tool.go", "src/tool.py"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), nil, 0755)
+	}
+
+	tests := []struct {
+		moduleType string
+		entrypoint string
+		want       string
+		wantErr    bool
+	}{
+		{"go", "", "main.go", false},
+		{"go", "src/tool.go", "src/tool.go", false},
+		{"go", "src", "src", false},
+		{"go", "missing.go", "", true},
+		{"python", "", "main.py", false},
+		{"python", "src/tool.py", "src/tool.py", false},
+		{"exec", "src/tool.py", "src/tool.py", false},
+	}
+	for _, tt := range tests {
+		rt, ok := LookupRuntime(tt.moduleType)
+		if !ok {
+			t.Fatalf("no %s runtime", tt.moduleType)
+		}
+		module := &ModuleConfig{Path: dir, Name: "m", Type: tt.moduleType, Metadata: &ModuleMetadata{Entrypoint: tt.entrypoint}}
+		got, err := rt.Entrypoint(module)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s %q: got %s, want an error", tt.moduleType, tt.entrypoint, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.moduleType, tt.entrypoint, err)
+			continue
+		}
+		if want := filepath.Join(dir, tt.want); got != want {
+			t.Errorf("%s %q = %s, want %s", tt.moduleType, tt.entrypoint, got, want)
+		}
+	}
+}
+
+func TestGoModuleEntrypoint(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	cache, _ := os.UserCacheDir()
+	t.Setenv("GOCACHE", filepath.Join(cache, "go-build"))
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":             "module tool\n\ngo 1.21\n",
+		"cmd/tool/main.go":   "package main\n\nfunc main() { println(\"tool\") }\n",
+		"cmd/other/main.go":  "package main\n\nfunc main() { println(\"other\") }\n",
+		"plain/scanner.go":   "package main\n\nfunc main() { println(\"plain \" + name) }\n",
+		"plain/name.go":      "package main\n\nconst name = \"scanner\"\n",
+		"plain/name_test.go": "package main\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		module *ModuleConfig
+		want   string
+	}{
+		{&ModuleConfig{Path: dir, Name: "tool", Metadata: &ModuleMetadata{Entrypoint: "cmd/tool/main.go"}}, "tool"},
+		{&ModuleConfig{Path: dir, Name: "other", Metadata: &ModuleMetadata{Entrypoint: "cmd/other"}}, "other"},
+		{&ModuleConfig{Path: filepath.Join(dir, "plain"), Name: "plain", Metadata: &ModuleMetadata{Entrypoint: "scanner.go"}}, "plain scanner"},
+	}
+	rt, _ := LookupRuntime("go")
+	for _, tt := range tests {
+		entrypoint, err := rt.Entrypoint(tt.module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd, err := rt.Command(tt.module, entrypoint)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.module.Name, err)
+		}
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", tt.module.Name, err, output)
+		}
+		if got := strings.TrimSpace(string(output)); got != tt.want {
+			t.Errorf("%s printed %q, want %q", tt.module.Name, got, tt.want)
+		}
+	}
+
+	if _, err := goModuleBinary(&ModuleConfig{Path: filepath.Join(dir, "cmd"), Name: "x"}, dir); err == nil {
+		t.Error("an entrypoint outside the module was built")
+	}
+}
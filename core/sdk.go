@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The module SDK ships inside the binary and is written out on first use,
+// so modules can `import lmv` (Python) or `source "$LMV_SDK/lmv.sh"` (Bash)
+// wherever lanmanvan is installed
+//
+//go:embed sdk/lmv.py sdk/lmv.sh
+var sdkFiles embed.FS
+
+var (
+	sdkOnce sync.Once
+	sdkPath string
+	sdkErr  error
+)
+
+// SDKDir returns the directory the module SDK is installed in
+func SDKDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "sdk")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "sdk")
+}
+
+// InstallSDK writes the SDK files to SDKDir, leaving files that are already
+// up to date alone, and returns the directory. It only does work once per
+// process
+func InstallSDK() (string, error) {
+	sdkOnce.Do(func() {
+		sdkPath = SDKDir()
+		sdkErr = installSDK(sdkPath)
+	})
+	return sdkPath, sdkErr
+}
+
+func installSDK(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create SDK directory: %w", err)
+	}
+	entries, err := sdkFiles.ReadDir("sdk")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		data, err := sdkFiles.ReadFile("sdk/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, entry.Name())
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to install SDK file %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// LootDir returns the default directory for module artifacts
+func LootDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lanmanvan", "loot")
+	}
+	return filepath.Join(homeDir, ".lanmanvan", "loot")
+}
+
+// sdkEnvironment describes the run to the SDK:
+//
+//	LMV_SDK            directory holding lmv.py and lmv.sh
+//	PYTHONPATH         LMV_SDK first, then whatever was set before
+//	LMV_MODULE         module name
+//	LMV_MODULE_DIR     module directory
+//	LMV_OPTIONS        the options declared in module.yaml, as JSON
+//	LMV_ARTIFACTS_DIR  where this run saves artifacts, created on first use
+//
+// A failure to install the SDK is reported once and leaves the module
+// running without it
+func (mm *ModuleManager) sdkEnvironment(module *ModuleConfig) []string {
+	var env []string
+
+	if dir, err := InstallSDK(); err == nil {
+		pythonPath := dir
+		if existing := os.Getenv("PYTHONPATH"); existing != "" {
+			pythonPath += string(os.PathListSeparator) + existing
+		}
+		env = append(env, "LMV_SDK="+dir, "PYTHONPATH="+pythonPath)
+	} else {
+		mm.sdkWarning.Do(func() {
+			PrintWarning(fmt.Sprintf("Module SDK unavailable: %v", err))
+		})
+	}
+
+	env = append(env, "LMV_MODULE="+module.Name, "LMV_MODULE_DIR="+module.Path)
+
+	options := map[string]OptionMeta{}
+	if module.Metadata != nil && module.Metadata.Options != nil {
+		options = module.Metadata.Options
+	}
+	if data, err := json.Marshal(options); err == nil {
+		env = append(env, "LMV_OPTIONS="+string(data))
+	}
+
+	lootDir := mm.LootDir
+	if lootDir == "" {
+		lootDir = LootDir()
+	}
+	stamp := time.Now().Format("2006-01-02_15-04-05")
+	env = append(env, "LMV_ARTIFACTS_DIR="+filepath.Join(lootDir, module.Name, stamp))
+
+	return env
+}
@@ -0,0 +1,264 @@
+"""lanmanvan module SDK.
+
+Imported by Python modules run from lanmanvan, which puts this file on
+PYTHONPATH. It gives typed access to the options declared in module.yaml
+and helpers to report findings, progress and log lines, read piped input
+and save artifacts:
+
+    import lmv
+
+    opts = lmv.options()
+    lmv.info(f"scanning {opts.target}")
+    for i, port in enumerate(opts.ports):
+        lmv.progress(current=i + 1, total=len(opts.ports))
+        if probe(opts.target, port):
+            lmv.finding(host=opts.target, port=port, state="open")
+    lmv.artifact("scan.txt", report)
+"""
+
+import json
+import os
+import sys
+from datetime import datetime
+
+__all__ = [
+    "Options", "options", "opt", "module_name", "module_dir",
+    "emit", "finding", "progress", "log", "debug", "info", "warn", "error",
+    "has_input", "input_text", "input_lines", "input_records",
+    "artifacts_dir", "artifact", "fail",
+]
+
+EVENT_PREFIX = os.environ.get("LMV_EVENTS_PREFIX", "@@lmv ")
+
+
+# ─── Options ─────────────────────────────────────────────────────────────────
+
+class Options(dict):
+    """Option values by name, also readable as attributes (opts.target).
+    Options that were not given and have no default read as None."""
+
+    def __getattr__(self, name):
+        try:
+            return self[name]
+        except KeyError:
+            return None
+
+
+def _declared():
+    try:
+        return json.loads(os.environ.get("LMV_OPTIONS") or "{}")
+    except ValueError:
+        return {}
+
+
+def _ports(value):
+    ports = []
+    for item in value.split(","):
+        item = item.strip()
+        if not item:
+            continue
+        if "-" in item:
+            lo, hi = item.split("-", 1)
+            ports.extend(range(int(lo), int(hi) + 1))
+        else:
+            ports.append(int(item))
+    return ports
+
+
+def _convert(kind, value):
+    kind = (kind or "string").lower()
+    try:
+        if kind in ("int", "integer", "number", "port"):
+            return int(value)
+        if kind in ("bool", "boolean"):
+            return value.strip().lower() in ("1", "true", "t", "yes", "y", "on", "enable", "enabled")
+        if kind in ("port-range", "ports"):
+            return _ports(value)
+    except ValueError:
+        pass
+    return value
+
+
+def _raw(name):
+    return os.environ.get("ARG_" + name.upper())
+
+
+def options():
+    """Returns every option declared in module.yaml, converted to its
+    declared type: int and port as int, bool as bool, port-range as a list
+    of ints, everything else as str. Undeclared ARG_* values are included
+    as plain strings."""
+    declared = _declared()
+    opts = Options()
+    for name, meta in declared.items():
+        value = _raw(name)
+        if value is None or value == "":
+            value = (meta or {}).get("default") or None
+        opts[name] = None if value is None else _convert((meta or {}).get("type"), value)
+    for key, value in os.environ.items():
+        if key.startswith("ARG_"):
+            name = key[4:].lower()
+            if name not in opts:
+                opts[name] = value
+    return opts
+
+
+def opt(name, default=None):
+    """Returns one option converted to its declared type, or default."""
+    value = _raw(name)
+    meta = _declared().get(name) or {}
+    if value is None or value == "":
+        value = meta.get("default") or None
+    if value is None:
+        return default
+    return _convert(meta.get("type"), value)
+
+
+def module_name():
+    return os.environ.get("LMV_MODULE", "")
+
+
+def module_dir():
+    return os.environ.get("LMV_MODULE_DIR") or os.getcwd()
+
+
+# ─── Events ──────────────────────────────────────────────────────────────────
+
+_events = None
+
+
+def _event_stream():
+    """The events file descriptor when lanmanvan opened one, else stdout
+    with each event behind EVENT_PREFIX."""
+    global _events
+    if _events is None:
+        fd = os.environ.get("LMV_EVENTS_FD")
+        _events = False
+        if fd and fd.isdigit():
+            try:
+                os.fstat(int(fd))
+                _events = os.fdopen(int(fd), "w", buffering=1, closefd=False)
+            except OSError:
+                pass
+    return _events or None
+
+
+def emit(event_type, **fields):
+    """Sends one structured event to lanmanvan."""
+    record = {"type": event_type}
+    record.update(fields)
+    line = json.dumps(record, default=str)
+    stream = _event_stream()
+    if stream is not None:
+        stream.write(line + "\n")
+        stream.flush()
+    else:
+        sys.stdout.write(EVENT_PREFIX + line + "\n")
+        sys.stdout.flush()
+
+
+def finding(**fields):
+    """Reports a result, e.g. finding(host="10.0.0.5", port=22, service="ssh").
+    Findings are shown as a table and passed down pipes as JSON lines."""
+    emit("finding", **fields)
+
+
+def progress(pct=None, msg="", current=None, total=None):
+    """Updates the progress bar, either as a percentage or as current/total."""
+    if pct is not None:
+        emit("progress", pct=pct, msg=msg)
+    else:
+        emit("progress", current=current or 0, total=total or 0, msg=msg)
+
+
+def log(msg, level="info"):
+    """Shows a log line; level is debug, info, warn or error."""
+    emit("log", level=level, msg=str(msg))
+
+
+def debug(msg):
+    log(msg, "debug")
+
+
+def info(msg):
+    log(msg, "info")
+
+
+def warn(msg):
+    log(msg, "warn")
+
+
+def error(msg):
+    log(msg, "error")
+
+
+def fail(msg, code=1):
+    """Logs an error and exits the module with the given status."""
+    error(msg)
+    sys.exit(code)
+
+
+# ─── Piped input ─────────────────────────────────────────────────────────────
+
+_input = None
+
+
+def has_input():
+    """Reports whether the module was fed input, e.g. from a pipe."""
+    return not sys.stdin.isatty() if sys.stdin else False
+
+
+def input_text():
+    """Returns everything piped into the module, "" when nothing was."""
+    global _input
+    if _input is None:
+        _input = sys.stdin.read() if has_input() else ""
+    return _input
+
+
+def input_lines():
+    """Returns the non-empty lines piped into the module."""
+    return [line.strip() for line in input_text().splitlines() if line.strip()]
+
+
+def input_records():
+    """Returns piped input as a list of dicts. Findings from an upstream
+    module arrive as JSON lines; plain text lines become {"line": text}."""
+    records = []
+    structured = os.environ.get("LMV_INPUT_FORMAT") == "jsonl"
+    for line in input_lines():
+        if structured:
+            try:
+                record = json.loads(line)
+                if isinstance(record, dict):
+                    records.append(record)
+                    continue
+            except ValueError:
+                pass
+        records.append({"line": line})
+    return records
+
+
+# ─── Artifacts ───────────────────────────────────────────────────────────────
+
+def artifacts_dir():
+    """Returns this run's artifact directory, creating it on first use."""
+    path = os.environ.get("LMV_ARTIFACTS_DIR")
+    if not path:
+        stamp = datetime.now().strftime("%Y-%m-%d_%H-%M-%S")
+        path = os.path.join(module_dir(), "loot", stamp)
+        os.environ["LMV_ARTIFACTS_DIR"] = path
+    os.makedirs(path, exist_ok=True)
+    return path
+
+
+def artifact(name, data=None):
+    """Returns the path for an artifact called name and reports it to
+    lanmanvan. When data (str or bytes) is given it is written there."""
+    path = os.path.join(artifacts_dir(), os.path.basename(name))
+    if data is not None:
+        mode = "wb" if isinstance(data, (bytes, bytearray)) else "w"
+        with open(path, mode) as f:
+            f.write(data)
+    emit("artifact", path=path, name=os.path.basename(name))
+    return path
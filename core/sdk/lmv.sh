@@ -0,0 +1,159 @@
+# lanmanvan module SDK for Bash.
+#
+# Bash modules run from lanmanvan can source it from the path in $LMV_SDK:
+#
+#   source "$LMV_SDK/lmv.sh"
+#
+#   target=$(lmv_opt target)
+#   lmv_info "scanning $target"
+#   for port in $(lmv_ports ports); do
+#       lmv_progress_of "$((++i))" "$(lmv_ports ports | wc -w)"
+#       probe "$target" "$port" && lmv_finding host="$target" port="$port" state=open
+#   done
+#   lmv_artifact scan.txt ./scan.txt
+
+LMV_EVENTS_PREFIX="${LMV_EVENTS_PREFIX:-@@lmv }"
+
+# ─── Options ────────────────────────────────────────────────────────────────
+
+# lmv_opt NAME [DEFAULT] prints an option's value (ARG_NAME), or DEFAULT
+lmv_opt() {
+    local var="ARG_${1^^}"
+    printf '%s\n' "${!var:-$2}"
+}
+
+# lmv_bool NAME succeeds when the option is set to a true value
+lmv_bool() {
+    case "$(lmv_opt "$1" "$2")" in
+        1|[Tt]rue|[Tt]|[Yy]es|[Yy]|[Oo]n|[Ee]nable|[Ee]nabled) return 0 ;;
+    esac
+    return 1
+}
+
+# lmv_list NAME prints a comma separated option one item per line
+lmv_list() {
+    local item
+    local IFS=','
+    for item in $(lmv_opt "$1" "$2"); do
+        item="${item#"${item%%[![:space:]]*}"}"
+        item="${item%"${item##*[![:space:]]}"}"
+        [[ -n "$item" ]] && printf '%s\n' "$item"
+    done
+}
+
+# lmv_ports NAME expands a port-range option (22,80,8000-8010) one port per line
+lmv_ports() {
+    local item
+    while read -r item; do
+        if [[ "$item" == *-* ]]; then
+            seq "${item%%-*}" "${item#*-}"
+        else
+            printf '%s\n' "$item"
+        fi
+    done < <(lmv_list "$1" "$2")
+}
+
+# ─── Events ─────────────────────────────────────────────────────────────────
+
+# _lmv_json_string quotes a value as a JSON string
+_lmv_json_string() {
+    local s="$1"
+    s="${s//\\/\\\\}"
+    s="${s//\"/\\\"}"
+    s="${s//$'\n'/\\n}"
+    s="${s//$'\r'/\\r}"
+    s="${s//$'\t'/\\t}"
+    printf '"%s"' "$s"
+}
+
+# _lmv_json_value leaves numbers and booleans bare and quotes the rest
+_lmv_json_value() {
+    if [[ "$1" =~ ^-?(0|[1-9][0-9]*)(\.[0-9]+)?$ || "$1" == true || "$1" == false ]]; then
+        printf '%s' "$1"
+    else
+        _lmv_json_string "$1"
+    fi
+}
+
+# lmv_emit TYPE key=value... sends one structured event to lanmanvan
+lmv_emit() {
+    local line="{\"type\":$(_lmv_json_string "$1")"
+    shift
+    local pair
+    for pair in "$@"; do
+        line+=",$(_lmv_json_string "${pair%%=*}"):$(_lmv_json_value "${pair#*=}")"
+    done
+    line+="}"
+
+    if [[ "$LMV_EVENTS_FD" =~ ^[0-9]+$ ]] && { true >&"$LMV_EVENTS_FD"; } 2>/dev/null; then
+        printf '%s\n' "$line" >&"$LMV_EVENTS_FD"
+    else
+        printf '%s%s\n' "$LMV_EVENTS_PREFIX" "$line"
+    fi
+}
+
+# lmv_finding key=value... reports a result, e.g. lmv_finding host=10.0.0.5 port=22
+lmv_finding() {
+    lmv_emit finding "$@"
+}
+
+# lmv_progress PCT [MESSAGE] updates the progress bar
+lmv_progress() {
+    lmv_emit progress "pct=$1" "msg=${2:-}"
+}
+
+# lmv_progress_of CURRENT TOTAL [MESSAGE] updates the progress bar from a count
+lmv_progress_of() {
+    lmv_emit progress "current=$1" "total=$2" "msg=${3:-}"
+}
+
+# lmv_log LEVEL MESSAGE shows a log line (debug, info, warn or error)
+lmv_log() {
+    lmv_emit log "level=$1" "msg=$2"
+}
+
+lmv_debug() { lmv_log debug "$*"; }
+lmv_info()  { lmv_log info "$*"; }
+lmv_warn()  { lmv_log warn "$*"; }
+lmv_error() { lmv_log error "$*"; }
+
+# lmv_fail MESSAGE [CODE] logs an error and exits the module
+lmv_fail() {
+    lmv_error "$1"
+    exit "${2:-1}"
+}
+
+# ─── Piped input ────────────────────────────────────────────────────────────
+
+# lmv_input prints whatever was piped into the module, nothing when stdin
+# is a terminal. With LMV_INPUT_FORMAT=jsonl each line is one finding
+lmv_input() {
+    [[ -t 0 ]] && return 0
+    cat
+}
+
+# ─── Artifacts ──────────────────────────────────────────────────────────────
+
+# lmv_artifacts_dir prints this run's artifact directory, creating it
+lmv_artifacts_dir() {
+    if [[ -z "$LMV_ARTIFACTS_DIR" ]]; then
+        LMV_ARTIFACTS_DIR="${LMV_MODULE_DIR:-$PWD}/loot/$(date +%Y-%m-%d_%H-%M-%S)"
+        export LMV_ARTIFACTS_DIR
+    fi
+    mkdir -p "$LMV_ARTIFACTS_DIR" && printf '%s\n' "$LMV_ARTIFACTS_DIR"
+}
+
+# lmv_artifact NAME [FILE] prints the path for an artifact and reports it to
+# lanmanvan. FILE is copied there; without it, stdin is saved when piped
+lmv_artifact() {
+    local dir path
+    dir="$(lmv_artifacts_dir)" || return 1
+    path="$dir/$(basename "$1")"
+    if [[ -n "$2" ]]; then
+        cp -- "$2" "$path" || return 1
+    elif [[ -p /dev/stdin ]]; then
+        cat > "$path" || return 1
+    fi
+    lmv_emit artifact "path=$path" "name=$(basename "$1")"
+    printf '%s\n' "$path"
+}
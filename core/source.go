@@ -0,0 +1,400 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Where modules are installed from:
+//
+//	a name from repo_url.yaml    basic81
+//	a git URL, #ref optional     https://github.com/org/modules#v1.2
+//	a local directory            ./my-modules
+//	a tarball, local or http(s)  https://example.com/modules.tar.gz
+//
+// Every directory of the source holding a module.yaml is a module
+
+// RepoFile names the repositories `module install` knows by name. It lives
+// in the modules directory
+const RepoFile = "repo_url.yaml"
+
+// Source kinds
+const (
+	SourceGit     = "git"
+	SourceDir     = "dir"
+	SourceTarball = "tarball"
+)
+
+// downloadTimeout bounds fetching a tarball over http(s)
+const downloadTimeout = 5 * time.Minute
+
+// Source is where modules come from
+type Source struct {
+	Repo     string `json:"repo,omitempty"` // name in repo_url.yaml, if given by name
+	Location string `json:"source"`         // URL or absolute path
+	Ref      string `json:"ref,omitempty"`  // git branch, tag or commit
+	Kind     string `json:"kind"`
+}
+
+// String is the source as it would be given to `module install`
+func (s Source) String() string {
+	if s.Repo != "" {
+		return s.Repo
+	}
+	if s.Ref != "" {
+		return s.Location + "#" + s.Ref
+	}
+	return s.Location
+}
+
+// LoadRepos reads the named repositories of repo_url.yaml, none when the
+// file does not exist
+func (mm *ModuleManager) LoadRepos() (map[string]string, error) {
+	repos := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(mm.ModulesDir, RepoFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return repos, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &repos); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", RepoFile, err)
+	}
+	return repos, nil
+}
+
+// ResolveSource works out what kind of source spec is. Relative paths are
+// resolved against baseDir
+func (mm *ModuleManager) ResolveSource(spec string, baseDir string) (Source, error) {
+	var src Source
+	location := spec
+
+	repos, err := mm.LoadRepos()
+	if err != nil {
+		return src, err
+	}
+	name, ref, _ := strings.Cut(spec, "#")
+	if url, ok := repos[name]; ok {
+		src.Repo, location, src.Ref = name, url, ref
+	}
+
+	// A local path wins over a #ref, which could be part of its name
+	path := location
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	if info, err := os.Stat(path); err == nil && src.Repo == "" {
+		src.Location = path
+		switch {
+		case info.IsDir():
+			src.Kind = SourceDir
+		case isTarball(path):
+			src.Kind = SourceTarball
+		default:
+			return src, fmt.Errorf("'%s' is neither a directory nor a tarball", spec)
+		}
+		return src, nil
+	}
+
+	if src.Repo == "" {
+		location, src.Ref, _ = strings.Cut(location, "#")
+	}
+	src.Location = location
+	switch {
+	case isTarball(location) && isURL(location):
+		src.Kind = SourceTarball
+	case isURL(location) || strings.HasPrefix(location, "git@") || strings.HasSuffix(location, ".git"):
+		src.Kind = SourceGit
+	default:
+		return src, fmt.Errorf("unknown source '%s': not a repository in %s, a directory, a tarball or a git URL", spec, RepoFile)
+	}
+	if src.Kind == SourceTarball && src.Ref != "" {
+		return src, fmt.Errorf("a tarball has no #ref: %s", spec)
+	}
+	return src, nil
+}
+
+func isURL(s string) bool {
+	return strings.Contains(s, "://")
+}
+
+func isTarball(s string) bool {
+	s = strings.ToLower(s)
+	return strings.HasSuffix(s, ".tar.gz") || strings.HasSuffix(s, ".tgz") || strings.HasSuffix(s, ".tar")
+}
+
+// fetchedSource is a source made available as a local directory
+type fetchedSource struct {
+	Dir     string
+	Commit  string // for git sources and directories that are git checkouts
+	cleanup func()
+}
+
+// Close removes whatever fetching left behind
+func (f *fetchedSource) Close() {
+	if f.cleanup != nil {
+		f.cleanup()
+	}
+}
+
+// fetchSource clones, downloads or extracts a source into a temporary
+// directory. A local directory is used where it is
+func fetchSource(src Source) (*fetchedSource, error) {
+	if src.Kind == SourceDir {
+		commit, _ := gitOutput(src.Location, "rev-parse", "HEAD")
+		return &fetchedSource{Dir: src.Location, Commit: commit}, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "lmv-module-*")
+	if err != nil {
+		return nil, err
+	}
+	fetched := &fetchedSource{Dir: tmp, cleanup: func() { os.RemoveAll(tmp) }}
+
+	switch src.Kind {
+	case SourceGit:
+		err = cloneGit(src, tmp)
+		if err == nil {
+			fetched.Commit, err = gitOutput(tmp, "rev-parse", "HEAD")
+		}
+	case SourceTarball:
+		err = extractTarball(src.Location, tmp)
+	default:
+		err = fmt.Errorf("unknown source kind '%s'", src.Kind)
+	}
+	if err != nil {
+		fetched.Close()
+		return nil, err
+	}
+	return fetched, nil
+}
+
+// cloneGit clones a repository into dir, at src.Ref if one is given
+func cloneGit(src Source, dir string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is needed to install from %s", src.Location)
+	}
+	// Neither the location nor the ref may pass for an option of git's
+	if strings.HasPrefix(src.Ref, "-") {
+		return fmt.Errorf("invalid ref '%s'", src.Ref)
+	}
+	args := []string{"clone", "--quiet"}
+	if src.Ref == "" {
+		args = append(args, "--depth", "1")
+	}
+	args = append(args, "--", src.Location, dir)
+	if _, err := gitOutput("", args...); err != nil {
+		return err
+	}
+	if src.Ref != "" {
+		if _, err := gitOutput(dir, "checkout", "--quiet", src.Ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitOutput runs git in dir and returns its trimmed output. It never
+// prompts for credentials
+func gitOutput(dir string, args ...string) (string, error) {
+	command := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v\n%s", command, err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// extractTarball unpacks a local or http(s) tarball into dir. Only
+// directories and regular files are extracted; links and entries that
+// would land outside dir are skipped
+func extractTarball(location string, dir string) error {
+	var r io.Reader
+	if isURL(location) {
+		client := &http.Client{Timeout: downloadTimeout}
+		resp, err := client.Get(location)
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", location, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to download %s: %s", location, resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if !strings.HasSuffix(strings.ToLower(location), ".tar") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", location, err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		target := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// findModules returns the modules in a fetched source, by name. A module
+// at the top of the source is named after its module.yaml, or the source
+func findModules(root string, src Source) (map[string]string, error) {
+	found := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, "module.yaml")); err != nil {
+			return nil
+		}
+
+		name := info.Name()
+		if path == root {
+			name = sourceModuleName(path, src)
+		}
+		if other, ok := found[name]; ok {
+			return fmt.Errorf("two modules named '%s' in the source: %s and %s", name, other, path)
+		}
+		found[name] = path
+		// Modules do not nest
+		return filepath.SkipDir
+	})
+	return found, err
+}
+
+// sourceModuleName names a module that is the whole source
+func sourceModuleName(dir string, src Source) string {
+	if meta, err := loadMetadata(filepath.Join(dir, "module.yaml")); err == nil && isModuleName(meta.Name) {
+		return meta.Name
+	}
+	base := filepath.Base(strings.TrimSuffix(src.Location, "/"))
+	for _, ext := range []string{".git", ".tar.gz", ".tgz", ".tar"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+// isModuleName reports whether name can be a module's directory
+func isModuleName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`) && name != ".."
+}
+
+// HashModule hashes a module's files: names, contents and whether they are
+// executable. Hidden directories and Python bytecode are left out, as
+// running a module may create them
+func HashModule(dir string) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (strings.HasPrefix(info.Name(), ".") || info.Name() == "__pycache__") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() && !strings.HasSuffix(info.Name(), ".pyc") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(h, "%s\x00%t\x00", filepath.ToSlash(rel), info.Mode()&0111 != 0)
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSource(t *testing.T) {
+	modulesDir := t.TempDir()
+	repos := "basic81: https://github.com/org/modules.git\n"
+	if err := os.WriteFile(filepath.Join(modulesDir, RepoFile), []byte(repos), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := t.TempDir()
+	if err := os.Mkdir(filepath.Join(base, "local"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "pack.tgz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mm := NewModuleManager(modulesDir)
+
+	tests := []struct {
+		spec    string
+		want    Source
+		wantErr bool
+	}{
+		{"basic81", Source{Repo: "basic81", Location: "https://github.com/org/modules.git", Kind: SourceGit}, false},
+		{"basic81#v2", Source{Repo: "basic81", Location: "https://github.com/org/modules.git", Ref: "v2", Kind: SourceGit}, false},
+		{"https://example.com/x.git#main", Source{Location: "https://example.com/x.git", Ref: "main", Kind: SourceGit}, false},
+		{"git@github.com:org/x", Source{Location: "git@github.com:org/x", Kind: SourceGit}, false},
+		{"https://example.com/pack.tar.gz", Source{Location: "https://example.com/pack.tar.gz", Kind: SourceTarball}, false},
+		{"local", Source{Location: filepath.Join(base, "local"), Kind: SourceDir}, false},
+		{"pack.tgz", Source{Location: filepath.Join(base, "pack.tgz"), Kind: SourceTarball}, false},
+		{"notes.txt", Source{}, true},
+		{"https://example.com/pack.tgz#v1", Source{}, true},
+		{"nowhere", Source{}, true},
+	}
+	for _, tt := range tests {
+		got, err := mm.ResolveSource(tt.spec, base)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ResolveSource(%q) error = %v, wantErr %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ResolveSource(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCloneGitRejectsOptionRef(t *testing.T) {
+	err := cloneGit(Source{Location: "https://example.com/x.git", Ref: "--upload-pack=touch", Kind: SourceGit}, t.TempDir())
+	if err == nil {
+		t.Fatal("a ref starting with '-' was accepted")
+	}
+}
+
+// tarEntry is one entry of a test tarball
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	link     string
+}
+
+func writeTarball(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0755, Size: int64(len(e.body)), Linkname: e.link}
+		if e.typeflag != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTarball(t *testing.T) {
+	tarball := filepath.Join(t.TempDir(), "pack.tar.gz")
+	writeTarball(t, tarball, []tarEntry{
+		{name: "pack/", typeflag: tar.TypeDir},
+		{name: "pack/scan/module.yaml", typeflag: tar.TypeReg, body: "name: scan\n"},
+		{name: "pack/scan/main.sh", typeflag: tar.TypeReg, body: "echo hi\n"},
+		{name: "../escape.txt", typeflag: tar.TypeReg, body: "out"},
+		{name: "pack/../../escape2.txt", typeflag: tar.TypeReg, body: "out"},
+		{name: "/abs.txt", typeflag: tar.TypeReg, body: "out"},
+		{name: "pack/link", typeflag: tar.TypeSymlink, link: "/etc/passwd"},
+	})
+
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTarball(tarball, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{filepath.Join(dir, "pack/scan/module.yaml"), true},
+		{filepath.Join(dir, "pack/scan/main.sh"), true},
+		{filepath.Join(dir, "abs.txt"), false},
+		{filepath.Join(parent, "escape.txt"), false},
+		{filepath.Join(parent, "escape2.txt"), false},
+		{filepath.Join(dir, "pack/link"), false},
+	}
+	for _, tt := range tests {
+		_, err := os.Lstat(tt.path)
+		if exists := err == nil; exists != tt.exists {
+			t.Errorf("%s: exists = %t, want %t", tt.path, exists, tt.exists)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "pack/scan/main.sh"))
+	if err == nil && info.Mode().Perm()&0100 == 0 {
+		t.Errorf("main.sh lost its executable bit: %v", info.Mode())
+	}
+}
+
+func TestFindModules(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "nested/b", "a/inner", ".git/c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "module.yaml"), []byte("name: x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := findModules(root, Source{Location: root, Kind: SourceDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": filepath.Join(root, "a"), "b": filepath.Join(root, "nested/b")}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+	for name, path := range want {
+		if found[name] != path {
+			t.Errorf("%s: found at %q, want %q", name, found[name], path)
+		}
+	}
+}
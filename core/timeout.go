@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KillGracePeriod is how long a module gets after SIGTERM before SIGKILL follows
+const KillGracePeriod = 3 * time.Second
+
+// ParseTimeout reads a timeout such as "30" (seconds), "90s" or "5m".
+// An empty value or "0" means no timeout
+func ParseTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs < 0 {
+			return 0, fmt.Errorf("invalid timeout %q: must not be negative", value)
+		}
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: use seconds or a duration like 90s, 5m", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q: must not be negative", value)
+	}
+	return d, nil
+}
+
+// moduleTimeout picks the timeout for a run: the per-run one, then the
+// module's own, then the session default
+func moduleTimeout(module *ModuleConfig, opts ExecOptions) (time.Duration, error) {
+	if opts.Timeout < 0 {
+		return 0, nil
+	}
+	if opts.Timeout > 0 {
+		return opts.Timeout, nil
+	}
+	if module.Metadata != nil && module.Metadata.Timeout != "" {
+		d, err := ParseTimeout(module.Metadata.Timeout)
+		if err != nil {
+			return 0, fmt.Errorf("module.yaml: %w", err)
+		}
+		if d > 0 {
+			return d, nil
+		}
+	}
+	return opts.DefaultTimeout, nil
+}
+
+// runContext derives the context a run is bound to
+func runContext(opts ExecOptions, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// watch stops the process group once ctx is done: SIGTERM first, then
+// SIGKILL after KillGracePeriod. It returns when the process exits
+func (p *Process) watch(ctx context.Context) {
+	select {
+	case <-p.done:
+		return
+	case <-ctx.Done():
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.timedOut.Store(true)
+	}
+	_ = p.Terminate()
+
+	select {
+	case <-p.done:
+	case <-time.After(KillGracePeriod):
+	}
+	// Children may outlive the leader, so the group is killed regardless
+	_ = p.Kill()
+}
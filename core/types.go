@@ -1,16 +1,25 @@
 package core
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // ModuleMetadata holds information about a module
 type ModuleMetadata struct {
 	Name        string                `yaml:"name"`
 	Description string                `yaml:"description"`
-	Type        string                `yaml:"type"` // python, bash, go
+	Type        string                `yaml:"type"`        // any registered runtime, see runtime.go
+	Entrypoint  string                `yaml:"entrypoint"`  // optional, relative to the module directory
+	Interpreter string                `yaml:"interpreter"` // optional, overrides the runtime's interpreter
+	Wrappers    []string              `yaml:"wrappers"`    // optional, e.g. [sudo, "nice -n 5"], see wrapper.go
+	Timeout     string                `yaml:"timeout"`     // optional, e.g. 90s or 5m, see timeout.go
 	Author      string                `yaml:"author"`
 	Version     string                `yaml:"version"`
 	Options     map[string]OptionMeta `yaml:"options"`
 	Required    []string              `yaml:"required"`
+	AllowEnv    []string              `yaml:"allow_env"`       // optional, variables passed besides the options, see arguments.go
+	Passthrough bool                  `yaml:"passthrough_env"` // optional, legacy: every variable is passed as an argument
 	Tags        []string              `yaml:"tags"`
 	GitHubURL   string                `yaml:"github_url"`
 	XUrl        string                `yaml:"x_url"`
@@ -18,10 +27,21 @@ type ModuleMetadata struct {
 
 // OptionMeta describes a module option
 type OptionMeta struct {
-	Type        string `yaml:"type"` // string, int, bool, file
-	Description string `yaml:"description"`
-	Default     string `yaml:"default"`
-	Required    bool   `yaml:"required"`
+	Type        string   `yaml:"type" json:"type,omitempty"` // string, int, bool, file, path, ip, cidr, port, port-range, url, enum, secret
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Default     string   `yaml:"default" json:"default,omitempty"`
+	Required    bool     `yaml:"required" json:"required,omitempty"`
+	Choices     []string `yaml:"choices" json:"choices,omitempty"` // allowed values for enum
+	Pattern     string   `yaml:"pattern" json:"pattern,omitempty"` // optional regex the raw value must match
+	Min         *int     `yaml:"min" json:"min,omitempty"`         // optional lower bound for int
+	Max         *int     `yaml:"max" json:"max,omitempty"`         // optional upper bound for int
+}
+
+// IsSecret reports whether the option holds a credential, whose value is
+// masked wherever it would be shown or stored
+func (o OptionMeta) IsSecret() bool {
+	t := strings.ToLower(o.Type)
+	return t == "secret" || t == "password"
 }
 
 // ExecutionRequest represents a module execution request
@@ -33,11 +53,16 @@ type ExecutionRequest struct {
 
 // ExecutionResult represents module execution output
 type ExecutionResult struct {
-	Success   bool
-	Output    string
-	Error     string
-	ExitCode  int
-	Timestamp time.Time
+	Success     bool
+	Output      string  // captured stdout
+	Stderr      string  // captured stderr
+	Truncated   bool    // true if either stream exceeded the capture limit
+	Interrupted bool    // true if the run was stopped by a signal we sent (Ctrl+C)
+	TimedOut    bool    // true if the run was stopped because it exceeded its timeout
+	Events      []Event // structured records the module emitted, see events.go
+	Error       string
+	ExitCode    int
+	Timestamp   time.Time
 }
 
 // ModuleConfig represents runtime configuration
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OptionError describes why a single option was rejected
+type OptionError struct {
+	Option string
+	Value  string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("%s: %s", e.Option, e.Reason)
+	}
+	return fmt.Sprintf("%s=%q: %s", e.Option, e.Value, e.Reason)
+}
+
+// ValidationErrors collects every option problem found in one pass
+type ValidationErrors []*OptionError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Error())
+	}
+	return "invalid arguments: " + strings.Join(msgs, "; ")
+}
+
+// PrepareArguments validates arguments against a module's declared options,
+// coercing values to canonical form and injecting defaults. Arguments the
+// module does not accept are dropped. Relative file paths are resolved
+// against baseDir. A ValidationErrors is returned when any option is missing
+// or invalid
+func (mm *ModuleManager) PrepareArguments(moduleName string, args map[string]string, baseDir string) (map[string]string, error) {
+	module, err := mm.GetModule(moduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared, errs := ValidateArguments(module.Metadata, args, baseDir)
+	if len(errs) > 0 {
+		return prepared, errs
+	}
+	return prepared, nil
+}
+
+// ValidateArguments is the metadata-only core of PrepareArguments
+func ValidateArguments(meta *ModuleMetadata, args map[string]string, baseDir string) (map[string]string, ValidationErrors) {
+	prepared := DeclaredArguments(meta, args)
+	if meta == nil {
+		return prepared, nil
+	}
+
+	var errs ValidationErrors
+
+	required := make(map[string]bool)
+	for _, name := range meta.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(meta.Options))
+	for name, opt := range meta.Options {
+		names = append(names, name)
+		if opt.Required {
+			required[name] = true
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		opt := meta.Options[name]
+
+		value, ok := prepared[name]
+		if !ok || value == "" {
+			if opt.Default != "" {
+				value = opt.Default
+				ok = true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		coerced, err := coerceOption(name, opt, value, baseDir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		prepared[name] = coerced
+	}
+
+	// Required names may also appear without a matching options entry
+	requiredNames := make([]string, 0, len(required))
+	for name := range required {
+		requiredNames = append(requiredNames, name)
+	}
+	sort.Strings(requiredNames)
+	for _, name := range requiredNames {
+		if value, ok := prepared[name]; !ok || value == "" {
+			errs = append(errs, &OptionError{Option: name, Reason: "required option is missing"})
+		}
+	}
+
+	return prepared, errs
+}
+
+// coerceOption checks one value against its declared type and returns the canonical form
+func coerceOption(name string, opt OptionMeta, value string, baseDir string) (string, *OptionError) {
+	fail := func(format string, a ...interface{}) (string, *OptionError) {
+		shown := value
+		if opt.IsSecret() {
+			shown = "" // never repeat a credential in an error
+		}
+		return "", &OptionError{Option: name, Value: shown, Reason: fmt.Sprintf(format, a...)}
+	}
+
+	if opt.Pattern != "" {
+		re, err := regexp.Compile(opt.Pattern)
+		if err != nil {
+			return fail("module declares an invalid pattern %q: %v", opt.Pattern, err)
+		}
+		if !re.MatchString(value) {
+			return fail("does not match pattern %s", opt.Pattern)
+		}
+	}
+
+	switch strings.ToLower(opt.Type) {
+	case "", "string", "str", "text", "secret", "password":
+		if len(opt.Choices) > 0 && !containsString(opt.Choices, value) {
+			return fail("must be one of: %s", strings.Join(opt.Choices, ", "))
+		}
+		return value, nil
+
+	case "int", "integer", "number":
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fail("expected an integer")
+		}
+		if opt.Min != nil && n < *opt.Min {
+			return fail("must be >= %d", *opt.Min)
+		}
+		if opt.Max != nil && n > *opt.Max {
+			return fail("must be <= %d", *opt.Max)
+		}
+		return strconv.Itoa(n), nil
+
+	case "bool", "boolean":
+		b, ok := ParseBool(value)
+		if !ok {
+			return fail("expected a boolean (true/false, yes/no, on/off, 1/0)")
+		}
+		return strconv.FormatBool(b), nil
+
+	case "file", "path":
+		// A file is read by the module and must exist; a path may be
+		// one the module is yet to write
+		path := value
+		if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		if !filepath.IsAbs(path) && baseDir != "" {
+			path = filepath.Join(baseDir, path)
+		}
+		if strings.ToLower(opt.Type) == "file" {
+			if _, err := os.Stat(path); err != nil {
+				return fail("file does not exist")
+			}
+		}
+		return path, nil
+
+	case "ip":
+		ip := net.ParseIP(strings.TrimSpace(value))
+		if ip == nil {
+			return fail("expected an IPv4 or IPv6 address")
+		}
+		return ip.String(), nil
+
+	case "cidr":
+		// 10.0.0.5/24 is kept as typed: the host part may matter to the module
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(value)); err != nil {
+			return fail("expected CIDR notation, e.g. 10.0.0.0/24")
+		}
+		return value, nil
+
+	case "port":
+		port, ok := parsePort(value)
+		if !ok {
+			return fail("expected a port between 1 and 65535")
+		}
+		return strconv.Itoa(port), nil
+
+	case "port-range", "ports":
+		canonical, ok := parsePortRange(value)
+		if !ok {
+			return fail("expected ports like 80, 1-1024 or 22,80,8000-8100")
+		}
+		return canonical, nil
+
+	case "url":
+		u, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fail("expected an absolute URL, e.g. https://example.com")
+		}
+		return u.String(), nil
+
+	case "enum", "choice":
+		if len(opt.Choices) == 0 {
+			return value, nil
+		}
+		for _, choice := range opt.Choices {
+			if strings.EqualFold(choice, value) {
+				return choice, nil
+			}
+		}
+		return fail("must be one of: %s", strings.Join(opt.Choices, ", "))
+
+	default:
+		// Unknown types are passed through so newer module.yaml files keep working
+		return value, nil
+	}
+}
+
+// ParseBool accepts the usual spellings of true and false
+func ParseBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "t", "yes", "y", "on", "enable", "enabled":
+		return true, true
+	case "0", "false", "f", "no", "n", "off", "disable", "disabled":
+		return false, true
+	}
+	return false, false
+}
+
+// parsePort parses a single TCP/UDP port number
+func parsePort(value string) (int, bool) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
+
+// parsePortRange validates a comma separated list of ports and port ranges
+func parsePortRange(value string) (string, bool) {
+	var parts []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return "", false
+		}
+		if lo, hi, found := strings.Cut(item, "-"); found {
+			start, ok1 := parsePort(lo)
+			end, ok2 := parsePort(hi)
+			if !ok1 || !ok2 || start > end {
+				return "", false
+			}
+			parts = append(parts, fmt.Sprintf("%d-%d", start, end))
+			continue
+		}
+		port, ok := parsePort(item)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, strconv.Itoa(port))
+	}
+	return strings.Join(parts, ","), true
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
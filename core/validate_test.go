@@ -0,0 +1,131 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestCoerceOption(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "hosts.txt")
+	if err := os.WriteFile(existing, []byte("10.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		opt     OptionMeta
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"string", OptionMeta{}, "anything", "anything", false},
+		{"choices", OptionMeta{Choices: []string{"a", "b"}}, "c", "", true},
+		{"pattern", OptionMeta{Pattern: `^[a-z]+$`}, "abc1", "", true},
+		{"int", OptionMeta{Type: "int"}, " 42 ", "42", false},
+		{"int not a number", OptionMeta{Type: "int"}, "4x", "", true},
+		{"int min", OptionMeta{Type: "int", Min: intPtr(1)}, "0", "", true},
+		{"int max", OptionMeta{Type: "int", Max: intPtr(64)}, "65", "", true},
+		{"bool", OptionMeta{Type: "bool"}, "yes", "true", false},
+		{"bool invalid", OptionMeta{Type: "bool"}, "maybe", "", true},
+		{"file exists", OptionMeta{Type: "file"}, "hosts.txt", existing, false},
+		{"file missing", OptionMeta{Type: "file"}, "nope.txt", "", true},
+		{"path to write", OptionMeta{Type: "path"}, "out/report.txt", filepath.Join(dir, "out/report.txt"), false},
+		{"ip", OptionMeta{Type: "ip"}, "10.0.0.1", "10.0.0.1", false},
+		{"ip invalid", OptionMeta{Type: "ip"}, "10.0.0.256", "", true},
+		{"cidr", OptionMeta{Type: "cidr"}, "10.0.0.0/24", "10.0.0.0/24", false},
+		{"cidr kept as typed", OptionMeta{Type: "cidr"}, "10.0.0.5/24", "10.0.0.5/24", false},
+		{"cidr invalid", OptionMeta{Type: "cidr"}, "10.0.0.0/33", "", true},
+		{"port", OptionMeta{Type: "port"}, "443", "443", false},
+		{"port out of range", OptionMeta{Type: "port"}, "70000", "", true},
+		{"port-range", OptionMeta{Type: "port-range"}, "22, 80,8000-8100", "22,80,8000-8100", false},
+		{"port-range reversed", OptionMeta{Type: "port-range"}, "100-10", "", true},
+		{"url", OptionMeta{Type: "url"}, "https://example.com/x", "https://example.com/x", false},
+		{"url relative", OptionMeta{Type: "url"}, "example.com", "", true},
+		{"enum", OptionMeta{Type: "enum", Choices: []string{"fast", "stealth"}}, "FAST", "fast", false},
+		{"enum invalid", OptionMeta{Type: "enum", Choices: []string{"fast"}}, "slow", "", true},
+		{"unknown type", OptionMeta{Type: "future"}, "x", "x", false},
+	}
+	for _, tt := range tests {
+		got, err := coerceOption("opt", tt.opt, tt.value, dir)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: coerceOption(%q) error = %v, wantErr %t", tt.name, tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: coerceOption(%q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCoerceOptionHidesSecrets(t *testing.T) {
+	_, err := coerceOption("password", OptionMeta{Type: "secret", Pattern: `^\d+$`}, "hunter2", "")
+	if err == nil {
+		t.Fatal("expected a pattern error")
+	}
+	if err.Value != "" {
+		t.Errorf("error repeats the secret: %v", err)
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	meta := &ModuleMetadata{
+		Options: map[string]OptionMeta{
+			"host":    {Type: "ip", Required: true},
+			"threads": {Type: "int", Default: "8"},
+		},
+		Required: []string{"wordlist"},
+	}
+
+	tests := []struct {
+		name     string
+		args     map[string]string
+		want     map[string]string
+		wantErrs []string
+	}{
+		{
+			name: "defaults and undeclared",
+			args: map[string]string{"host": "10.0.0.1", "wordlist": "w.txt", "stray": "x"},
+			want: map[string]string{"host": "10.0.0.1", "wordlist": "w.txt", "threads": "8"},
+		},
+		{
+			name:     "missing required",
+			args:     map[string]string{"threads": "2"},
+			want:     map[string]string{"threads": "2"},
+			wantErrs: []string{"host", "wordlist"},
+		},
+		{
+			name:     "invalid",
+			args:     map[string]string{"host": "nope", "wordlist": "w.txt"},
+			want:     map[string]string{"host": "nope", "wordlist": "w.txt", "threads": "8"},
+			wantErrs: []string{"host"},
+		},
+	}
+	for _, tt := range tests {
+		got, errs := ValidateArguments(meta, tt.args, "")
+		var options []string
+		for _, err := range errs {
+			options = append(options, err.Option)
+		}
+		if len(options) != len(tt.wantErrs) {
+			t.Errorf("%s: errors = %v, want options %v", tt.name, errs, tt.wantErrs)
+			continue
+		}
+		for i := range options {
+			if options[i] != tt.wantErrs[i] {
+				t.Errorf("%s: errors = %v, want options %v", tt.name, errs, tt.wantErrs)
+			}
+		}
+		for key, value := range tt.want {
+			if got[key] != value {
+				t.Errorf("%s: %s = %q, want %q", tt.name, key, got[key], value)
+			}
+		}
+		if _, ok := got["stray"]; ok {
+			t.Errorf("%s: undeclared argument kept", tt.name)
+		}
+	}
+}
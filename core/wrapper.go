@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// knownWrappers are the default command lines for wrapper names that can be
+// used on their own. Anything else in a wrapper list is taken as a custom
+// prefix, e.g. "nice -n 5", "timeout 30s" or "firejail --net=none"
+var knownWrappers = map[string][]string{
+	"sudo":        {"sudo", "-E"}, // -E keeps the ARG_* variables
+	"proxychains": {"proxychains4", "-q"},
+	"torsocks":    {"torsocks"},
+	"nice":        {"nice", "-n", "10"},
+}
+
+// wrapperFallbacks are binaries tried when the default one is not installed
+var wrapperFallbacks = map[string]string{
+	"proxychains4": "proxychains",
+}
+
+// WrapperNames returns the wrappers that can be used without arguments
+func WrapperNames() []string {
+	return []string{"sudo", "proxychains", "torsocks", "nice"}
+}
+
+// IsKnownWrapper reports whether name is a wrapper usable without arguments
+func IsKnownWrapper(name string) bool {
+	_, ok := knownWrappers[name]
+	return ok
+}
+
+// CheckWrapper reports whether a wrapper entry can be used on this system
+func CheckWrapper(wrapper string) error {
+	_, err := wrapperArgv(wrapper)
+	return err
+}
+
+// wrapperArgv turns one wrapper entry into the argv placed before the command
+func wrapperArgv(wrapper string) ([]string, error) {
+	fields := strings.Fields(wrapper)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty execution wrapper")
+	}
+
+	argv := fields
+	if len(fields) == 1 {
+		if known, ok := knownWrappers[fields[0]]; ok {
+			argv = append([]string(nil), known...)
+		} else if fields[0] == "timeout" {
+			return nil, fmt.Errorf("the timeout wrapper needs a duration, e.g. 'timeout 30s'")
+		}
+	} else if fields[0] == "proxychains" {
+		argv = append([]string{"proxychains4"}, fields[1:]...)
+	}
+
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		fallback, ok := wrapperFallbacks[argv[0]]
+		if !ok {
+			return nil, fmt.Errorf("execution wrapper '%s' not found in PATH", argv[0])
+		}
+		if _, err := exec.LookPath(fallback); err != nil {
+			return nil, fmt.Errorf("execution wrapper '%s' not found in PATH", argv[0])
+		}
+		argv[0] = fallback
+	}
+	return argv, nil
+}
+
+// WrapCommand prefixes cmd with the given wrappers, outermost first, so
+// []string{"sudo", "proxychains"} runs: sudo -E proxychains4 -q <cmd>.
+// Dir, Env and the standard streams are carried over
+func WrapCommand(cmd *exec.Cmd, wrappers []string) (*exec.Cmd, error) {
+	if len(wrappers) == 0 {
+		return cmd, nil
+	}
+
+	var argv []string
+	for _, wrapper := range wrappers {
+		prefix, err := wrapperArgv(wrapper)
+		if err != nil {
+			return nil, err
+		}
+		argv = append(argv, prefix...)
+	}
+	// cmd.Path is already resolved, cmd.Args[0] may be a bare name
+	argv = append(argv, cmd.Path)
+	argv = append(argv, cmd.Args[1:]...)
+
+	wrapped := exec.Command(argv[0], argv[1:]...)
+	wrapped.Dir = cmd.Dir
+	wrapped.Env = cmd.Env
+	wrapped.Stdin = cmd.Stdin
+	wrapped.Stdout = cmd.Stdout
+	wrapped.Stderr = cmd.Stderr
+	return wrapped, nil
+}
+
+// authenticateWrappers lets a sudo wrapper ask for its password on the
+// terminal, in our own process group, before the module starts in one of
+// its own. sudo then reuses the cached credentials without prompting
+func authenticateWrappers(wrappers []string) error {
+	for _, wrapper := range wrappers {
+		argv, err := wrapperArgv(wrapper)
+		if err != nil {
+			return err
+		}
+		if argv[0] != "sudo" {
+			continue
+		}
+		cmd := exec.Command("sudo", "-v")
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("sudo authentication failed: %v", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// moduleWrappers returns every wrapper that applies to a module run:
+// the run's own, which include the session's, then the module's own
+func (mm *ModuleManager) moduleWrappers(module *ModuleConfig, opts ExecOptions) []string {
+	wrappers := append([]string(nil), opts.Wrappers...)
+	if module.Metadata != nil {
+		wrappers = append(wrappers, module.Metadata.Wrappers...)
+	}
+	return dedupeWrappers(wrappers)
+}
+
+// dedupeWrappers drops repeated entries so "#sudo" on a module that already
+// declares sudo does not run sudo twice
+func dedupeWrappers(wrappers []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, w := range wrappers {
+		key := strings.Join(strings.Fields(w), " ")
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, key)
+	}
+	return result
+}
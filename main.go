@@ -3,12 +3,31 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"lanmanvan/cli"
 )
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, `Usage:
+  lanmanvan [flags]                          interactive prompt
+  lanmanvan [flags] run <module> [k=v...]    run a module, exit with its exit code
+  lanmanvan [flags] list                     list modules
+  lanmanvan [flags] info <module>            show a module's options
+  lanmanvan [flags] search <keyword>         search modules
+  lanmanvan [flags] env [get <k> | set <k> <v>]
+  lanmanvan [flags] module <install|update|remove|list> ...
+  lanmanvan [flags] <script.lmv>             run the commands in a script
+  lanmanvan [flags] -                        run commands read from stdin
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
 func main() {
 	var modulesDir string
 	var version bool
@@ -19,6 +38,9 @@ func main() {
 	var exec_cmd string
 
 	var show_banner bool
+	var json_out bool
+	var rc_file string
+	var workspace string
 
 	flag.StringVar(&modulesDir, "modules", "./modules", "Path to modules directory (string)")
 	flag.BoolVar(&version, "version", false, "Show version (bool)")
@@ -27,11 +49,15 @@ func main() {
 	flag.StringVar(&exec_cmd, "idle-cmd", "help", "Execute command and exit (string)")
 
 	flag.BoolVar(&show_banner, "banner", false, "Want to show the *lanmanvan* official banner? (bool)")
+	flag.BoolVar(&json_out, "json", false, "Print results as JSON (bool)")
+	flag.StringVar(&rc_file, "rc", "", "Script to run before anything else (string)")
+	flag.StringVar(&workspace, "workspace", "", "Workspace to use, created if missing (string)")
 
+	flag.Usage = usage
 	flag.Parse()
 
 	if version {
-		fmt.Println("LanManVan %s - Advanced Modular Framework in Go", versionText)
+		fmt.Printf("LanManVan %s - Advanced Modular Framework in Go\n", versionText)
 		os.Exit(0)
 	}
 
@@ -52,32 +78,59 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create and start CLI
 	cliInstance := cli.NewCLI(absPath)
-	if !exec {
-		if err := cliInstance.Start(show_banner); err != nil {
+	cliInstance.SetJSON(json_out)
+	cliInstance.SetRC(rc_file)
+	if workspace != "" {
+		if err := cliInstance.UseWorkspace(workspace, true); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			os.Exit(2)
 		}
 	}
 
-	if exec {
-		if exec_cmd != "" {
-			//execute command and exit!
+	args := flag.Args()
+	switch {
+	case exec:
+		// Execute one command and exit
+		err = cliInstance.IdleStart(show_banner, exec_cmd)
+
+	case len(args) > 0 && cli.IsSubcommand(args[0]):
+		err = cliInstance.RunSubcommand(args[0], args[1:])
+
+	case len(args) > 0:
+		// A script file, or - for stdin
+		name, script := "<stdin>", io.Reader(os.Stdin)
+		if args[0] != "-" {
+			f, openErr := os.Open(args[0])
+			if openErr != nil {
+				fmt.Fprintf(os.Stderr, "Error: '%s' is neither a subcommand nor a readable script: %v\n", args[0], openErr)
+				flag.Usage()
+				os.Exit(2)
+			}
+			name, script = args[0], f
+		}
+		err = cliInstance.RunScript(name, script, show_banner)
 
-			//init shell
-			cliInstance := cli.NewCLI(absPath)
+	case !isTerminal(os.Stdin):
+		// Commands piped in: lanmanvan < script.lmv
+		err = cliInstance.RunScript("<stdin>", os.Stdin, show_banner)
 
-			//show banner & execute command
-			if err := cliInstance.IdleStart(show_banner, exec_cmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				os.Exit(1)
-			}
+	default:
+		err = cliInstance.Start(show_banner)
+	}
 
-			//optional: save it to file?
-			//exit
-			os.Exit(0)
-		}
-		os.Exit(0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(cliInstance.ExitCode())
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
@@ -1,18 +1,11 @@
 #!/bin/bash
-# LanManVan CLI setup script (updated: dynamic module cloning)
+# LanManVan CLI setup script (modules installed with lanmanvan module install)
 set -e
 
 BIN_DIR="$HOME/bin"
 LANMANVAN_DIR="$HOME/lanmanvan"
 MODULES_DEST="$LANMANVAN_DIR/modules"
 REPO_FILE="./modules/repo_url.yaml"
-LMV_MODULE_PY="./lmv_module.py"  # Assume this file exists in current dir
-
-# Check if lmv_module.py exists in current dir
-if [ ! -f "$LMV_MODULE_PY" ]; then
-    echo "Error: $LMV_MODULE_PY not found in current directory! Please create it first." >&2
-    exit 1
-fi
 
 mkdir -p "$BIN_DIR" "$LANMANVAN_DIR" "$MODULES_DEST"
 
@@ -33,11 +26,11 @@ if [ ! -f "$REPO_FILE" ]; then
     exit 1
 fi
 
-# Copy repo_url.yaml to LANMANVAN_DIR for later use by lmv_module.py
-cp "$REPO_FILE" "$LANMANVAN_DIR/repo_url.yaml"
-echo " Copied repo_url.yaml to $LANMANVAN_DIR"
+# Copy repo_url.yaml next to the modules, where 'lanmanvan module install' reads it
+cp "$REPO_FILE" "$MODULES_DEST/repo_url.yaml"
+echo " Copied repo_url.yaml to $MODULES_DEST"
 
-# Load repo URLs from repo_url.yaml using a simple parser (supports key: "url" format)
+# Load repo names from repo_url.yaml using a simple parser (supports key: "url" format)
 declare -A REPOS
 while IFS=":" read -r key url; do
     # Skip comments and empty lines
@@ -57,13 +50,6 @@ if [ ${#REPOS[@]} -eq 0 ]; then
     echo "Warning: No repositories found in $REPO_FILE"
 fi
 
-# Temporary directory for cloning
-TMP_DIR="/tmp/lanmanvan_modules_$$"
-mkdir -p "$TMP_DIR"
-
-# Cleanup temp dir on exit
-trap 'rm -rf "$TMP_DIR"' EXIT
-
 # Function to print in red
 red() {
     echo -e "\033[31m$*\033[0m"
@@ -77,31 +63,9 @@ for name in "${!REPOS[@]}"; do
         answer=${answer:-Y}
         case "$answer" in
             [Yy]* )
-                echo "Cloning $name..."
-                repo_tmp="$TMP_DIR/$name"
-                if git clone "$url" "$repo_tmp" 2>/dev/null; then
-                    echo " Cloned $name successfully"
-                else
-                    red "✗ Failed to clone $url"
-                    continue
+                if ! "$BIN_DIR/lanmanvan" -modules "$MODULES_DEST" module install "$name"; then
+                    red "✗ Failed to install $name ($url)"
                 fi
-
-                # Find all subdirectories that contain module.yaml
-                find "$repo_tmp" -type f -name "module.yaml" | while read -r yaml_file; do
-                    module_dir=$(dirname "$yaml_file")
-                    rel_dir=$(realpath --relative-to="$repo_tmp" "$module_dir")
-                    dest_dir="$MODULES_DEST/$rel_dir"
-
-                    mkdir -p "$dest_dir"
-                    rsync -a "$module_dir/" "$dest_dir/"
-                    echo " Copied module: $rel_dir"
-                done
-
-                # Check if any module.yaml was found in this repo
-                if ! find "$repo_tmp" -name "module.yaml" | grep -q .; then
-                    red "Warning: No module.yaml found in any subdirectory of $name – nothing copied!"
-                fi
-
                 break
                 ;;
             [Nn]* )
@@ -123,10 +87,6 @@ for version_file in VERSION.taml VERSION.yaml VERSION.yml; do
     fi
 done
 
-# Copy lmv_module.py to LANMANVAN_DIR
-cp "$LMV_MODULE_PY" "$LANMANVAN_DIR/lmv_module.py"
-echo " Copied lmv_module.py to $LANMANVAN_DIR"
-
 # Alias helper
 add_or_update_alias() {
     local rc_file="$1"
@@ -139,7 +99,7 @@ add_or_update_alias() {
     echo "alias $name='$cmd'" >> "$rc_file"
 }
 
-# Add aliases, including lmv_module to run the Python script
+# Add aliases, lmv_module being the module manager
 for rc in "$HOME/.zshrc" "$HOME/.bashrc" "$HOME/.bash_profile" "$HOME/.zprofile"; do
     [ -f "$rc" ] || continue
     add_or_update_alias "$rc" "lanmanvan" "lanmanvan -modules $MODULES_DEST"
@@ -147,11 +107,11 @@ for rc in "$HOME/.zshrc" "$HOME/.bashrc" "$HOME/.bash_profile" "$HOME/.zprofile"
     add_or_update_alias "$rc" "lmvconsole" "lanmanvan -modules $MODULES_DEST"
     add_or_update_alias "$rc" "lmv_update" \
         "cd /tmp && rm -rf lanmanvan && git clone https://github.com/hmZa-Sfyn/lanmanvan && cd lanmanvan && chmod +x setup.sh && ./setup.sh"
-    add_or_update_alias "$rc" "lmv_module" "python3 $LANMANVAN_DIR/lmv_module.py \"\$@\""
+    add_or_update_alias "$rc" "lmv_module" "lanmanvan -modules $MODULES_DEST module"
 done
 
 echo " LanManVan installed successfully!"
 echo " Binary: $BIN_DIR/lanmanvan"
 echo " Modules directory: $MODULES_DEST"
-echo " lmv_module.py copied and alias added"
+echo " Manage modules with: lmv_module install|update|remove|list"
 echo " Reload your shell or run: source ~/.zshrc || source ~/.bashrc"
\ No newline at end of file